@@ -0,0 +1,302 @@
+package client
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// backupContent はバックアップから読み込んだ1件分のコンテンツ
+type backupContent struct {
+	Endpoint string
+	Status   string
+	Id       string
+	// フィールドは保存されていた順に並ぶ
+	Fields []backupField
+	// コンテンツのJSON文字列
+	// CSV形式の場合は、セルの値から組み立てる(オブジェクトや配列以外の値は文字列となる)
+	Raw string
+	// CSV形式のバックアップから読み込んだかどうか
+	FromCSV bool
+}
+
+// backupField はコンテンツの1フィールド分の値
+// 値がオブジェクトや配列の場合はJSON文字列(CSVのセルと同じ形式)
+type backupField struct {
+	Key   string
+	Value string
+}
+
+// readBackupContents はバックアップのcontents/以下に保存されたコンテンツを1件ずつ読み込む
+// JSON形式(N.json)、CSV形式(contents.csv)、NDJSON形式(contents.ndjson)のいずれにも対応する
+// コンテンツ参照をIDで保存したバックアップ(relationsがid・both)は、展開された内容が残っていればそれを読み込み、
+// 残っていなければ記録されたフィールドのIDをIDのみのコンテンツ参照({"id":"..."})として読み込む
+func readBackupContents(baseDir string, fn func(content backupContent) error) error {
+	contentsDir := filepath.Clean(baseDir + "contents")
+	// ディレクトリごとの、IDで保存したコンテンツ参照のフィールドのパス
+	relationFields := make(map[string]map[string]bool)
+	readRelationFieldsOnce := func(dir string) (map[string]bool, error) {
+		if paths, ok := relationFields[dir]; ok {
+			return paths, nil
+		}
+		paths, err := readRelationFields(dir)
+		if err != nil {
+			return nil, err
+		}
+		relationFields[dir] = paths
+		return paths, nil
+	}
+	readFile := func(path, endpoint, status string) error {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, tempFilePrefix) {
+			return nil
+		}
+		// 展開された内容はIDで保存したファイルの代わりに読み込むため、単独では読み込まない
+		if strings.HasSuffix(name, ".meta.json") || strings.HasSuffix(name, ".columns.json") || strings.Contains(name, ".expanded.") || name == relationFieldsFileName {
+			return nil
+		}
+		expandedPath, ok := expandedBackupPath(path)
+		if !ok {
+			return nil
+		}
+		var paths map[string]bool
+		if _, err := os.Stat(expandedPath); err == nil {
+			path = expandedPath
+		} else {
+			paths, err = readRelationFieldsOnce(filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case filepath.Ext(name) == ".json":
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return fn(newBackupContentFromJSON(endpoint, status, gjson.Parse(expandRelationIDs(string(b), paths))))
+		case name == "contents.csv":
+			return readBackupContentsCSV(path, endpoint, status, paths, fn)
+		default:
+			return readNDJSON(path, func(line []byte) error {
+				return fn(newBackupContentFromJSON(endpoint, status, gjson.Parse(expandRelationIDs(string(line), paths))))
+			})
+		}
+	}
+	err := filepath.WalkDir(contentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		// contents/<エンドポイント>/<ステータス>
+		rel, err := filepath.Rel(contentsDir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) != 2 {
+			return nil
+		}
+		endpoint, status := parts[0], parts[1]
+
+		// JSON形式のN.jsonは、ファイル名の順(10.jsonが2.jsonより前)ではなく、保存した順に読み込む
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+		slices.SortFunc(names, compareBackupFileNames)
+		for _, name := range names {
+			if err := readFile(filepath.Join(path, name), endpoint, status); err != nil {
+				return err
+			}
+		}
+		return fs.SkipDir
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("コンテンツのバックアップが見つかりませんでした: %w", err)
+	}
+	return err
+}
+
+// compareBackupFileNames はディレクトリ内のファイルを読み込む順に比較する
+// N.jsonは番号の順とし、それ以外のファイルはN.jsonの後にファイル名の順とする
+func compareBackupFileNames(a, b string) int {
+	na, errA := strconv.Atoi(strings.TrimSuffix(a, ".json"))
+	nb, errB := strconv.Atoi(strings.TrimSuffix(b, ".json"))
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// expandedBackupPath はコンテンツのファイルについて、展開されたコンテンツ参照を残したファイルのパスを返す
+// コンテンツのファイルでない場合はfalseを返す
+func expandedBackupPath(path string) (string, bool) {
+	dir, name := filepath.Split(path)
+	switch {
+	case filepath.Ext(name) == ".json":
+		return dir + strings.TrimSuffix(name, ".json") + ".expanded.json", true
+	case name == "contents.csv":
+		return dir + "contents.expanded.csv", true
+	case isNDJSONFile(name):
+		return dir + "contents.expanded" + strings.TrimPrefix(name, "contents"), true
+	}
+	return "", false
+}
+
+func newBackupContentFromJSON(endpoint, status string, item gjson.Result) backupContent {
+	content := backupContent{
+		Endpoint: endpoint,
+		Status:   status,
+		Id:       item.Get("id").String(),
+		Raw:      item.Raw,
+	}
+	item.ForEach(func(key, value gjson.Result) bool {
+		content.Fields = append(content.Fields, backupField{Key: key.String(), Value: csvCellValue(value)})
+		return true
+	})
+	return content
+}
+
+func readBackupContentsCSV(path, endpoint, status string, relationFields map[string]bool, fn func(content backupContent) error) error {
+	records, err := readContentsCSVFile(path)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	header := records[0]
+	for _, record := range records[1:] {
+		content := backupContent{Endpoint: endpoint, Status: status, FromCSV: true}
+		for i, key := range header {
+			// メタデータのカラムはコンテンツのフィールドではないため除く
+			if i >= len(record) || strings.HasPrefix(key, metaDataColumnPrefix) {
+				continue
+			}
+			if key == "id" {
+				content.Id = record[i]
+			}
+			content.Fields = append(content.Fields, backupField{Key: key, Value: expandRelationField(key, record[i], relationFields)})
+		}
+		content.Raw = backupFieldsJSON(content.Fields)
+		if err := fn(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readContentsCSVFile はコンテンツのCSVファイルのすべての行を読み込む
+// ヘッダー行に表示名を使って保存した場合は、保存したフィールドIDをヘッダー行とする
+func readContentsCSVFile(path string) ([][]string, error) {
+	records, err := readCSVFile(path)
+	if err != nil || len(records) == 0 {
+		return records, err
+	}
+	b, err := os.ReadFile(csvColumnsPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	if err := json.Unmarshal(b, &columns); err != nil {
+		return nil, fmt.Errorf("%sを読み込めませんでした: %w", csvColumnsPath(path), err)
+	}
+	if len(columns) != len(records[0]) {
+		return nil, fmt.Errorf("%sのカラム数がCSVのヘッダー行と一致しません", csvColumnsPath(path))
+	}
+	records[0] = columns
+	return records, nil
+}
+
+// readCSVFile はCSVファイルのすべての行を読み込む
+// csvの設定(BOM・区切り文字)を変えて保存されたファイルにも対応する
+func readCSVFile(path string) ([][]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data := strings.TrimPrefix(string(b), utf8BOM)
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comma = sniffCSVDelimiter(data)
+	return reader.ReadAll()
+}
+
+// sniffCSVDelimiter はヘッダー行で最も多く使われている区切り文字の候補を返す
+func sniffCSVDelimiter(data string) rune {
+	line, _, _ := strings.Cut(data, "\n")
+	counts := make(map[rune]int)
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && strings.ContainsRune(",\t;|", r):
+			counts[r]++
+		}
+	}
+	delimiter := ','
+	for _, r := range []rune{'\t', ';', '|'} {
+		if counts[r] > counts[delimiter] {
+			delimiter = r
+		}
+	}
+	return delimiter
+}
+
+// backupFieldsJSON はCSVのセルの値からコンテンツのJSON文字列を組み立てる
+// JSONのオブジェクトや配列として解釈できるセルはそのまま、それ以外は文字列とし、空のセルは含めない
+func backupFieldsJSON(fields []backupField) string {
+	var sb strings.Builder
+	sb.WriteString("{")
+	first := true
+	for _, field := range fields {
+		if field.Value == "" {
+			continue
+		}
+		if !first {
+			sb.WriteString(",")
+		}
+		first = false
+		key, _ := json.Marshal(field.Key)
+		sb.Write(key)
+		sb.WriteString(":")
+		if value := gjson.Parse(field.Value); (value.IsObject() || value.IsArray()) && json.Valid([]byte(field.Value)) {
+			sb.WriteString(field.Value)
+			continue
+		}
+		value, _ := json.Marshal(field.Value)
+		sb.Write(value)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
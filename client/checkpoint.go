@@ -0,0 +1,166 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// チェックポイントファイルの名前
+const checkpointFileName = "checkpoint.json"
+
+// ダウンロード済みメディアのチェックポイントを書き込む間隔
+const mediaCheckpointInterval = 100
+
+// LoadCheckpoint はバックアップディレクトリからチェックポイントを読み込む
+// チェックポイントが存在しない場合は空のチェックポイントを返す
+func LoadCheckpoint(baseDir string) (*Checkpoint, error) {
+	cp := &Checkpoint{path: baseDir + checkpointFileName}
+
+	b, err := os.ReadFile(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, fmt.Errorf("チェックポイントの読み込みに失敗しました: %w", err)
+	}
+	return cp, nil
+}
+
+// CanResume はバックアップディレクトリが再開可能かを返す
+// チェックポイントを保存する前に失敗した場合も、未完了の印があれば再開できる
+func (c Client) CanResume(baseDir string) bool {
+	for _, name := range []string{checkpointFileName, incompleteMarkerFileName} {
+		if _, err := os.Stat(baseDir + name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (cp *Checkpoint) save() error {
+	if cp == nil {
+		return nil
+	}
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cp.path, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// remove はバックアップが正常に終了した後にチェックポイントを削除する
+func (cp *Checkpoint) remove() error {
+	if cp == nil {
+		return nil
+	}
+	err := os.Remove(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (cp *Checkpoint) isEndpointCompleted(endpoint string) bool {
+	if cp == nil {
+		return false
+	}
+	return slices.Contains(cp.CompletedEndpoints, endpoint)
+}
+
+func (cp *Checkpoint) completeEndpoint(endpoint string) error {
+	if cp == nil {
+		return nil
+	}
+	cp.CompletedEndpoints = append(cp.CompletedEndpoints, endpoint)
+	cp.CurrentEndpoint = ""
+	cp.Offset = 0
+	return cp.save()
+}
+
+// contentsOffset は処理中のエンドポイントについて、保存済みの次のオフセットを返す
+func (cp *Checkpoint) contentsOffset(endpoint string) int {
+	if cp == nil || cp.CurrentEndpoint != endpoint {
+		return 0
+	}
+	return cp.Offset
+}
+
+func (cp *Checkpoint) setContentsOffset(endpoint string, offset int) error {
+	if cp == nil {
+		return nil
+	}
+	cp.CurrentEndpoint = endpoint
+	cp.Offset = offset
+	return cp.save()
+}
+
+// mediaList は取得済みのメディア一覧と次のページのトークンを返す
+func (cp *Checkpoint) mediaList() ([]Media, string, bool) {
+	if cp == nil {
+		return nil, "", false
+	}
+	return cp.MediaList, cp.MediaToken, cp.MediaListCompleted
+}
+
+func (cp *Checkpoint) setMediaList(medias []Media, token string, completed bool) error {
+	if cp == nil {
+		return nil
+	}
+	cp.MediaList = medias
+	cp.MediaToken = token
+	cp.MediaListCompleted = completed
+	return cp.save()
+}
+
+func (cp *Checkpoint) isMediaDownloaded(id string) bool {
+	if cp == nil {
+		return false
+	}
+	if cp.downloaded == nil {
+		cp.downloaded = make(map[string]bool, len(cp.DownloadedMediaIDs))
+		for _, downloadedID := range cp.DownloadedMediaIDs {
+			cp.downloaded[downloadedID] = true
+		}
+	}
+	return cp.downloaded[id]
+}
+
+// mediaContentType はダウンロード済みのメディアのContent-Typeを返す
+func (cp *Checkpoint) mediaContentType(id string) string {
+	if cp == nil {
+		return ""
+	}
+	return cp.MediaContentTypes[id]
+}
+
+// markMediaDownloaded はダウンロード済みのメディアとそのContent-Typeを記録する
+// 書き込み回数を抑えるため、一定件数ごとにチェックポイントを保存する
+// (中断・失敗した場合は、runBackupで残りを保存する)
+func (cp *Checkpoint) markMediaDownloaded(id, contentType string) error {
+	if cp == nil {
+		return nil
+	}
+	cp.isMediaDownloaded(id)
+	cp.downloaded[id] = true
+	cp.DownloadedMediaIDs = append(cp.DownloadedMediaIDs, id)
+	if contentType != "" {
+		if cp.MediaContentTypes == nil {
+			cp.MediaContentTypes = make(map[string]string)
+		}
+		cp.MediaContentTypes[id] = contentType
+	}
+	if len(cp.DownloadedMediaIDs)%mediaCheckpointInterval == 0 {
+		return cp.save()
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+
+	client := Client{}
+	if client.CanResume(baseDir) {
+		t.Fatalf("CanResume() = true, want false")
+	}
+
+	cp, err := LoadCheckpoint(baseDir)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint() error = %v", err)
+	}
+	if err := cp.completeEndpoint("test"); err != nil {
+		t.Fatalf("completeEndpoint() error = %v", err)
+	}
+	if err := cp.setContentsOffset("test2", 20); err != nil {
+		t.Fatalf("setContentsOffset() error = %v", err)
+	}
+	if err := cp.setMediaList([]Media{{Id: "a"}, {Id: "b"}}, "token", false); err != nil {
+		t.Fatalf("setMediaList() error = %v", err)
+	}
+	if err := cp.markMediaDownloaded("a", "image/png"); err != nil {
+		t.Fatalf("markMediaDownloaded() error = %v", err)
+	}
+	if err := cp.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	if !client.CanResume(baseDir) {
+		t.Fatalf("CanResume() = false, want true")
+	}
+
+	// 保存したチェックポイントを読み込み直して、進捗状況が復元されることを確認
+	resumed, err := LoadCheckpoint(baseDir)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint() error = %v", err)
+	}
+	if !resumed.isEndpointCompleted("test") {
+		t.Errorf("isEndpointCompleted(test) = false, want true")
+	}
+	if resumed.isEndpointCompleted("test2") {
+		t.Errorf("isEndpointCompleted(test2) = true, want false")
+	}
+	if got := resumed.contentsOffset("test2"); got != 20 {
+		t.Errorf("contentsOffset(test2) = %d, want %d", got, 20)
+	}
+	if got := resumed.contentsOffset("test3"); got != 0 {
+		t.Errorf("contentsOffset(test3) = %d, want %d", got, 0)
+	}
+	medias, token, completed := resumed.mediaList()
+	if len(medias) != 2 || token != "token" || completed {
+		t.Errorf("mediaList() = %v, %v, %v", medias, token, completed)
+	}
+	if !resumed.isMediaDownloaded("a") || resumed.isMediaDownloaded("b") {
+		t.Errorf("isMediaDownloaded() = %v, %v, want true, false", resumed.isMediaDownloaded("a"), resumed.isMediaDownloaded("b"))
+	}
+	if got := resumed.mediaContentType("a"); got != "image/png" {
+		t.Errorf("mediaContentType(a) = %q, want %q", got, "image/png")
+	}
+
+	if err := resumed.remove(); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	if client.CanResume(baseDir) {
+		t.Errorf("CanResume() = true after remove, want false")
+	}
+}
+
+func TestCanResumeIncomplete(t *testing.T) {
+	// チェックポイントを保存する前に失敗した場合も、未完了の印があれば再開できる
+	baseDir := t.TempDir() + "/"
+	if err := writeStringAtomic(baseDir+incompleteMarkerFileName, "error\n"); err != nil {
+		t.Fatal(err)
+	}
+	if !(Client{}).CanResume(baseDir) {
+		t.Errorf("CanResume() = false, want true")
+	}
+}
+
+func TestNilCheckpoint(t *testing.T) {
+	// StartBackupを経由しない場合はチェックポイントを持たないため、何も記録されない
+	var cp *Checkpoint
+	if cp.isEndpointCompleted("test") {
+		t.Errorf("isEndpointCompleted() = true, want false")
+	}
+	if err := cp.completeEndpoint("test"); err != nil {
+		t.Errorf("completeEndpoint() error = %v", err)
+	}
+	if err := cp.markMediaDownloaded("a", ""); err != nil {
+		t.Errorf("markMediaDownloaded() error = %v", err)
+	}
+	if err := cp.remove(); err != nil {
+		t.Errorf("remove() error = %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -47,6 +48,32 @@ func TestLoadConfig(t *testing.T) {
 			filePath: tmpFile,
 			wantErr:  false,
 		},
+		{
+			name: "正常系: クエリパラメータを含むエンドポイント",
+			content: `{
+				"target": "contents",
+				"serviceId": "test-service",
+				"contents": {
+					"getPublishContentsAPIKey": "test-key",
+					"endpoints": [{"name": "test", "filters": "category[equals]news", "fields": "id,title", "orders": "-publishedAt", "depth": 1, "q": "検索"}]
+				}
+			}`,
+			filePath: tmpFile,
+			wantErr:  false,
+		},
+		{
+			name: "異常系: エンドポイントの未知のフィールド",
+			content: `{
+				"target": "contents",
+				"serviceId": "test-service",
+				"contents": {
+					"getPublishContentsAPIKey": "test-key",
+					"endpoints": [{"name": "test", "limit": 10}]
+				}
+			}`,
+			filePath: tmpFile,
+			wantErr:  true,
+		},
 		{
 			name:     "異常系: 存在しないファイル",
 			content:  "",
@@ -107,6 +134,14 @@ func TestLoadConfig(t *testing.T) {
 					}
 				}
 
+				if tt.name == "正常系: クエリパラメータを含むエンドポイント" {
+					depth := 1
+					want := Endpoint{Name: "test", Filters: "category[equals]news", Fields: "id,title", Orders: "-publishedAt", Depth: &depth, Q: "検索"}
+					if !reflect.DeepEqual(client.Config.Contents.Endpoints[0], want) {
+						t.Errorf("Endpoints[0] = %+v, want %+v", client.Config.Contents.Endpoints[0], want)
+					}
+				}
+
 				// 基本設定の確認
 				if client.Config.Target != "contents" {
 					t.Errorf("Target = %v, want %v", client.Config.Target, "contents")
@@ -119,8 +154,8 @@ func TestLoadConfig(t *testing.T) {
 				if client.Config.Contents.GetPublishContentsAPIKey != "test-key" {
 					t.Errorf("GetPublishContentsAPIKey = %v, want %v", client.Config.Contents.GetPublishContentsAPIKey, "test-key")
 				}
-				if len(client.Config.Contents.Endpoints) != 1 || client.Config.Contents.Endpoints[0] != "test" {
-					t.Errorf("Endpoints = %v, want %v", client.Config.Contents.Endpoints, []string{"test"})
+				if len(client.Config.Contents.Endpoints) != 1 || client.Config.Contents.Endpoints[0].Name != "test" {
+					t.Errorf("Endpoints = %v, want %v", client.Config.Contents.Endpoints, []Endpoint{{Name: "test"}})
 				}
 			}
 		})
@@ -2,7 +2,7 @@ package client
 
 import (
 	"bytes"
-	"encoding/csv"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,17 +14,81 @@ import (
 	"github.com/tidwall/gjson"
 )
 
-func (c Client) BackupContents(baseDir string) error {
+// CSVでメタデータのカラムに付与する接頭辞
+const metaDataColumnPrefix = "_meta."
+
+func (c Client) BackupContents(ctx context.Context, baseDir string) error {
 	log.Println("コンテンツのバックアップを開始します")
 
+	switch c.Config.Contents.Relations {
+	case "", "expanded", "id", "both":
+	default:
+		return fmt.Errorf("不明なコンテンツ参照の保存形式が選択されました: %s", c.Config.Contents.Relations)
+	}
+	switch c.Config.Contents.Format {
+	case "", "json", "csv", "ndjson", "xlsx":
+	default:
+		return fmt.Errorf("不明なコンテンツの保存形式が選択されました: %s", c.Config.Contents.Format)
+	}
+	if err := c.Config.Contents.CSV.validate(); err != nil {
+		return err
+	}
+	// XLSX形式ではcontents/以下にファイルを保存しないため、保存したコンテンツを読み込む機能は利用できない
+	if c.contentsFormat() == "xlsx" && (c.Config.Contents.SaveReferenceGraph || c.Config.Contents.SavePortableCopy || c.Config.Media.Scope == "referenced" || c.Config.Media.SaveReferenceReport) {
+		return fmt.Errorf("XLSX形式では、saveReferenceGraph・savePortableCopy・saveReferenceReport・メディアの範囲referencedは利用できません")
+	}
+	if err := c.validateRedaction(); err != nil {
+		return err
+	}
+	// 加工したコンテンツを別に保存する場合は、保存したファイルを読み込んで加工する
+	if c.redactsAlongside() && (c.contentsFormat() == "xlsx" || c.Config.Contents.CSV.DisplayNames) {
+		return fmt.Errorf("XLSX形式やCSVのdisplayNamesでは、加工したコンテンツを別に保存(alongside)できません")
+	}
+
+	// コンテンツ参照のフィールドはAPIスキーマから求める
+	if c.storesRelationIDs() {
+		relationFields, err := c.loadRelationFields(ctx)
+		if err != nil {
+			return err
+		}
+		c.relationFields = relationFields
+	}
+
+	// 展開されたコンテンツ参照は、参照先のエンドポイントのルールで加工する
+	if c.needsRedactionTargets() && !c.redactsAlongside() {
+		targets, err := c.loadRedactionTargets(ctx)
+		if err != nil {
+			return err
+		}
+		c.redactionTargets = targets
+	}
+
+	// XLSX形式の場合は、すべてのエンドポイントを1つのワークブックに保存する
+	if c.contentsFormat() == "xlsx" {
+		location, err := c.Config.Contents.XLSX.location()
+		if err != nil {
+			return err
+		}
+		workbook, err := openContentsWorkbook(baseDir+xlsxFileName, location)
+		if err != nil {
+			return fmt.Errorf("ワークブックを開けませんでした: %w", err)
+		}
+		defer workbook.close()
+		c.workbook = workbook
+	}
+
 	for _, endpoint := range c.Config.Contents.Endpoints {
-		log.Printf("%sのバックアップを開始します\n", endpoint)
+		if c.checkpoint.isEndpointCompleted(endpoint.Name) {
+			log.Printf("%sはバックアップ済みのためスキップします\n", endpoint.Name)
+			continue
+		}
+		log.Printf("%sのバックアップを開始します\n", endpoint.Name)
 
 		// 1:ステータスごとの分類を行う場合
 		if c.Config.Contents.ClassifyByStatus {
 			fmt.Println("コンテンツの処理を開始しました")
 			// 全コンテンツの合計件数を取得
-			allCotentsCount, err := c.getContentsTotalCount(endpoint, c.Config.Contents.GetAllStatusContentsAPIKey)
+			allCotentsCount, err := c.getContentsTotalCount(ctx, endpoint, c.Config.Contents.GetAllStatusContentsAPIKey)
 			if err != nil {
 				return fmt.Errorf("全コンテンツの合計件数の取得でエラーが発生しました: %w", err)
 			}
@@ -33,31 +97,43 @@ func (c Client) BackupContents(baseDir string) error {
 			requiredRequestCount := (allCotentsCount/c.Config.Contents.RequestUnit + 1)
 
 			// 全コンテンツの取得した後、ステータスごとにデータを振り分けて保存する
-			err = c.saveContentsWithStatus(endpoint, requiredRequestCount, baseDir)
+			err = c.saveContentsWithStatus(ctx, endpoint, requiredRequestCount, baseDir)
 			if err != nil {
 				return fmt.Errorf("コンテンツの保存でエラーが発生しました: %w", err)
 			}
 		} else {
 			// 2:ステータスごとの分類を行わない場合
-			totalCount, err := c.getContentsTotalCount(endpoint, c.Config.Contents.GetPublishContentsAPIKey)
+			totalCount, err := c.getContentsTotalCount(ctx, endpoint, c.Config.Contents.GetPublishContentsAPIKey)
 			if err != nil {
 				return fmt.Errorf("コンテンツの合計件数の取得でエラーが発生しました: %w", err)
 			}
 			requiredRequestCount := (totalCount/c.Config.Contents.RequestUnit + 1)
 
-			err = c.saveContents(endpoint, requiredRequestCount, baseDir, c.Config.Contents.GetPublishContentsAPIKey, "PUBLISH")
+			err = c.saveContents(ctx, endpoint, requiredRequestCount, baseDir, c.Config.Contents.GetPublishContentsAPIKey, "PUBLISH")
 			if err != nil {
 				return fmt.Errorf("コンテンツの保存でエラーが発生しました: %w", err)
 			}
 		}
+
+		// エンドポイントごとに保存し、中断された場合も保存済みのシートを残す
+		err := c.saveContentsWorkbook()
+		if err != nil {
+			return err
+		}
+
+		err = c.checkpoint.completeEndpoint(endpoint.Name)
+		if err != nil {
+			return fmt.Errorf("チェックポイントの保存でエラーが発生しました: %w", err)
+		}
 	}
 	return nil
 }
 
-func (c Client) getContentsTotalCount(endpoint string, apiKey string) (int, error) {
-	req, _ := http.NewRequest(
+func (c Client) getContentsTotalCount(ctx context.Context, endpoint Endpoint, apiKey string) (int, error) {
+	req, _ := http.NewRequestWithContext(
+		ctx,
 		"GET",
-		fmt.Sprintf("https://%s.microcms.io/api/v1/%s?limit=0", c.Config.ServiceID, endpoint),
+		fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(0, 0)),
 		nil)
 	req.Header.Set("X-MICROCMS-API-KEY", apiKey)
 
@@ -87,22 +163,33 @@ func (c Client) getContentsTotalCount(endpoint string, apiKey string) (int, erro
 	return response.TotalCount, err
 }
 
-func (c Client) saveContents(endpoint string, requiredRequestCount int, baseDir string, apiKey string, status string) error {
-	// CSVファイルとして保存する場合
-	if c.Config.Contents.SaveAsCSV {
-		return c.saveContentsAsCSV(endpoint, requiredRequestCount, baseDir, apiKey, status)
+func (c Client) saveContents(ctx context.Context, endpoint Endpoint, requiredRequestCount int, baseDir string, apiKey string, status string) error {
+	switch c.contentsFormat() {
+	case "csv":
+		// CSVファイルとして保存する場合
+		return c.saveContentsAsCSV(ctx, endpoint, requiredRequestCount, baseDir, apiKey, status)
+	case "ndjson":
+		// NDJSONファイルとして保存する場合
+		return c.saveContentsAsNDJSON(ctx, endpoint, requiredRequestCount, baseDir, apiKey, status)
+	case "xlsx":
+		// ワークブックのシートとして保存する場合も、CSVと同じくすべて取得してから書き込む
+		return c.saveContentsAsCSV(ctx, endpoint, requiredRequestCount, baseDir, apiKey, status)
 	}
 
 	// 従来のJSONファイルとして保存する場合
-	for i := 0; i < requiredRequestCount; i++ {
+	// 中断されたバックアップの場合は、保存済みのページの次から再開する
+	start := c.checkpoint.contentsOffset(endpoint.Name) / c.Config.Contents.RequestUnit
+	for i := start; i < requiredRequestCount; i++ {
 		// 1秒のディレイを追加
-		if i > 0 {
-			time.Sleep(1 * time.Second)
+		if i > start {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
 		}
 
 		client := new(http.Client)
-		requestURL := fmt.Sprintf("https://%s.microcms.io/api/v1/%s?limit=%d&offset=%d", c.Config.ServiceID, endpoint, c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i)
-		req, _ := http.NewRequest("GET", requestURL, nil)
+		requestURL := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i))
+		req, _ := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 		req.Header.Set("X-MICROCMS-API-KEY", apiKey)
 		resp, err := client.Do(req)
 		if err != nil {
@@ -124,16 +211,22 @@ func (c Client) saveContents(endpoint string, requiredRequestCount int, baseDir
 		if !contents.IsArray() {
 			return fmt.Errorf("contentsが配列ではありません")
 		}
+		contents = c.redactContents(endpoint.Name, contents)
 
 		for j, item := range contents.Array() {
 			number := i*c.Config.Contents.RequestUnit + j + 1
 			// item.Rawで元の順序のままJSON文字列が得られる
-			err := c.writeRawJSONWithStatus(item.Raw, baseDir, endpoint, number, status, "")
+			err := c.writeRawJSONWithStatus(item.Raw, baseDir, endpoint.Name, number, status, "")
 			if err != nil {
 				return err
 			}
 		}
 
+		err = c.checkpoint.setContentsOffset(endpoint.Name, c.Config.Contents.RequestUnit*(i+1))
+		if err != nil {
+			return err
+		}
+
 		// 進捗状況の表示
 		fmt.Printf("[%d / %d] %s\n", i+1, requiredRequestCount, requestURL)
 	}
@@ -142,24 +235,7 @@ func (c Client) saveContents(endpoint string, requiredRequestCount int, baseDir
 }
 
 // saveContentsAsCSV はコンテンツをCSVファイルとして保存する関数
-func (c Client) saveContentsAsCSV(endpoint string, requiredRequestCount int, baseDir string, apiKey string, status string) error {
-	// 保存先ディレクトリを作成
-	dir, err := makeSaveDir(baseDir, endpoint, status, "")
-	if err != nil {
-		return err
-	}
-
-	// CSVファイルを作成
-	csvFile, err := os.Create(fmt.Sprintf("%s/contents.csv", dir))
-	if err != nil {
-		return err
-	}
-	defer csvFile.Close()
-
-	// CSVライターを作成
-	writer := csv.NewWriter(csvFile)
-	defer writer.Flush()
-
+func (c Client) saveContentsAsCSV(ctx context.Context, endpoint Endpoint, requiredRequestCount int, baseDir string, apiKey string, status string) error {
 	// すべてのコンテンツで共通のカラムを収集
 	allKeys := make(map[string]bool)
 	var allContents []gjson.Result
@@ -168,8 +244,8 @@ func (c Client) saveContentsAsCSV(endpoint string, requiredRequestCount int, bas
 	// まずすべてのコンテンツを取得して、存在するすべてのキーを収集
 	for i := 0; i < requiredRequestCount; i++ {
 		client := new(http.Client)
-		requestURL := fmt.Sprintf("https://%s.microcms.io/api/v1/%s?limit=%d&offset=%d", c.Config.ServiceID, endpoint, c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i)
-		req, _ := http.NewRequest("GET", requestURL, nil)
+		requestURL := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i))
+		req, _ := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 		req.Header.Set("X-MICROCMS-API-KEY", apiKey)
 		resp, err := client.Do(req)
 		if err != nil {
@@ -191,6 +267,7 @@ func (c Client) saveContentsAsCSV(endpoint string, requiredRequestCount int, bas
 		if !contents.IsArray() {
 			return fmt.Errorf("contentsが配列ではありません")
 		}
+		contents = c.redactContents(endpoint.Name, contents)
 
 		// 各コンテンツのキーを収集
 		for _, item := range contents.Array() {
@@ -222,48 +299,107 @@ func (c Client) saveContentsAsCSV(endpoint string, requiredRequestCount int, bas
 		fmt.Printf("[%d / %d] %s\n", i+1, requiredRequestCount, requestURL)
 	}
 
-	// ヘッダー行を書き込む
-	if err := writer.Write(orderedKeys); err != nil {
+	layout, err := c.csvLayout(ctx, endpoint)
+	if err != nil {
 		return err
 	}
 
-	// 各コンテンツのデータを書き込む
-	for _, item := range allContents {
-		row := make([]string, len(orderedKeys))
-		for i, key := range orderedKeys {
-			value := item.Get(key)
-			// 値がオブジェクトや配列の場合はJSON文字列として保存
-			if value.IsObject() || value.IsArray() {
-				row[i] = value.Raw
-			} else {
-				row[i] = value.String()
+	// XLSX形式の場合は、ワークブックにエンドポイントのシートを追加する
+	if c.contentsFormat() == "xlsx" {
+		return c.workbook.addSheet(endpoint.Name, "", layout, orderedKeys, c.relationContents(endpoint.Name, allContents), nil, nil)
+	}
+
+	// 中断された場合に書きかけのファイルを残さないよう、すべて取得してからファイルを作成する
+	// 保存先ディレクトリを作成
+	dir, err := makeSaveDir(baseDir, endpoint.Name, status, "")
+	if err != nil {
+		return err
+	}
+
+	// CSVファイルを作成
+	return c.saveContentsCSVFiles(endpoint.Name, dir, layout, orderedKeys, allContents, nil, nil)
+}
+
+// saveContentsAsNDJSON はコンテンツを1つのNDJSONファイルとして保存する関数
+// 取得したページごとにファイルへ書き込むため、すべてのコンテンツをメモリに保持しない
+func (c Client) saveContentsAsNDJSON(ctx context.Context, endpoint Endpoint, requiredRequestCount int, baseDir string, apiKey string, status string) error {
+	dir, err := makeSaveDir(baseDir, endpoint.Name, status, "")
+	if err != nil {
+		return err
+	}
+	// 1つのファイルに追記していくため、中断された場合はエンドポイントの最初から取得し直す
+	n := newNDJSONWriter(c.Config.Contents.Gzip)
+	defer n.discard()
+
+	for i := 0; i < requiredRequestCount; i++ {
+		// 1秒のディレイを追加
+		if i > 0 {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
 			}
 		}
-		if err := writer.Write(row); err != nil {
+
+		client := new(http.Client)
+		requestURL := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i))
+		req, _ := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+		req.Header.Set("X-MICROCMS-API-KEY", apiKey)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+		}
+		defer resp.Body.Close()
+
+		// レスポンスボディを読み込む
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
 			return err
 		}
+
+		// gjsonでcontents配列を取得
+		contents := gjson.GetBytes(body, "contents")
+		if !contents.IsArray() {
+			return fmt.Errorf("contentsが配列ではありません")
+		}
+		contents = c.redactContents(endpoint.Name, contents)
+
+		for _, item := range contents.Array() {
+			// item.Rawで元の順序のままJSON文字列が得られる
+			err := c.writeContentNDJSON(n, endpoint.Name, dir, item.Raw)
+			if err != nil {
+				return err
+			}
+		}
+
+		// 進捗状況の表示
+		fmt.Printf("[%d / %d] %s\n", i+1, requiredRequestCount, requestURL)
 	}
 
-	return nil
+	return n.commit()
 }
 
-func (c Client) saveContentsWithStatus(endpoint string, requiredRequestCount int, baseDir string) error {
+func (c Client) saveContentsWithStatus(ctx context.Context, endpoint Endpoint, requiredRequestCount int, baseDir string) error {
 	// すべてのコンテンツで共通のカラムを収集
 	allKeys := make(map[string]bool)
 	var allContents []gjson.Result
 	var orderedKeys []string
 
 	// まずすべてのコンテンツを取得して、存在するすべてのキーを収集
-	for i := 0; i < requiredRequestCount; i++ {
+	// CSVのカラムにのみ使うため、NDJSONの場合は取得しない
+	for i := 0; i < requiredRequestCount && c.contentsFormat() != "ndjson"; i++ {
 		// 1秒のディレイを追加
 		if i > 0 {
-			time.Sleep(2 * time.Second)
+			if err := sleep(ctx, 2*time.Second); err != nil {
+				return err
+			}
 		}
 
 		// コンテンツAPIから取得
 		client := new(http.Client)
-		requestURL := fmt.Sprintf("https://%s.microcms.io/api/v1/%s?limit=%d&offset=%d", c.Config.ServiceID, endpoint, c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i)
-		req, _ := http.NewRequest("GET", requestURL, nil)
+		requestURL := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i))
+		req, _ := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 		req.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.GetAllStatusContentsAPIKey)
 		resp, err := client.Do(req)
 		if err != nil {
@@ -274,37 +410,18 @@ func (c Client) saveContentsWithStatus(endpoint string, requiredRequestCount int
 		}
 		defer resp.Body.Close()
 
-		// マネジメントAPIから取得
-		mRequestURL := fmt.Sprintf("https://%s.microcms-management.io/api/v1/contents/%s?limit=%d&offset=%d", c.Config.ServiceID, endpoint, c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i)
-		mReq, _ := http.NewRequest("GET", mRequestURL, nil)
-		mReq.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.GetContentsMetaDataAPIKey)
-		mResp, err := client.Do(mReq)
-		if err != nil {
-			return err
-		}
-		if mResp.StatusCode != http.StatusOK {
-			return fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", mResp.StatusCode)
-		}
-		defer mResp.Body.Close()
-
 		// レスポンスボディを読み込む
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return err
 		}
 
-		mbody, err := io.ReadAll(mResp.Body)
-		if err != nil {
-			return err
-		}
-
 		// gjsonでcontents配列を取得
 		contents := gjson.GetBytes(body, "contents")
-		mContents := gjson.GetBytes(mbody, "contents")
-
-		if !contents.IsArray() || !mContents.IsArray() {
+		if !contents.IsArray() {
 			return fmt.Errorf("contentsが配列ではありません")
 		}
+		contents = c.redactContents(endpoint.Name, contents)
 
 		// 各コンテンツのキーを収集
 		for j := 0; j < len(contents.Array()); j++ {
@@ -337,18 +454,55 @@ func (c Client) saveContentsWithStatus(endpoint string, requiredRequestCount int
 		fmt.Printf("[%d / %d] %s\n", i+1, requiredRequestCount, requestURL)
 	}
 
+	// ステータスの判定に使うメタデータを、マネジメントAPIからすべて取得する
+	metaDataByID, err := c.getContentsMetaData(ctx, endpoint)
+	if err != nil {
+		return fmt.Errorf("コンテンツのメタデータの取得でエラーが発生しました: %w", err)
+	}
+
 	// ステータスごとにコンテンツを分類
 	statusContents := make(map[string][]gjson.Result)
+	// コンテンツと同じ並びでマネジメントAPIのメタデータを保持
+	statusMetaData := make(map[string][]gjson.Result)
+	allMetaKeys := make(map[string]bool)
+	var orderedMetaKeys []string
+
+	// NDJSONの場合は、分類したコンテンツをページごとにファイルへ書き込む
+	var n *ndjsonWriter
+	if c.contentsFormat() == "ndjson" {
+		n = newNDJSONWriter(c.Config.Contents.Gzip)
+		defer n.discard()
+	}
+	classify := func(status string, item, mItem gjson.Result) error {
+		if n == nil {
+			statusContents[status] = append(statusContents[status], item)
+			statusMetaData[status] = append(statusMetaData[status], mItem)
+			return nil
+		}
+		dir, err := makeSaveDir(baseDir, endpoint.Name, status, "")
+		if err != nil {
+			return err
+		}
+		if err := c.writeContentNDJSON(n, endpoint.Name, dir, item.Raw); err != nil {
+			return err
+		}
+		if c.Config.Contents.SaveMetaData {
+			return n.write(dir, "contents.meta.ndjson", mItem.Raw)
+		}
+		return nil
+	}
 	for i := 0; i < requiredRequestCount; i++ {
 		// 1秒のディレイを追加
 		if i > 0 {
-			time.Sleep(1 * time.Second)
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
 		}
 
 		// コンテンツAPIから取得
 		client := new(http.Client)
-		requestURL := fmt.Sprintf("https://%s.microcms.io/api/v1/%s?limit=%d&offset=%d", c.Config.ServiceID, endpoint, c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i)
-		req, _ := http.NewRequest("GET", requestURL, nil)
+		requestURL := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i))
+		req, _ := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 		req.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.GetAllStatusContentsAPIKey)
 		resp, err := client.Do(req)
 		if err != nil {
@@ -359,118 +513,132 @@ func (c Client) saveContentsWithStatus(endpoint string, requiredRequestCount int
 		}
 		defer resp.Body.Close()
 
-		// マネジメントAPIから取得
-		mRequestURL := fmt.Sprintf("https://%s.microcms-management.io/api/v1/contents/%s?limit=%d&offset=%d", c.Config.ServiceID, endpoint, c.Config.Contents.RequestUnit, c.Config.Contents.RequestUnit*i)
-		mReq, _ := http.NewRequest("GET", mRequestURL, nil)
-		mReq.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.GetContentsMetaDataAPIKey)
-		mResp, err := client.Do(mReq)
-		if err != nil {
-			return err
-		}
-		if mResp.StatusCode != http.StatusOK {
-			return fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", mResp.StatusCode)
-		}
-		defer mResp.Body.Close()
-
 		// レスポンスボディを読み込む
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return err
 		}
 
-		mbody, err := io.ReadAll(mResp.Body)
-		if err != nil {
-			return err
-		}
-
 		// gjsonでcontents配列を取得
 		contents := gjson.GetBytes(body, "contents")
-		mContents := gjson.GetBytes(mbody, "contents")
-
-		if !contents.IsArray() || !mContents.IsArray() {
+		if !contents.IsArray() {
 			return fmt.Errorf("contentsが配列ではありません")
 		}
+		contents = c.redactContents(endpoint.Name, contents)
 
 		for j := 0; j < len(contents.Array()); j++ {
 			item := contents.Array()[j]
-			mItem := mContents.Array()[j]
 
+			// 絞り込みや並び替えを指定した場合はマネジメントAPIと並びが一致しないため、IDでメタデータを探す
 			id := item.Get("id").String()
-			mid := mItem.Get("id").String()
-			if id != mid {
-				return fmt.Errorf("コンテンツIDが一致しませんでした:%s,%s", id, mid)
+			mItem, ok := metaDataByID[id]
+			if !ok {
+				return fmt.Errorf("コンテンツのメタデータが見つかりませんでした:%s", id)
 			}
 
+			// メタデータのキーを収集
+			mItem.ForEach(func(key, value gjson.Result) bool {
+				keyStr := key.String()
+				if !allMetaKeys[keyStr] {
+					orderedMetaKeys = append(orderedMetaKeys, keyStr)
+					allMetaKeys[keyStr] = true
+				}
+				return true
+			})
+
 			status := mItem.Get("status.0").String()
 
 			switch status {
 			case "PUBLISH", "DRAFT", "CLOSED":
-				statusContents[status] = append(statusContents[status], item)
+				if err := classify(status, item, mItem); err != nil {
+					return err
+				}
 			case "PUBLISH_AND_DRAFT":
 				// 下書き保存
-				statusContents["DRAFT"] = append(statusContents["DRAFT"], item)
+				if err := classify("DRAFT", item, mItem); err != nil {
+					return err
+				}
 				// 1秒のディレイを追加
-				time.Sleep(1 * time.Second)
+				if err := sleep(ctx, 1*time.Second); err != nil {
+					return err
+				}
 				// 公開中データ取得
-				publishItem, err := c.getContentWithGJSON(endpoint, c.Config.Contents.GetPublishContentsAPIKey, id)
+				publishItem, err := c.getContentWithGJSON(ctx, endpoint, c.Config.Contents.GetPublishContentsAPIKey, id)
 				if err != nil {
-					log.Fatalf("公開中かつ下書き中コンテンツにおいて、公開中のコンテンツの取得に失敗しました: %v", err)
+					return fmt.Errorf("公開中かつ下書き中コンテンツにおいて、公開中のコンテンツの取得に失敗しました: %w", err)
+				}
+				publishItem = c.redactContent(endpoint.Name, publishItem)
+				if err := classify("PUBLISH", publishItem, mItem); err != nil {
+					return err
 				}
-				statusContents["PUBLISH"] = append(statusContents["PUBLISH"], publishItem)
 			default:
 				fmt.Println("未知のステータスです")
 			}
 		}
 	}
+	if n != nil {
+		return n.commit()
+	}
 
-	// 各ステータスごとにCSVファイルを作成
-	for status, contents := range statusContents {
-		// 保存先ディレクトリを作成
-		dir, err := makeSaveDir(baseDir, endpoint, status, "")
+	// CSVの書き出し方はステータスによらず共通
+	var layout csvLayout
+	if c.contentsFormat() == "csv" || c.contentsFormat() == "xlsx" {
+		layout, err = c.csvLayout(ctx, endpoint)
 		if err != nil {
 			return err
 		}
+	}
 
-		if c.Config.Contents.SaveAsCSV {
-			// CSVファイルを作成
-			csvFile, err := os.Create(fmt.Sprintf("%s/contents.csv", dir))
+	// 各ステータスごとにCSVファイルを作成
+	for _, status := range []string{"PUBLISH", "DRAFT", "CLOSED"} {
+		contents, ok := statusContents[status]
+		if !ok {
+			continue
+		}
+		metaData := statusMetaData[status]
+
+		// XLSX形式の場合は、ワークブックにエンドポイントとステータスのシートを追加する
+		if c.contentsFormat() == "xlsx" {
+			var metaKeys []string
+			if c.Config.Contents.SaveMetaData {
+				metaKeys = orderedMetaKeys
+			}
+			err := c.workbook.addSheet(endpoint.Name, status, layout, orderedKeys, c.relationContents(endpoint.Name, contents), metaKeys, metaData)
 			if err != nil {
 				return err
 			}
-			defer csvFile.Close()
+			continue
+		}
 
-			// CSVライターを作成
-			writer := csv.NewWriter(csvFile)
-			defer writer.Flush()
+		// 保存先ディレクトリを作成
+		dir, err := makeSaveDir(baseDir, endpoint.Name, status, "")
+		if err != nil {
+			return err
+		}
 
-			// ヘッダー行を書き込む
-			if err := writer.Write(orderedKeys); err != nil {
-				return err
+		if c.contentsFormat() == "csv" {
+			// CSVファイルを作成
+			var metaKeys []string
+			if c.Config.Contents.SaveMetaData {
+				metaKeys = orderedMetaKeys
 			}
-
-			// 各コンテンツのデータを書き込む
-			for _, item := range contents {
-				row := make([]string, len(orderedKeys))
-				for i, key := range orderedKeys {
-					value := item.Get(key)
-					// 値がオブジェクトや配列の場合はJSON文字列として保存
-					if value.IsObject() || value.IsArray() {
-						row[i] = value.Raw
-					} else {
-						row[i] = value.String()
-					}
-				}
-				if err := writer.Write(row); err != nil {
-					return err
-				}
+			err := c.saveContentsCSVFiles(endpoint.Name, dir, layout, orderedKeys, contents, metaKeys, metaData)
+			if err != nil {
+				return err
 			}
 		} else {
 			// JSONファイルとして保存
 			for i, item := range contents {
-				err := c.writeRawJSONWithStatus(item.Raw, baseDir, endpoint, i+1, status, "")
+				err := c.writeRawJSONWithStatus(item.Raw, baseDir, endpoint.Name, i+1, status, "")
 				if err != nil {
 					return err
 				}
+				if c.Config.Contents.SaveMetaData {
+					err := c.writeMetaDataJSONWithStatus(metaData[i].Raw, baseDir, endpoint.Name, i+1, status)
+					if err != nil {
+						return err
+					}
+				}
 			}
 		}
 	}
@@ -478,31 +646,180 @@ func (c Client) saveContentsWithStatus(endpoint string, requiredRequestCount int
 	return nil
 }
 
+// getContentsMetaData はマネジメントAPIからエンドポイントのすべてのコンテンツのメタデータを取得し、コンテンツIDごとに返す
+func (c Client) getContentsMetaData(ctx context.Context, endpoint Endpoint) (map[string]gjson.Result, error) {
+	metaData := make(map[string]gjson.Result)
+	for offset := 0; ; {
+		// 1秒のディレイを追加
+		if offset > 0 {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return nil, err
+			}
+		}
+
+		client := new(http.Client)
+		mRequestURL := fmt.Sprintf("%s/v1/contents/%s?limit=%d&offset=%d", c.managementAPIURL(), endpoint.Name, c.Config.Contents.RequestUnit, offset)
+		mReq, _ := http.NewRequestWithContext(ctx, "GET", mRequestURL, nil)
+		mReq.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.GetContentsMetaDataAPIKey)
+		mResp, err := client.Do(mReq)
+		if err != nil {
+			return nil, err
+		}
+		defer mResp.Body.Close()
+		if mResp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", mResp.StatusCode)
+		}
+
+		mbody, err := io.ReadAll(mResp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		mContents := gjson.GetBytes(mbody, "contents")
+		if !mContents.IsArray() {
+			return nil, fmt.Errorf("contentsが配列ではありません")
+		}
+		for _, mItem := range mContents.Array() {
+			metaData[mItem.Get("id").String()] = mItem
+		}
+
+		offset += len(mContents.Array())
+		if len(mContents.Array()) == 0 || offset >= int(gjson.GetBytes(mbody, "totalCount").Int()) {
+			break
+		}
+	}
+	return metaData, nil
+}
+
+// saveContentsCSVFiles はコンテンツ参照の保存形式に応じて、contents.csv(とcontents.expanded.csv)を保存する
+func (c Client) saveContentsCSVFiles(endpoint, dir string, layout csvLayout, orderedKeys []string, contents []gjson.Result, orderedMetaKeys []string, metaData []gjson.Result) error {
+	if !c.storesRelationIDs() {
+		return writeContentsCSV(dir+"/contents.csv", layout, orderedKeys, contents, orderedMetaKeys, metaData)
+	}
+
+	compacted := make([]gjson.Result, len(contents))
+	for i, item := range contents {
+		raw, err := c.compactRelationsIn(endpoint, dir, item.Raw)
+		if err != nil {
+			return err
+		}
+		compacted[i] = gjson.Parse(raw)
+	}
+	err := writeContentsCSV(dir+"/contents.csv", layout, orderedKeys, compacted, orderedMetaKeys, metaData)
+	if err != nil {
+		return err
+	}
+	if c.keepsExpandedRelations() {
+		return writeContentsCSV(dir+"/contents.expanded.csv", layout, orderedKeys, contents, orderedMetaKeys, metaData)
+	}
+	return nil
+}
+
+// writeContentsCSV はコンテンツを1つのCSVファイルとして保存する
+// orderedMetaKeysを指定した場合は、メタデータを接頭辞を付けたカラムとして末尾に追加する
+// ヘッダー行に表示名を使う場合は、カラムのフィールドIDをcsvColumnsPathのファイルに保存する
+func writeContentsCSV(path string, layout csvLayout, orderedKeys []string, contents []gjson.Result, orderedMetaKeys []string, metaData []gjson.Result) error {
+	var columns []string
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		// CSVライターを作成
+		writer, err := layout.config.newCSVWriter(w)
+		if err != nil {
+			return err
+		}
+
+		// 各コンテンツをカラムごとの値に変換する
+		var rows []map[string]gjson.Result
+		var truncated int
+		columns, rows, truncated = layout.table(orderedKeys, contents, orderedMetaKeys, metaData)
+		if truncated > 0 {
+			log.Printf("%d件のコンテンツで配列の要素数がmaxArrayWidthを超えたため、超えた要素は書き出しませんでした: %s\n", truncated, path)
+		}
+
+		// ヘッダー行を書き込む
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = layout.headerLabel(column)
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+
+		// 各コンテンツのデータを書き込む
+		for _, cells := range rows {
+			row := make([]string, 0, len(columns))
+			for _, column := range columns {
+				// 存在しないカラムは空欄とする
+				row = append(row, csvCellValue(cells[column]))
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil || layout.displayNames == nil {
+		return err
+	}
+	b, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	return writeStringAtomic(csvColumnsPath(path), string(b)+"\n")
+}
+
 // itemRawはJSON文字列
 func (c Client) writeRawJSONWithStatus(itemRaw string, baseDir, endpoint string, number int, status, draftStatusDetail string) error {
+	dir, err := makeSaveDir(baseDir, endpoint, status, draftStatusDetail)
+	if err != nil {
+		return err
+	}
+
+	// コンテンツ参照をIDのみで保存する場合は、展開された内容を別のファイルに残す
+	if c.storesRelationIDs() {
+		if c.keepsExpandedRelations() {
+			err := writeFormattedJSON(fmt.Sprintf("%s/%d.expanded.json", dir, number), itemRaw)
+			if err != nil {
+				return err
+			}
+		}
+		itemRaw, err = c.compactRelationsIn(endpoint, dir, itemRaw)
+		if err != nil {
+			return err
+		}
+	}
+	return writeFormattedJSON(fmt.Sprintf("%s/%d.json", dir, number), itemRaw)
+}
+
+// writeFormattedJSON はJSON文字列を整形して保存する
+func writeFormattedJSON(path string, rawJson string) error {
 	// JSONを整形
-	formattedJson, err := formatJson(itemRaw)
+	formattedJson, err := formatJson(rawJson)
 	if err != nil {
 		return err
 	}
+	return writeStringAtomic(path, formattedJson)
+}
 
-	dir, err := makeSaveDir(baseDir, endpoint, status, draftStatusDetail)
+// コンテンツ本体(N.json)と同じディレクトリにメタデータ(N.meta.json)を保存する
+func (c Client) writeMetaDataJSONWithStatus(metaRaw string, baseDir, endpoint string, number int, status string) error {
+	formattedJson, err := formatJson(metaRaw)
 	if err != nil {
 		return err
 	}
-	f, err := os.Create(fmt.Sprintf("%s/%d.json", dir, number))
+
+	dir, err := makeSaveDir(baseDir, endpoint, status, "")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	_, err = f.WriteString(formattedJson)
-	return err
+	return writeStringAtomic(fmt.Sprintf("%s/%d.meta.json", dir, number), formattedJson)
 }
 
 // 公開中データ取得用
-func (c Client) getContentWithGJSON(endpoint, apiKey, contentId string) (gjson.Result, error) {
-	url := fmt.Sprintf("https://%s.microcms.io/api/v1/%s/%s", c.Config.ServiceID, endpoint, contentId)
-	req, _ := http.NewRequest("GET", url, nil)
+func (c Client) getContentWithGJSON(ctx context.Context, endpoint Endpoint, apiKey, contentId string) (gjson.Result, error) {
+	url := fmt.Sprintf("%s/v1/%s/%s?%s", c.contentsAPIURL(), endpoint.Name, contentId, endpoint.detailQuery())
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("X-MICROCMS-API-KEY", apiKey)
 
 	client := new(http.Client)
@@ -521,6 +838,15 @@ func (c Client) getContentWithGJSON(endpoint, apiKey, contentId string) (gjson.R
 	return gjson.ParseBytes(body), nil
 }
 
+// CSVのセルに書き込む値を返す
+// 値がオブジェクトや配列の場合はJSON文字列として保存
+func csvCellValue(value gjson.Result) string {
+	if value.IsObject() || value.IsArray() {
+		return value.Raw
+	}
+	return value.String()
+}
+
 func formatJson(rawJson string) (string, error) {
 	var buf bytes.Buffer
 	err := json.Indent(&buf, []byte(rawJson), "", "  ")
@@ -1,156 +1,525 @@
 package client
 
 import (
+	"context"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
-	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
+	"github.com/tidwall/gjson"
 )
 
-func init() {
-	// Get the current working directory
-	wd, err := os.Getwd()
-	if err != nil {
-		panic("Error getting working directory")
-	}
-
-	// Get the project root directory (where go.mod is located)
-	projectRoot := filepath.Dir(wd)
-
-	// Load .env file from the project root
-	envPath := filepath.Join(projectRoot, ".env")
-	if err := godotenv.Load(envPath); err != nil {
-		panic("Error loading .env file: " + envPath)
-	}
-}
-
 func TestBackupContents(t *testing.T) {
-	type args struct {
-		config  *Config
-		baseDir string
-	}
-
-	publishAPIKey := os.Getenv("PUBLISH_API_KEY")
-	allStatusAPIKey := os.Getenv("ALL_STATUS_API_KEY")
-	metaDataAPIKey := os.Getenv("META_DATA_API_KEY")
-
-	if publishAPIKey == "" || allStatusAPIKey == "" || metaDataAPIKey == "" {
-		t.Skip("API keys not set in environment variables")
-	}
+	keys := testMockKeys()
 
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name     string
+		contents ContentsConfig
+		failures map[string]int
+		want     bool
+		// バックアップディレクトリからの相対パスと、含まれるべき文字列
+		wantFiles map[string]string
 	}{
 		{
 			name: "missing api",
-			args: args{
-				config: &Config{
-					Target:    "contents",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey: publishAPIKey,
-						Endpoints:                []string{"missing"},
-						RequestUnit:              10,
-						ClassifyByStatus:         false,
-						SaveAsCSV:                false,
-					},
-				},
-				baseDir: "../backup/test/",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey: keys.Publish,
+				Endpoints:                []Endpoint{{Name: "missing"}},
+				RequestUnit:              10,
+			},
+			want: false,
+		},
+		{
+			name: "api key incorrect",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey: "incorrectkey",
+				Endpoints:                []Endpoint{{Name: "blogs"}},
+				RequestUnit:              10,
 			},
 			want: false,
 		},
 		{
 			name: "normal",
-			args: args{
-				config: &Config{
-					Target:    "contents",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey: publishAPIKey,
-						Endpoints:                []string{"test", "test2"},
-						RequestUnit:              10,
-						ClassifyByStatus:         false,
-						SaveAsCSV:                false,
-					},
-				},
-				baseDir: "../backup/test/",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey: keys.Publish,
+				Endpoints:                []Endpoint{{Name: "blogs"}, {Name: "categories"}},
+				RequestUnit:              10,
 			},
 			want: true,
+			wantFiles: map[string]string{
+				"contents/blogs/PUBLISH/1.json":      `"title": "公開中"`,
+				"contents/blogs/PUBLISH/2.json":      `"title": "公開中の内容"`,
+				"contents/categories/PUBLISH/1.json": `"id": "news"`,
+			},
 		},
 		{
 			name: "classify by status true, save as csv false",
-			args: args{
-				config: &Config{
-					Target:    "contents",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey:   publishAPIKey,
-						GetAllStatusContentsAPIKey: allStatusAPIKey,
-						GetContentsMetaDataAPIKey:  metaDataAPIKey,
-						Endpoints:                  []string{"test", "test2"},
-						RequestUnit:                10,
-						ClassifyByStatus:           true,
-						SaveAsCSV:                  false,
-					},
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey:   keys.Publish,
+				GetAllStatusContentsAPIKey: keys.AllStatus,
+				GetContentsMetaDataAPIKey:  keys.MetaData,
+				Endpoints:                  []Endpoint{{Name: "blogs"}},
+				RequestUnit:                10,
+				ClassifyByStatus:           true,
+				SaveMetaData:               true,
+			},
+			want: true,
+			wantFiles: map[string]string{
+				"contents/blogs/PUBLISH/1.json":      `"title": "公開中"`,
+				"contents/blogs/PUBLISH/2.json":      `"title": "公開中の内容"`,
+				"contents/blogs/DRAFT/1.json":        `"title": "下書きの内容"`,
+				"contents/blogs/DRAFT/2.json":        `"title": "下書き"`,
+				"contents/blogs/CLOSED/1.json":       `"title": "公開終了"`,
+				"contents/blogs/PUBLISH/1.meta.json": `"PUBLISH"`,
+				"contents/blogs/DRAFT/1.meta.json":   `"PUBLISH_AND_DRAFT"`,
+				"contents/blogs/CLOSED/1.meta.json":  `"CLOSED"`,
+			},
+		},
+		{
+			name: "redaction instead",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey:   keys.Publish,
+				GetAllStatusContentsAPIKey: keys.AllStatus,
+				GetContentsMetaDataAPIKey:  keys.MetaData,
+				Endpoints:                  []Endpoint{{Name: "blogs"}},
+				RequestUnit:                10,
+				ClassifyByStatus:           true,
+				Relations:                  "id",
+				Redaction: RedactionConfig{
+					Rules: map[string][]RedactionRule{"blogs": {{Field: "title", Action: "truncate", Length: 2}}},
 				},
-				baseDir: "../backup/test/",
 			},
 			want: true,
+			wantFiles: map[string]string{
+				"contents/blogs/PUBLISH/1.json": `"title": "公開"`,
+				"contents/blogs/PUBLISH/2.json": `"title": "公開"`,
+				"contents/blogs/DRAFT/1.json":   `"title": "下書"`,
+				"contents/blogs/CLOSED/1.json":  `"title": "公開"`,
+			},
 		},
 		{
-			name: "classify by status false, save as csv true",
-			args: args{
-				config: &Config{
-					Target:    "contents",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey: publishAPIKey,
-						Endpoints:                []string{"test", "test2"},
-						RequestUnit:              10,
-						ClassifyByStatus:         false,
-						SaveAsCSV:                true,
-					},
+			name: "redaction alongside with xlsx",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey: keys.Publish,
+				Endpoints:                []Endpoint{{Name: "blogs"}},
+				RequestUnit:              10,
+				Format:                   "xlsx",
+				Redaction: RedactionConfig{
+					Mode:  "alongside",
+					Rules: map[string][]RedactionRule{"blogs": {{Field: "title", Action: "drop"}}},
 				},
-				baseDir: "../backup/test/",
+			},
+			want: false,
+		},
+		{
+			name: "classify by status false, save as csv true",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey: keys.Publish,
+				Endpoints:                []Endpoint{{Name: "blogs"}},
+				RequestUnit:              10,
+				SaveAsCSV:                true,
 			},
 			want: true,
+			wantFiles: map[string]string{
+				"contents/blogs/PUBLISH/contents.csv": "b,公開中の内容",
+			},
 		},
 		{
 			name: "classify by status true, save as csv true",
-			args: args{
-				config: &Config{
-					Target:    "contents",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey:   publishAPIKey,
-						GetAllStatusContentsAPIKey: allStatusAPIKey,
-						GetContentsMetaDataAPIKey:  metaDataAPIKey,
-						Endpoints:                  []string{"test", "test2"},
-						RequestUnit:                10,
-						ClassifyByStatus:           true,
-						SaveAsCSV:                  true,
-					},
-				},
-				baseDir: "../backup/test/",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey:   keys.Publish,
+				GetAllStatusContentsAPIKey: keys.AllStatus,
+				GetContentsMetaDataAPIKey:  keys.MetaData,
+				Endpoints:                  []Endpoint{{Name: "blogs"}},
+				RequestUnit:                10,
+				ClassifyByStatus:           true,
+				SaveAsCSV:                  true,
+			},
+			want: true,
+			wantFiles: map[string]string{
+				"contents/blogs/PUBLISH/contents.csv": "b,公開中の内容",
+				"contents/blogs/DRAFT/contents.csv":   "b,下書きの内容",
+				"contents/blogs/CLOSED/contents.csv":  "d,公開終了",
+			},
+		},
+		{
+			name: "classify by status true, ndjson",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey:   keys.Publish,
+				GetAllStatusContentsAPIKey: keys.AllStatus,
+				GetContentsMetaDataAPIKey:  keys.MetaData,
+				Endpoints:                  []Endpoint{{Name: "blogs"}},
+				RequestUnit:                10,
+				ClassifyByStatus:           true,
+				Format:                     "ndjson",
 			},
 			want: true,
+			wantFiles: map[string]string{
+				"contents/blogs/PUBLISH/contents.ndjson": `{"id":"a","title":"公開中"}`,
+				"contents/blogs/DRAFT/contents.ndjson":   `{"id":"c","title":"下書き"}`,
+			},
+		},
+		{
+			name: "metadata api key incorrect",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey:   keys.Publish,
+				GetAllStatusContentsAPIKey: keys.AllStatus,
+				GetContentsMetaDataAPIKey:  "incorrectkey",
+				Endpoints:                  []Endpoint{{Name: "blogs"}},
+				RequestUnit:                10,
+				ClassifyByStatus:           true,
+			},
+			want: false,
+		},
+		{
+			name: "published content of publish and draft failed",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey:   keys.Publish,
+				GetAllStatusContentsAPIKey: keys.AllStatus,
+				GetContentsMetaDataAPIKey:  keys.MetaData,
+				Endpoints:                  []Endpoint{{Name: "blogs"}},
+				RequestUnit:                10,
+				ClassifyByStatus:           true,
+			},
+			failures: map[string]int{"/api/v1/blogs/b": 500},
+			want:     false,
+		},
+		{
+			name: "list request failed",
+			contents: ContentsConfig{
+				GetPublishContentsAPIKey: keys.Publish,
+				Endpoints:                []Endpoint{{Name: "blogs"}},
+				RequestUnit:              10,
+			},
+			failures: map[string]int{"/api/v1/blogs": 503},
+			want:     false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			time.Sleep(5 * time.Second)
+			fixture := testMockFixture()
+			fixture.Failures = tt.failures
+			server := mockcms.NewServer(fixture)
+			defer server.Close()
 
-			client := &Client{}
-			client.Config = tt.args.config
+			baseDir := t.TempDir() + "/"
+			client := newMockClient(server, &Config{
+				Target:    "contents",
+				ServiceID: "backup-test",
+				Contents:  tt.contents,
+			})
 
-			err := client.BackupContents(tt.args.baseDir)
+			err := client.BackupContents(context.Background(), baseDir)
 			got := err == nil
 			if got != tt.want {
-				t.Errorf("backupContents() = %v, want %v", got, tt.want)
+				t.Fatalf("backupContents() = %v, want %v (error = %v)", got, tt.want, err)
+			}
+			for path, want := range tt.wantFiles {
+				b, err := os.ReadFile(baseDir + path)
+				if err != nil {
+					t.Errorf("%s が保存されていません: %v", path, err)
+					continue
+				}
+				if !strings.Contains(string(b), want) {
+					t.Errorf("%s に %s が含まれていません:\n%s", path, want, b)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupContentsMetaData(t *testing.T) {
+	keys := testMockKeys()
+	fixture := testMockFixture()
+	fixture.Contents["blogs"][0].Body = `{"id":"a","createdAt":"2024-01-01T00:00:00.000Z","updatedAt":"2024-01-02T00:00:00.000Z","publishedAt":"2024-01-01T00:00:00.000Z","title":"公開中"}`
+	server := mockcms.NewServer(fixture)
+	defer server.Close()
+
+	// マネジメントAPIが返すメタデータ
+	req, _ := http.NewRequest(http.MethodGet, server.ManagementAPIBaseURL()+"/v1/contents/blogs?limit=10&offset=0", nil)
+	req.Header.Set("X-MICROCMS-API-KEY", keys.MetaData)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantByID := make(map[string]string)
+	for _, item := range gjson.GetBytes(body, "contents").Array() {
+		wantByID[item.Get("id").String()] = item.Raw
+	}
+
+	baseDir := t.TempDir() + "/"
+	client := newMockClient(server, &Config{
+		Target: "contents",
+		Contents: ContentsConfig{
+			GetPublishContentsAPIKey:   keys.Publish,
+			GetAllStatusContentsAPIKey: keys.AllStatus,
+			GetContentsMetaDataAPIKey:  keys.MetaData,
+			Endpoints:                  []Endpoint{{Name: "blogs"}},
+			RequestUnit:                10,
+			ClassifyByStatus:           true,
+			SaveMetaData:               true,
+		},
+	})
+	if err := client.BackupContents(context.Background(), baseDir); err != nil {
+		t.Fatalf("BackupContents() error = %v", err)
+	}
+
+	// N.meta.jsonは、同じ番号のN.jsonのコンテンツのメタデータと一致する
+	paths, err := filepath.Glob(baseDir + "contents/blogs/*/*.meta.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 5 {
+		t.Fatalf("meta.jsonの件数 = %d, want 5: %v", len(paths), paths)
+	}
+	for _, path := range paths {
+		meta, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(strings.TrimSuffix(path, ".meta.json") + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := gjson.GetBytes(content, "id").String()
+		want, err := formatJson(wantByID[id])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(meta) != want {
+			t.Errorf("%s = %s, want %s", path, meta, want)
+		}
+	}
+}
+
+// ヘッダー行に表示名を使ったCSVも、フィールドIDで読み込める
+func TestBackupContentsCSVDisplayNames(t *testing.T) {
+	keys := testMockKeys()
+	server := mockcms.NewServer(testMockFixture())
+	defer server.Close()
+
+	baseDir := t.TempDir() + "/"
+	client := newMockClient(server, &Config{
+		Target: "contents",
+		Contents: ContentsConfig{
+			GetPublishContentsAPIKey:  keys.Publish,
+			GetContentsMetaDataAPIKey: keys.MetaData,
+			Endpoints:                 []Endpoint{{Name: "blogs"}},
+			RequestUnit:               10,
+			Format:                    "csv",
+			CSV:                       CSVConfig{DisplayNames: true},
+		},
+	})
+	if err := client.BackupContents(context.Background(), baseDir); err != nil {
+		t.Fatalf("BackupContents() error = %v", err)
+	}
+
+	b, err := os.ReadFile(baseDir + "contents/blogs/PUBLISH/contents.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header, _, _ := strings.Cut(string(b), "\n"); header != "id,タイトル" {
+		t.Errorf("header = %s, want id,タイトル", header)
+	}
+
+	var got []backupContent
+	err = readBackupContents(baseDir, func(content backupContent) error {
+		got = append(got, content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readBackupContents() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Id != "a" || got[0].Raw != `{"id":"a","title":"公開中"}` {
+		t.Errorf("readBackupContents() = %v", got)
+	}
+}
+
+// エンドポイントのクエリパラメータで絞り込んだコンテンツのみを保存する
+func TestBackupContentsEndpointQuery(t *testing.T) {
+	keys := testMockKeys()
+	fixture := testMockFixture()
+	fixture.Contents["blogs"] = []mockcms.Content{
+		{Status: "PUBLISH", Body: `{"id":"a","title":"公開中","category":{"id":"news","name":"ニュース"}}`},
+		{Status: "PUBLISH", Body: `{"id":"b","title":"対象外","category":null}`},
+	}
+	fixture.Schemas["blogs"] = `[{"fieldId":"title","kind":"text"},{"fieldId":"category","kind":"relation"}]`
+	server := mockcms.NewServer(fixture)
+	defer server.Close()
+
+	depth := 0
+	baseDir := t.TempDir() + "/"
+	client := newMockClient(server, &Config{
+		Target: "contents",
+		Contents: ContentsConfig{
+			GetPublishContentsAPIKey: keys.Publish,
+			Endpoints:                []Endpoint{{Name: "blogs", Filters: "category[equals]news", Fields: "category", Depth: &depth}},
+			RequestUnit:              10,
+			Format:                   "ndjson",
+		},
+	})
+	if err := client.BackupContents(context.Background(), baseDir); err != nil {
+		t.Fatalf("BackupContents() error = %v", err)
+	}
+	b, err := os.ReadFile(baseDir + "contents/blogs/PUBLISH/contents.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"id":"a","category":{"id":"news"}}` + "\n"; string(b) != want {
+		t.Errorf("contents.ndjson = %q, want %q", b, want)
+	}
+}
+
+// 他のエンドポイントのコンテンツに展開された参照先には、参照先のエンドポイントの加工のルールを適用する
+func TestBackupContentsRedactionRelations(t *testing.T) {
+	keys := testMockKeys()
+	fixture := testMockFixture()
+	fixture.Contents["blogs"] = []mockcms.Content{
+		{Status: "PUBLISH", Body: `{"id":"a","title":"公開中","author":{"id":"u1","createdAt":"2024-01-01T00:00:00.000Z","email":"taro@example.jp"}}`},
+	}
+	fixture.Contents["users"] = []mockcms.Content{
+		{Status: "PUBLISH", Body: `{"id":"u1","createdAt":"2024-01-01T00:00:00.000Z","email":"taro@example.jp"}`},
+	}
+	fixture.Schemas["blogs"] = `[{"fieldId":"title","kind":"text"},{"fieldId":"author","kind":"relation"}]`
+	fixture.Schemas["users"] = `[{"fieldId":"email","kind":"text"}]`
+	fakeEmail := "user-" + testHMAC("secret-salt", "taro@example.jp")[:8] + "@example.com"
+
+	tests := []struct {
+		name      string
+		relations string
+		mode      string
+		format    string
+		flatten   bool
+		endpoints []Endpoint
+		want      bool
+		// バックアップ(alongsideの場合はredacted/)からの相対パスと、含まれるべき文字列
+		wantFile string
+		wantText string
+	}{
+		{name: "展開", want: true, wantFile: "contents/blogs/PUBLISH/1.json", wantText: fakeEmail},
+		{name: "参照先のエンドポイントを保存しない", endpoints: []Endpoint{{Name: "blogs"}}, want: true, wantFile: "contents/blogs/PUBLISH/1.json", wantText: fakeEmail},
+		{name: "IDと展開", relations: "both", want: true, wantFile: "contents/blogs/PUBLISH/1.expanded.json", wantText: fakeEmail},
+		{name: "展開 alongside", mode: "alongside", want: true, wantFile: "contents/blogs/PUBLISH/1.json", wantText: fakeEmail},
+		{name: "展開 alongside ndjson", mode: "alongside", format: "ndjson", want: true, wantFile: "contents/blogs/PUBLISH/contents.ndjson", wantText: fakeEmail},
+		{name: "展開 alongside csv", mode: "alongside", format: "csv", want: true, wantFile: "contents/blogs/PUBLISH/contents.csv", wantText: fakeEmail},
+		{name: "展開 alongside csv flatten", mode: "alongside", format: "csv", flatten: true, want: false},
+		{name: "ID alongside csv flatten", relations: "id", mode: "alongside", format: "csv", flatten: true, want: true, wantFile: "contents/blogs/PUBLISH/contents.csv", wantText: "a,公開中,u1"},
+		{name: "ID alongside", relations: "id", mode: "alongside", want: true, wantFile: "contents/blogs/PUBLISH/1.json", wantText: `"author": "u1"`},
+		{name: "ID", relations: "id", want: true, wantFile: "contents/blogs/PUBLISH/1.json", wantText: `"author": "u1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := mockcms.NewServer(fixture)
+			defer server.Close()
+
+			endpoints := tt.endpoints
+			if endpoints == nil {
+				endpoints = []Endpoint{{Name: "blogs"}, {Name: "users"}}
+			}
+			baseDir := t.TempDir() + "/"
+			client := newMockClient(server, &Config{
+				Target: "contents",
+				Contents: ContentsConfig{
+					GetPublishContentsAPIKey:  keys.Publish,
+					GetContentsMetaDataAPIKey: keys.MetaData,
+					Endpoints:                 endpoints,
+					RequestUnit:               10,
+					Format:                    tt.format,
+					CSV:                       CSVConfig{Flatten: tt.flatten},
+					Relations:                 tt.relations,
+					Redaction: RedactionConfig{
+						Mode:  tt.mode,
+						Salt:  "secret-salt",
+						Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "fake", Fake: "email"}}},
+					},
+				},
+			})
+			err := client.BackupContents(context.Background(), baseDir)
+			if got := err == nil; got != tt.want {
+				t.Fatalf("BackupContents() = %v, want %v (error = %v)", got, tt.want, err)
+			}
+			if !tt.want {
+				return
+			}
+			if tt.mode == "alongside" {
+				if err := client.saveRedactedContents(context.Background(), baseDir); err != nil {
+					t.Fatalf("saveRedactedContents() error = %v", err)
+				}
+				baseDir += redactedDirName + "/"
+			}
+
+			// 加工したコンテンツには、参照元のエンドポイントを含めて加工前の値が残らない
+			err = filepath.WalkDir(baseDir+"contents", func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				if strings.Contains(string(b), "taro@example.jp") {
+					t.Errorf("%s に加工前の値が含まれています: %s", path, b)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(baseDir + tt.wantFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tt.wantText) {
+				t.Errorf("%s に %s が含まれていません: %s", tt.wantFile, tt.wantText, b)
+			}
+		})
+	}
+}
+
+func TestWriteMetaDataJSONWithStatus(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	c := Client{Config: &Config{}}
+	metaRaw := `{"id":"a","status":["PUBLISH"],"createdBy":{"id":"u1"}}`
+	if err := c.writeMetaDataJSONWithStatus(metaRaw, baseDir, "blogs", 1, "PUBLISH"); err != nil {
+		t.Fatalf("writeMetaDataJSONWithStatus() error = %v", err)
+	}
+
+	// コンテンツ本体(N.json)と同じディレクトリに、同じ番号で保存する
+	b, err := os.ReadFile(baseDir + "contents/blogs/PUBLISH/1.meta.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := gjson.ParseBytes(b)
+	if got.Get("id").String() != "a" || got.Get("status.0").String() != "PUBLISH" || got.Get("createdBy.id").String() != "u1" {
+		t.Errorf("1.meta.json = %s", b)
+	}
+}
+
+func TestCSVCellValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{raw: `"公開中"`, want: "公開中"},
+		{raw: `12`, want: "12"},
+		{raw: `true`, want: "true"},
+		{raw: `null`, want: ""},
+		{raw: `["PUBLISH","DRAFT"]`, want: `["PUBLISH","DRAFT"]`},
+		{raw: `{"id":"u1"}`, want: `{"id":"u1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := csvCellValue(gjson.Parse(tt.raw)); got != tt.want {
+				t.Errorf("csvCellValue() = %q, want %q", got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,285 @@
+package client
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+)
+
+// UTF-8のBOM
+const utf8BOM = "\ufeff"
+
+// csvLayout はエンドポイントごとのCSVの書き出し方
+type csvLayout struct {
+	config CSVConfig
+	// 書き出すカラムとその順序(空の場合はすべてのカラム)
+	columns []string
+	// フィールドIDから表示名への対応(ヘッダー行に表示名を使う場合のみ)
+	displayNames map[string]string
+	// APIスキーマから求めたコンテンツ参照のフィールドのパス(展開する場合のみ)
+	// 含まれないフィールドは、コンテンツ参照であっても通常のオブジェクトとして展開する
+	relations map[string]bool
+}
+
+// csvColumnsPath はCSVファイルのカラムのフィールドIDを保存するファイルのパスを返す
+// ヘッダー行に表示名を使った場合に、読み込む際にフィールドIDに戻すために使う
+func csvColumnsPath(csvPath string) string {
+	return strings.TrimSuffix(csvPath, ".csv") + ".columns.json"
+}
+
+// validate はCSVの設定が正しいかどうかを確認する
+func (cfg CSVConfig) validate() error {
+	if cfg.Delimiter != "" && utf8.RuneCountInString(cfg.Delimiter) != 1 {
+		return fmt.Errorf("CSVの区切り文字は1文字で指定してください: %q", cfg.Delimiter)
+	}
+	if cfg.MaxArrayWidth < 0 {
+		return fmt.Errorf("CSVの配列の最大要素数は0以上で指定してください: %d", cfg.MaxArrayWidth)
+	}
+	// IDがないとバックアップを読み込む機能でコンテンツを特定できない
+	for endpoint, columns := range cfg.Columns {
+		if !slices.Contains(columns, "id") {
+			return fmt.Errorf("CSVのカラム(columns)にはidを含めてください: %s", endpoint)
+		}
+	}
+	return nil
+}
+
+// newCSVWriter は設定に従ってCSVライターを作成する
+// BOMを付ける場合は、ライターを作成する前に書き込む
+func (cfg CSVConfig) newCSVWriter(w io.Writer) (*csv.Writer, error) {
+	if cfg.BOM {
+		if _, err := io.WriteString(w, utf8BOM); err != nil {
+			return nil, err
+		}
+	}
+	writer := csv.NewWriter(w)
+	if cfg.Delimiter != "" {
+		writer.Comma, _ = utf8.DecodeRuneInString(cfg.Delimiter)
+	}
+	writer.UseCRLF = cfg.CRLF
+	return writer, nil
+}
+
+// headerLabel はヘッダー行に書き込むカラム名を返す
+// 展開したカラムは、元のフィールドIDの部分のみを表示名に置き換える
+// 表示名がないカラム(idや作成日時、メタデータなど)はそのまま返す
+func (l csvLayout) headerLabel(column string) string {
+	key, rest := column, ""
+	if i := strings.IndexAny(column, ".["); i >= 0 && !strings.HasPrefix(column, metaDataColumnPrefix) {
+		key, rest = column[:i], column[i:]
+	}
+	if name, ok := l.displayNames[key]; ok && name != "" {
+		return name + rest
+	}
+	return column
+}
+
+// table はコンテンツを表形式に変換し、書き出すカラムと、行ごとのカラムの値を返す
+// カラムは出現順に収集し、展開したカラムは元のフィールドの位置にまとめて並べる
+// orderedMetaKeysを指定した場合は、メタデータを接頭辞を付けたカラムとして末尾に追加する
+// 配列の要素数がmaxArrayWidthを超えたコンテンツの件数も返す
+func (l csvLayout) table(orderedKeys []string, contents []gjson.Result, orderedMetaKeys []string, metaData []gjson.Result) ([]string, []map[string]gjson.Result, int) {
+	rows := make([]map[string]gjson.Result, len(contents))
+	groups := make(map[string][]string)
+	seen := make(map[string]bool)
+	truncated := 0
+	for j, item := range contents {
+		row := make(map[string]gjson.Result)
+		add := func(group string) func(column string, value gjson.Result) {
+			return func(column string, value gjson.Result) {
+				row[column] = value
+				if !seen[column] {
+					seen[column] = true
+					groups[group] = append(groups[group], column)
+				}
+			}
+		}
+		isTruncated := false
+		for _, key := range orderedKeys {
+			isTruncated = l.csvCells(key, key, item.Get(key), add(key)) || isTruncated
+		}
+		if j < len(metaData) {
+			for _, key := range orderedMetaKeys {
+				column := metaDataColumnPrefix + key
+				isTruncated = l.csvCells(column, "", metaData[j].Get(key), add(column)) || isTruncated
+			}
+		}
+		if isTruncated {
+			truncated++
+		}
+		rows[j] = row
+	}
+
+	var columns []string
+	for _, key := range orderedKeys {
+		columns = append(columns, dropEmptyUnflattened(key, groups[key], rows)...)
+	}
+	for _, key := range orderedMetaKeys {
+		column := metaDataColumnPrefix + key
+		columns = append(columns, dropEmptyUnflattened(column, groups[column], rows)...)
+	}
+	return l.selectColumns(columns), rows, truncated
+}
+
+// dropEmptyUnflattened は展開したカラムがある場合に、展開していない元のカラムを除く
+// nullのコンテンツ参照や空の配列は、展開したカラムの空欄として表す
+// 元のカラムに値がある行がある場合は除かない
+func dropEmptyUnflattened(column string, group []string, rows []map[string]gjson.Result) []string {
+	if len(group) < 2 || !slices.Contains(group, column) {
+		return group
+	}
+	for _, row := range rows {
+		if csvCellValue(row[column]) != "" {
+			return group
+		}
+	}
+	return slices.DeleteFunc(slices.Clone(group), func(c string) bool {
+		return c == column
+	})
+}
+
+// csvCells はフィールドの値をカラムごとの値に分け、カラムの出現順にfnに渡す
+// flattenが無効な場合は、オブジェクトや配列をそのまま1つのカラムの値とする
+// pathはフィールドのパスで、コンテンツ参照かどうかの判定に使う(メタデータは空とする)
+// 配列の要素数がmaxArrayWidthを超えて、書き出さなかった要素がある場合はtrueを返す
+func (l csvLayout) csvCells(column, path string, value gjson.Result, fn func(column string, value gjson.Result)) bool {
+	cfg := l.config
+	if !cfg.Flatten {
+		fn(column, value)
+		return false
+	}
+
+	switch {
+	case !value.Exists():
+		return false
+	case path != "" && l.relations[path] && value.IsObject():
+		// コンテンツ参照はIDのみを書き出す
+		fn(column+".id", value.Get("id"))
+		return false
+	case value.IsObject():
+		truncated := false
+		empty := true
+		value.ForEach(func(key, child gjson.Result) bool {
+			empty = false
+			childPath := ""
+			if path != "" {
+				childPath = joinFieldPath(path, key.String())
+			}
+			truncated = l.csvCells(column+"."+key.String(), childPath, child, fn) || truncated
+			return true
+		})
+		if empty {
+			fn(column, gjson.Result{})
+		}
+		return truncated
+	case value.IsArray():
+		elements := value.Array()
+		if len(elements) == 0 {
+			fn(column, gjson.Result{})
+			return false
+		}
+		// 複数選択などの値のみの配列は、区切り文字で連結して1つのカラムにできる
+		if cfg.ArrayJoin != "" && isScalarArray(elements) {
+			values := make([]string, len(elements))
+			for i, element := range elements {
+				values[i] = element.String()
+			}
+			fn(column, gjson.Result{Type: gjson.String, Str: strings.Join(values, cfg.ArrayJoin)})
+			return false
+		}
+		truncated := false
+		if cfg.MaxArrayWidth > 0 && len(elements) > cfg.MaxArrayWidth {
+			elements = elements[:cfg.MaxArrayWidth]
+			truncated = true
+		}
+		for i, element := range elements {
+			truncated = l.csvCells(fmt.Sprintf("%s[%d]", column, i), path, element, fn) || truncated
+		}
+		return truncated
+	default:
+		fn(column, value)
+		return false
+	}
+}
+
+// isScalarArray は配列の要素がすべてオブジェクトや配列ではない値かどうかを返す
+func isScalarArray(elements []gjson.Result) bool {
+	for _, element := range elements {
+		if element.IsObject() || element.IsArray() {
+			return false
+		}
+	}
+	return true
+}
+
+// selectColumns は設定されたカラムがあれば、その順序で返す
+// 展開する場合は、展開前のフィールドID(例: eyecatch)を指定すると、展開したカラム(eyecatch.url、eyecatch.width)を出現順に返す
+func (l csvLayout) selectColumns(columns []string) []string {
+	if len(l.columns) == 0 {
+		return columns
+	}
+	if !l.config.Flatten {
+		return l.columns
+	}
+	var selected []string
+	for _, column := range l.columns {
+		matched := []string{column}
+		if !slices.Contains(columns, column) {
+			var flattened []string
+			for _, c := range columns {
+				if strings.HasPrefix(c, column+".") || strings.HasPrefix(c, column+"[") {
+					flattened = append(flattened, c)
+				}
+			}
+			// 一致するカラムがない場合は、コンテンツに存在しないカラムとして空欄とする
+			if len(flattened) > 0 {
+				matched = flattened
+			}
+		}
+		for _, c := range matched {
+			if !slices.Contains(selected, c) {
+				selected = append(selected, c)
+			}
+		}
+	}
+	return selected
+}
+
+// csvLayout はエンドポイントのCSVの書き出し方を返す
+// 展開する場合は、getContentsMetaDataAPIKeyが指定されていればAPIスキーマからコンテンツ参照のフィールドを求める
+func (c Client) csvLayout(ctx context.Context, endpoint Endpoint) (csvLayout, error) {
+	layout := csvLayout{
+		config:  c.Config.Contents.CSV,
+		columns: c.Config.Contents.CSV.Columns[endpoint.Name],
+	}
+	needsRelations := c.Config.Contents.CSV.Flatten && c.Config.Contents.GetContentsMetaDataAPIKey != ""
+	if !c.Config.Contents.CSV.DisplayNames && !needsRelations {
+		return layout, nil
+	}
+	schema, err := c.getAPISchema(ctx, endpoint.Name)
+	if err != nil {
+		return csvLayout{}, fmt.Errorf("APIスキーマの取得でエラーが発生しました: %w", err)
+	}
+	if c.Config.Contents.CSV.DisplayNames {
+		layout.displayNames = fieldDisplayNames(schema.APIFields)
+	}
+	if needsRelations {
+		layout.relations = schema.relationPaths()
+	}
+	return layout, nil
+}
+
+// fieldDisplayNames はAPIスキーマのフィールドから、フィールドIDと表示名の対応を返す
+func fieldDisplayNames(fields []APIField) map[string]string {
+	names := make(map[string]string, len(fields))
+	for _, field := range fields {
+		names[field.FieldId] = field.Name
+	}
+	return names
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestWriteContentsCSV(t *testing.T) {
+	contents := []gjson.Result{
+		gjson.Parse(`{"id":"a","title":"タイトル","body":"本文, 改行\nあり","tags":["x"]}`),
+		gjson.Parse(`{"id":"b","title":"b"}`),
+	}
+	metaData := []gjson.Result{
+		gjson.Parse(`{"status":["PUBLISH"]}`),
+		gjson.Parse(`{"status":["DRAFT"]}`),
+	}
+	orderedKeys := []string{"id", "title", "body", "tags"}
+
+	tests := []struct {
+		name   string
+		layout csvLayout
+		want   string
+	}{
+		{
+			name:   "省略時",
+			layout: csvLayout{},
+			want: "id,title,body,tags,_meta.status\n" +
+				"a,タイトル,\"本文, 改行\nあり\",\"[\"\"x\"\"]\",\"[\"\"PUBLISH\"\"]\"\n" +
+				"b,b,,,\"[\"\"DRAFT\"\"]\"\n",
+		},
+		{
+			name: "BOM・タブ区切り・CRLF",
+			layout: csvLayout{
+				config: CSVConfig{BOM: true, Delimiter: "\t", CRLF: true},
+			},
+			want: "\ufeffid\ttitle\tbody\ttags\t_meta.status\r\n" +
+				"a\tタイトル\t\"本文, 改行\r\nあり\"\t\"[\"\"x\"\"]\"\t\"[\"\"PUBLISH\"\"]\"\r\n" +
+				"b\tb\t\t\t\"[\"\"DRAFT\"\"]\"\r\n",
+		},
+		{
+			name: "カラムの指定と表示名",
+			layout: csvLayout{
+				columns:      []string{"title", "id", "_meta.status", "missing"},
+				displayNames: map[string]string{"title": "タイトル", "body": "本文"},
+			},
+			want: "タイトル,id,_meta.status,missing\n" +
+				"タイトル,a,\"[\"\"PUBLISH\"\"]\",\n" +
+				"b,b,\"[\"\"DRAFT\"\"]\",\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/contents.csv"
+			err := writeContentsCSV(path, tt.layout, orderedKeys, contents, []string{"status"}, metaData)
+			if err != nil {
+				t.Fatalf("writeContentsCSV() error = %v", err)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("writeContentsCSV() = %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBackupContentsCSVWithOptions(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	dir, err := makeSaveDir(baseDir, "blogs", "PUBLISH", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := csvLayout{config: CSVConfig{BOM: true, Delimiter: ";", CRLF: true}}
+	contents := []gjson.Result{gjson.Parse(`{"id":"a","title":"x;y"}`)}
+	if err := writeContentsCSV(dir+"/contents.csv", layout, []string{"id", "title"}, contents, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []backupContent
+	err = readBackupContents(baseDir, func(content backupContent) error {
+		got = append(got, content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readBackupContents() error = %v", err)
+	}
+	want := []backupContent{{Endpoint: "blogs", Status: "PUBLISH", Id: "a", Fields: []backupField{{"id", "a"}, {"title", "x;y"}}, Raw: `{"id":"a","title":"x;y"}`, FromCSV: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readBackupContents() = %v, want %v", got, want)
+	}
+}
+
+func TestCSVConfigValidate(t *testing.T) {
+	tests := []struct {
+		config  CSVConfig
+		wantErr bool
+	}{
+		{config: CSVConfig{Delimiter: ""}, wantErr: false},
+		{config: CSVConfig{Delimiter: "\t"}, wantErr: false},
+		{config: CSVConfig{Delimiter: "、"}, wantErr: false},
+		{config: CSVConfig{Delimiter: ",,"}, wantErr: true},
+		{config: CSVConfig{Columns: map[string][]string{"blogs": {"id", "title"}}}, wantErr: false},
+		// idがないとバックアップを読み込めない
+		{config: CSVConfig{Columns: map[string][]string{"blogs": {"title"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := tt.config.validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteContentsCSVFlatten(t *testing.T) {
+	contents := []gjson.Result{
+		gjson.Parse(`{"id":"a","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z","name":"ニュース"},"eyecatch":{"url":"https://images.microcms-assets.io/a.png","width":100},"tags":["x","y"],"repeater":[{"fieldId":"text","text":"本文"}]}`),
+		gjson.Parse(`{"id":"b","category":null,"eyecatch":{"url":"https://images.microcms-assets.io/b.png","width":200},"tags":["x","y","z"],"repeater":[]}`),
+	}
+	metaData := []gjson.Result{
+		gjson.Parse(`{"status":["PUBLISH"]}`),
+		gjson.Parse(`{"status":["DRAFT"]}`),
+	}
+	orderedKeys := []string{"id", "category", "eyecatch", "tags", "repeater"}
+
+	tests := []struct {
+		name   string
+		layout csvLayout
+		want   string
+	}{
+		{
+			name:   "配列をインデックス付きのカラムに展開",
+			layout: csvLayout{config: CSVConfig{Flatten: true}, relations: map[string]bool{"category": true}},
+			// nullのコンテンツ参照や空の配列は、展開したカラムの空欄となる
+			want: "id,category.id,eyecatch.url,eyecatch.width,tags[0],tags[1],tags[2],repeater[0].fieldId,repeater[0].text,_meta.status[0]\n" +
+				"a,cat1,https://images.microcms-assets.io/a.png,100,x,y,,text,本文,PUBLISH\n" +
+				"b,,https://images.microcms-assets.io/b.png,200,x,y,z,,,DRAFT\n",
+		},
+		{
+			name:   "最大要素数と連結",
+			layout: csvLayout{config: CSVConfig{Flatten: true, MaxArrayWidth: 1, ArrayJoin: "|"}, displayNames: map[string]string{"eyecatch": "アイキャッチ"}, relations: map[string]bool{"category": true}},
+			want: "id,category.id,アイキャッチ.url,アイキャッチ.width,tags,repeater[0].fieldId,repeater[0].text,_meta.status\n" +
+				"a,cat1,https://images.microcms-assets.io/a.png,100,x|y,text,本文,PUBLISH\n" +
+				"b,,https://images.microcms-assets.io/b.png,200,x|y|z,,,DRAFT\n",
+		},
+		{
+			// APIスキーマがない場合は、コンテンツ参照も通常のオブジェクトとして展開する
+			name:   "APIスキーマなし",
+			layout: csvLayout{config: CSVConfig{Flatten: true, ArrayJoin: "|"}},
+			want: "id,category.id,category.createdAt,category.name,eyecatch.url,eyecatch.width,tags,repeater[0].fieldId,repeater[0].text,_meta.status\n" +
+				"a,cat1,2024-01-01T00:00:00.000Z,ニュース,https://images.microcms-assets.io/a.png,100,x|y,text,本文,PUBLISH\n" +
+				"b,,,,https://images.microcms-assets.io/b.png,200,x|y|z,,,DRAFT\n",
+		},
+		{
+			// 展開前のフィールドIDを指定すると、展開したカラムをすべて書き出す
+			name:   "カラムの指定",
+			layout: csvLayout{config: CSVConfig{Flatten: true}, columns: []string{"id", "eyecatch", "tags[1]", "category", "unknown"}, relations: map[string]bool{"category": true}},
+			want: "id,eyecatch.url,eyecatch.width,tags[1],category.id,unknown\n" +
+				"a,https://images.microcms-assets.io/a.png,100,y,cat1,\n" +
+				"b,https://images.microcms-assets.io/b.png,200,y,,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/contents.csv"
+			err := writeContentsCSV(path, tt.layout, orderedKeys, contents, []string{"status"}, metaData)
+			if err != nil {
+				t.Fatalf("writeContentsCSV() error = %v", err)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("writeContentsCSV() = %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
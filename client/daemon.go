@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DaemonStatus はdaemonの状態
+type DaemonStatus struct {
+	Schedule string `json:"schedule"`
+	// バックアップを実行中かどうか
+	Running bool       `json:"running"`
+	NextRun *time.Time `json:"nextRun"`
+	// 前回のバックアップが終わっていなかったため、実行しなかった回数
+	SkippedRuns int        `json:"skippedRuns"`
+	LastRun     *DaemonRun `json:"lastRun"`
+}
+
+// DaemonRun は1回のバックアップの結果
+type DaemonRun struct {
+	BackupDir  string    `json:"backupDir"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	// 保持の設定により削除したバックアップ
+	RemovedBackups []string `json:"removedBackups,omitempty"`
+}
+
+// daemon はスケジュールに従ってバックアップを実行し、状態を/statusで返す
+type daemon struct {
+	client   Client
+	schedule schedule
+	// バックアップディレクトリを作成するディレクトリ
+	rootDir string
+	now     func() time.Time
+
+	mu     sync.Mutex
+	status DaemonStatus
+	wg     sync.WaitGroup
+}
+
+func newDaemon(c Client, rootDir string) (*daemon, error) {
+	if c.Config.Daemon.Schedule == "" {
+		return nil, errors.New("daemon.scheduleで実行日時を指定してください")
+	}
+	s, err := parseSchedule(c.Config.Daemon.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &daemon{
+		client:   c,
+		schedule: s,
+		rootDir:  rootDir,
+		now:      time.Now,
+		status:   DaemonStatus{Schedule: c.Config.Daemon.Schedule},
+	}, nil
+}
+
+// RunDaemon はスケジュールに従ってバックアップを実行し続け、addrで状態を返す
+// 前回のバックアップが終わっていない場合は、その回は実行しない
+// ctxがキャンセルされると、実行中のバックアップを中断して終了する
+func (c Client) RunDaemon(ctx context.Context, addr string) error {
+	d, err := newDaemon(c, c.backupRootDir())
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: addr, Handler: d}
+	serveErr := make(chan error, 1)
+	go func() {
+		err := srv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	log.Printf("http://%s/status で状態を確認できます\n", addr)
+
+	// 実行中のバックアップは、ctxのキャンセルにより中断される
+	defer d.wg.Wait()
+	for {
+		next := d.schedule.next(d.now())
+		if next.IsZero() {
+			return fmt.Errorf("スケジュールに一致する日時がありません: %s", c.Config.Daemon.Schedule)
+		}
+		d.setNextRun(next)
+		log.Printf("次回のバックアップは%sに実行します\n", next.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("daemonを終了します")
+			return nil
+		case err := <-serveErr:
+			timer.Stop()
+			return err
+		case <-timer.C:
+			d.start(ctx)
+		}
+	}
+}
+
+// start はバックアップを別のgoroutineで開始する
+// 前回のバックアップが実行中の場合は開始せずにfalseを返す
+func (d *daemon) start(ctx context.Context) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status.Running {
+		d.status.SkippedRuns++
+		log.Println("前回のバックアップが実行中のため、今回のバックアップは実行しません")
+		return false
+	}
+	d.status.Running = true
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		run := d.run(ctx)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.status.Running = false
+		d.status.LastRun = &run
+	}()
+	return true
+}
+
+// run はバックアップを1回実行し、成功した場合は保持の設定を超えた古いバックアップを削除する
+// 前回のバックアップが中断・失敗して再開できる場合は、同じディレクトリで再開する
+func (d *daemon) run(ctx context.Context) DaemonRun {
+	startedAt := d.now()
+	baseDir := d.rootDir + startedAt.Format(backupDirTimeFormat) + "/"
+	d.mu.Lock()
+	if last := d.status.LastRun; last != nil && !last.Success && d.client.CanResume(last.BackupDir) {
+		baseDir = last.BackupDir
+	}
+	d.mu.Unlock()
+	run := DaemonRun{BackupDir: baseDir, StartedAt: startedAt}
+
+	err := d.backup(ctx, baseDir)
+	if err == nil {
+		run.RemovedBackups, err = applyRetention(d.rootDir, d.client.Config.Daemon.Retention, startedAt)
+		if err != nil {
+			err = fmt.Errorf("古いバックアップの削除でエラーが発生しました: %w", err)
+		}
+	}
+	run.FinishedAt = d.now()
+	run.Success = err == nil
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("バックアップに失敗しました: %v\n", err)
+	}
+	return run
+}
+
+func (d *daemon) backup(ctx context.Context, baseDir string) error {
+	if !d.client.CanResume(baseDir) {
+		err := os.MkdirAll(baseDir, os.ModePerm)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Printf("%sのバックアップを再開します\n", baseDir)
+	}
+	return d.client.StartBackup(ctx, baseDir)
+}
+
+func (d *daemon) setNextRun(next time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.NextRun = &next
+}
+
+// ServeHTTP は/statusでdaemonの状態をJSONで返す
+func (d *daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/status" {
+		writeServeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeServeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	d.mu.Lock()
+	b, err := json.Marshal(d.status)
+	d.mu.Unlock()
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeServeJSON(w, b)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
+)
+
+func TestDaemon(t *testing.T) {
+	keys := testMockKeys()
+	server := mockcms.NewServer(testMockFixture())
+	defer server.Close()
+
+	client := newMockClient(server, &Config{
+		Target: "contents",
+		Contents: ContentsConfig{
+			GetPublishContentsAPIKey: keys.Publish,
+			Endpoints:                []Endpoint{{Name: "blogs"}},
+			RequestUnit:              10,
+		},
+		Daemon: DaemonConfig{
+			Schedule:  "0 3 * * *",
+			Retention: RetentionConfig{Keep: 1},
+		},
+	})
+	rootDir := t.TempDir() + "/"
+	d, err := newDaemon(*client, rootDir)
+	if err != nil {
+		t.Fatalf("newDaemon() error = %v", err)
+	}
+
+	// 1回目と2回目で別のディレクトリに保存されるよう、日時を進める
+	now := time.Date(2024, 1, 1, 3, 0, 0, 0, time.Local)
+	d.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if !d.start(context.Background()) {
+			t.Fatalf("%d回目のバックアップが開始されませんでした", i+1)
+		}
+		d.wg.Wait()
+		now = now.AddDate(0, 0, 1)
+	}
+
+	last := d.status.LastRun
+	if last == nil || !last.Success {
+		t.Fatalf("LastRun = %+v", last)
+	}
+	if want := rootDir + "2024_01_02_03_00_00/"; last.BackupDir != want || !IsCompleteBackup(last.BackupDir) {
+		t.Errorf("BackupDir = %s, want %s", last.BackupDir, want)
+	}
+	// 保持の設定により1回目のバックアップは削除される
+	if want := rootDir + "2024_01_01_03_00_00/"; len(last.RemovedBackups) != 1 || last.RemovedBackups[0] != want {
+		t.Errorf("RemovedBackups = %v, want [%s]", last.RemovedBackups, want)
+	}
+	if _, err := os.Stat(rootDir + "2024_01_01_03_00_00"); !os.IsNotExist(err) {
+		t.Errorf("1回目のバックアップが削除されていません: %v", err)
+	}
+
+	// 実行中の場合は開始しない
+	d.status.Running = true
+	if d.start(context.Background()) {
+		t.Errorf("実行中にバックアップが開始されました")
+	}
+	d.status.Running = false
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{method: http.MethodGet, path: "/status", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/status", wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			d.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var status DaemonStatus
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Schedule != "0 3 * * *" || status.Running || status.SkippedRuns != 1 || status.LastRun == nil || !status.LastRun.Success {
+				t.Errorf("status = %+v", status)
+			}
+		})
+	}
+}
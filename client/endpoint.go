@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalJSON はエンドポイント名のみの文字列と、クエリパラメータを含むオブジェクトのどちらも受け付ける
+func (e *Endpoint) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*e = Endpoint{}
+		return json.Unmarshal(b, &e.Name)
+	}
+
+	// 設定ファイルと同様に、未知のフィールドはエラーとする
+	type endpoint Endpoint
+	var v endpoint
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	*e = Endpoint(v)
+	return nil
+}
+
+// listQuery は一覧取得のリクエストに付与するクエリパラメータを返す
+func (e Endpoint) listQuery(limit, offset int) string {
+	v := e.detailValues()
+	v.Set("limit", strconv.Itoa(limit))
+	v.Set("offset", strconv.Itoa(offset))
+	if e.Filters != "" {
+		v.Set("filters", e.Filters)
+	}
+	if e.Orders != "" {
+		v.Set("orders", e.Orders)
+	}
+	if e.Q != "" {
+		v.Set("q", e.Q)
+	}
+	return v.Encode()
+}
+
+// detailQuery は個別取得のリクエストに付与するクエリパラメータを返す
+// 個別取得では絞り込みや並び替えは指定できないため、fieldsとdepthのみを付与する
+func (e Endpoint) detailQuery() string {
+	return e.detailValues().Encode()
+}
+
+func (e Endpoint) detailValues() url.Values {
+	v := url.Values{}
+	if e.Fields != "" {
+		// ステータスの判定などでコンテンツIDを使うため、必ず取得する
+		fields := strings.Split(e.Fields, ",")
+		if !slices.Contains(fields, "id") {
+			fields = append(fields, "id")
+		}
+		v.Set("fields", strings.Join(fields, ","))
+	}
+	if e.Depth != nil {
+		v.Set("depth", strconv.Itoa(*e.Depth))
+	}
+	return v
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestEndpointQuery(t *testing.T) {
+	depth := func(n int) *int { return &n }
+	tests := []struct {
+		name       string
+		endpoint   Endpoint
+		wantList   string
+		wantDetail string
+	}{
+		{
+			name:       "パラメータなし",
+			endpoint:   Endpoint{Name: "test"},
+			wantList:   "limit=10&offset=20",
+			wantDetail: "",
+		},
+		{
+			name:       "すべてのパラメータ",
+			endpoint:   Endpoint{Name: "test", Filters: "category[equals]news", Fields: "title,id", Orders: "-publishedAt", Depth: depth(2), Q: "検索"},
+			wantList:   "depth=2&fields=title%2Cid&filters=category%5Bequals%5Dnews&limit=10&offset=20&orders=-publishedAt&q=%E6%A4%9C%E7%B4%A2",
+			wantDetail: "depth=2&fields=title%2Cid",
+		},
+		{
+			name:       "depthの0は指定する",
+			endpoint:   Endpoint{Name: "test", Depth: depth(0)},
+			wantList:   "depth=0&limit=10&offset=20",
+			wantDetail: "depth=0",
+		},
+		{
+			name:       "fieldsにidを含まない場合は追加する",
+			endpoint:   Endpoint{Name: "test", Fields: "title"},
+			wantList:   "fields=title%2Cid&limit=10&offset=20",
+			wantDetail: "fields=title%2Cid",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.endpoint.listQuery(10, 20); got != tt.wantList {
+				t.Errorf("listQuery() = %v, want %v", got, tt.wantList)
+			}
+			if got := tt.endpoint.detailQuery(); got != tt.wantDetail {
+				t.Errorf("detailQuery() = %v, want %v", got, tt.wantDetail)
+			}
+		})
+	}
+}
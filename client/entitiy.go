@@ -22,6 +22,21 @@ type Media struct {
 	Url    string `json:"url"`
 	Width  int    `json:"width"`
 	Height int    `json:"height"`
+	// 上記以外にAPIが返した属性(代替テキストや説明など)
+	Attributes map[string]json.RawMessage `json:"-"`
+}
+
+// MediaIndexEntry はメディア一覧(media/index.json, media/index.csv)の1件分の情報を保持する構造体
+type MediaIndexEntry struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
+	// バックアップディレクトリからの相対パス
+	LocalPath   string                     `json:"localPath"`
+	Width       int                        `json:"width"`
+	Height      int                        `json:"height"`
+	Size        int64                      `json:"size"`
+	ContentType string                     `json:"contentType"`
+	Attributes  map[string]json.RawMessage `json:"attributes,omitempty"`
 }
 
 // ContentsConfig はコンテンツバックアップの設定を保持する構造体
@@ -31,17 +46,136 @@ type ContentsConfig struct {
 	// 全ステータスのコンテンツを取得するためのAPIキー（classifyByStatusがtrueの場合に必要）
 	GetAllStatusContentsAPIKey string `json:"getAllStatusContentsAPIKey"`
 	// コンテンツのメタデータを取得するためのAPIキー（classifyByStatusがtrueの場合に必要）
-	GetContentsMetaDataAPIKey string   `json:"getContentsMetaDataAPIKey"`
-	Endpoints                 []string `json:"endpoints"`
-	RequestUnit               int      `json:"requestUnit"`
-	ClassifyByStatus          bool     `json:"classifyByStatus"`
+	GetContentsMetaDataAPIKey string `json:"getContentsMetaDataAPIKey"`
+	// コンテンツ更新用のAPIキー（import-csvで反映する場合に必要）
+	UpdateAPIKey string `json:"updateAPIKey"`
+	// エンドポイント名の文字列か、クエリパラメータを含むオブジェクトで指定する
+	Endpoints        []Endpoint `json:"endpoints"`
+	RequestUnit      int        `json:"requestUnit"`
+	ClassifyByStatus bool       `json:"classifyByStatus"`
 	// CSVファイルとして保存するかどうか
 	SaveAsCSV bool `json:"saveAsCSV"`
+	// コンテンツの保存形式("json", "csv", "ndjson")
+	// 省略した場合はsaveAsCSVに従う
+	Format string `json:"format"`
+	// NDJSON形式の場合に、gzip圧縮して保存するかどうか
+	Gzip bool `json:"gzip"`
+	// CSV形式の場合の書き出し方
+	CSV CSVConfig `json:"csv"`
+	// XLSX形式の場合の書き出し方
+	XLSX XLSXConfig `json:"xlsx"`
+	// マネジメントAPIから取得したメタデータ(ステータス履歴、作成者・更新者、予約日時など)を保存するかどうか
+	// classifyByStatusがtrueの場合のみ有効
+	SaveMetaData bool `json:"saveMetaData"`
+	// メディアURLをmedia/以下のローカルの相対パスに書き換えた複製をportable/以下に保存するかどうか
+	// targetがallの場合のみ有効
+	SavePortableCopy bool `json:"savePortableCopy"`
+	// エンドポイントをまたいだコンテンツの参照関係をgraph/以下に保存するかどうか
+	SaveReferenceGraph bool `json:"saveReferenceGraph"`
+	// コンテンツ参照の保存形式
+	// "expanded"(省略時): APIが返した展開済みの内容のまま保存する
+	// "id": コンテンツ参照をIDの文字列(複数コンテンツ参照はIDの配列)に置き換えて保存する
+	// "both": IDに置き換えたものに加えて、展開済みの内容をN.expanded.json(contents.expanded.csv)に保存する
+	Relations string `json:"relations"`
+	// 開発・検証環境向けに、フィールドの値を加工(削除・ハッシュ化・ダミー値への置き換え・切り詰め)して保存する設定
+	Redaction RedactionConfig `json:"redaction"`
+}
+
+// RedactionConfig はフィールドの値を加工して保存する設定
+type RedactionConfig struct {
+	// エンドポイントごとの加工のルール
+	Rules map[string][]RedactionRule `json:"rules"`
+	// 加工したコンテンツの保存方法
+	// "instead"(省略時): 加工したコンテンツのみを保存する
+	// "alongside": 元のコンテンツに加えて、加工したコンテンツをredacted/以下に保存する
+	Mode string `json:"mode"`
+	// hash・fakeで値を置き換える際の秘密の値(同じ値は同じ値に置き換わる)
+	Salt string `json:"salt"`
+}
+
+// RedactionRule はフィールドの値の加工方法
+type RedactionRule struct {
+	// フィールドID(カスタムフィールドや繰り返しフィールドの中は"."で区切って指定する)
+	Field string `json:"field"`
+	// "drop": フィールドを削除する
+	// "hash": 値のハッシュ値に置き換える
+	// "fake": ダミー値に置き換える
+	// "truncate": 文字列をlength文字に切り詰める
+	Action string `json:"action"`
+	// fakeで置き換える値の種類("text"(省略時), "name", "email", "phone")
+	Fake string `json:"fake"`
+	// truncateで残す文字数
+	Length int `json:"length"`
+}
+
+// Endpoint はバックアップするエンドポイントと、コンテンツAPIのリクエストに付与するクエリパラメータを保持する構造体
+// 各パラメータはコンテンツAPIの同名のパラメータとしてそのまま渡される
+type Endpoint struct {
+	Name    string `json:"name"`
+	Filters string `json:"filters"`
+	// カンマ区切りで指定する
+	Fields string `json:"fields"`
+	Orders string `json:"orders"`
+	// 省略した場合は指定しない(APIのデフォルト値となる)
+	// 0を指定するとコンテンツ参照を展開しない
+	Depth *int   `json:"depth"`
+	Q     string `json:"q"`
+}
+
+// CSVConfig はCSVファイルの書き出し方の設定
+type CSVConfig struct {
+	// 先頭にUTF-8のBOMを付けるかどうか(Excelで文字化けしないようにする)
+	BOM bool `json:"bom"`
+	// 区切り文字(省略時は",")
+	Delimiter string `json:"delimiter"`
+	// 改行コードをCRLFにするかどうか
+	CRLF bool `json:"crlf"`
+	// エンドポイントごとに、書き出すカラムとその順序
+	// 指定しないエンドポイントはすべてのカラムを書き出す
+	Columns map[string][]string `json:"columns"`
+	// ヘッダー行にAPIスキーマの表示名を使うかどうか
+	// APIスキーマの取得にはgetContentsMetaDataAPIKeyを使用する
+	DisplayNames bool `json:"displayNames"`
+	// オブジェクトや配列を複数のカラムに展開するかどうか
+	// オブジェクトは"category.name"、コンテンツ参照は"category.id"、配列は"tags[0]"のようなカラムとなる
+	Flatten bool `json:"flatten"`
+	// 展開する配列の最大要素数(0の場合は制限しない)
+	MaxArrayWidth int `json:"maxArrayWidth"`
+	// 指定した場合、値のみの配列(複数選択など)は展開せずに、この区切り文字で連結して1つのカラムに書き出す
+	ArrayJoin string `json:"arrayJoin"`
+}
+
+// XLSXConfig はXLSXファイルの書き出し方の設定
+type XLSXConfig struct {
+	// 日時を書き込む際のタイムゾーン(IANAのタイムゾーン名。省略時はUTC)
+	TimeZone string `json:"timeZone"`
 }
 
 // MediaConfig はメディアバックアップの設定を保持する構造体
 type MediaConfig struct {
 	APIKey string `json:"apiKey"`
+	// メディアのリストアでアップロードするためのAPIキー
+	UploadAPIKey string `json:"uploadAPIKey"`
+	// バックアップするメディアの範囲
+	// "all"(省略時): メディアライブラリのすべてのメディア
+	// "referenced": バックアップしたコンテンツから参照されているメディアのみ(targetがallの場合のみ有効)
+	Scope string `json:"scope"`
+	// 参照されていないメディアと、存在しないメディアへの参照のレポートを保存するかどうか
+	// targetがallの場合のみ有効
+	SaveReferenceReport bool `json:"saveReferenceReport"`
+}
+
+// MigrateConfig はコンテンツとメディアの移行先のサービスの設定
+type MigrateConfig struct {
+	ServiceID string `json:"serviceId"`
+	// 移行先のAPIスキーマの取得に使用するAPIキー
+	GetContentsMetaDataAPIKey string `json:"getContentsMetaDataAPIKey"`
+	// 移行先のコンテンツの作成・更新(PUT・PATCH)の権限を持つAPIキー
+	WriteAPIKey string `json:"writeAPIKey"`
+	// 移行先へのメディアのアップロードの権限を持つAPIキー
+	UploadAPIKey string `json:"uploadAPIKey"`
+	// 移行元と移行先でエンドポイント名が異なる場合の対応(省略時は同じ名前)
+	Endpoints map[string]string `json:"endpoints"`
 }
 
 type Config struct {
@@ -49,8 +183,108 @@ type Config struct {
 	ServiceID string         `json:"serviceId"`
 	Contents  ContentsConfig `json:"contents"`
 	Media     MediaConfig    `json:"media"`
+	// バックアップの終了後に、全体を1つのSQLiteのデータベース(backup.sqlite)に書き出すかどうか
+	SaveSQLite bool `json:"saveSQLite"`
+	// migrateで書き込む移行先のサービス
+	Migrate MigrateConfig `json:"migrate"`
+	// daemonで定期的にバックアップする設定
+	Daemon DaemonConfig `json:"daemon"`
+	// listenでWebhookを受け取る設定
+	Listen ListenConfig `json:"listen"`
+	// バックアップの終了時に結果を通知する設定
+	Notify NotifyConfig `json:"notify"`
+}
+
+// NotifyConfig はバックアップの終了時に結果を通知する設定
+type NotifyConfig struct {
+	// 失敗した場合のみ通知するかどうか
+	OnlyFailure bool `json:"onlyFailure"`
+	// 結果を送信するWebhook
+	Webhooks []NotifyWebhook `json:"webhooks"`
+	// 結果を送信するメール(hostを指定した場合のみ送信する)
+	Email NotifyEmail `json:"email"`
+}
+
+// NotifyWebhook は結果を送信するWebhook
+type NotifyWebhook struct {
+	URL string `json:"url"`
+	// 送信する形式
+	// "json"(省略時): 結果をJSONでそのまま送信する
+	// "slack": Slack互換のIncoming Webhookの形式({"text": ...})で送信する
+	Format string `json:"format"`
+	// リクエストに付与するヘッダー(認証用のトークンなど)
+	Headers map[string]string `json:"headers"`
+}
+
+// NotifyEmail は結果を送信するメール(SMTP)の設定
+type NotifyEmail struct {
+	Host string `json:"host"`
+	// 省略時は587
+	Port int `json:"port"`
+	// 指定した場合はPLAIN認証を行う
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// ListenConfig はlistenでWebhookを受け取る設定
+type ListenConfig struct {
+	// Webhookの署名の検証に使うシークレット(microCMSのWebhookの設定で指定したもの)
+	Secret string `json:"secret"`
+}
+
+// DaemonConfig はdaemonで定期的にバックアップする設定
+type DaemonConfig struct {
+	// cron形式(分 時 日 月 曜日)の実行日時("0 3 * * *"など)
+	Schedule string `json:"schedule"`
+	// バックアップの終了後に削除する古いバックアップ
+	Retention RetentionConfig `json:"retention"`
+}
+
+// RetentionConfig は古いバックアップを削除する設定
+// いずれも0の場合は削除しない
+type RetentionConfig struct {
+	// 残す完了したバックアップの数
+	Keep int `json:"keep"`
+	// 完了したバックアップを残す日数
+	MaxAgeDays int `json:"maxAgeDays"`
+}
+
+// Checkpoint は中断されたバックアップを再開するための進捗状況を保持する構造体
+type Checkpoint struct {
+	// 保存が完了したエンドポイント
+	CompletedEndpoints []string `json:"completedEndpoints"`
+	// 処理中のエンドポイントと、保存済みの次のオフセット
+	// (ページ単位でファイルを書き込むJSON形式・ステータス分類なしの場合のみ記録される)
+	CurrentEndpoint string `json:"currentEndpoint"`
+	Offset          int    `json:"offset"`
+	// 取得済みのメディア一覧と、次のページを取得するためのトークン
+	MediaList          []Media `json:"mediaList"`
+	MediaToken         string  `json:"mediaToken"`
+	MediaListCompleted bool    `json:"mediaListCompleted"`
+	// ダウンロードが完了したメディアのID(コンテンツから参照されているメディアの場合はURL)
+	DownloadedMediaIDs []string `json:"downloadedMediaIds"`
+	// ダウンロードしたメディアのレスポンスのContent-Type(再開時にメディア一覧に記録するため)
+	MediaContentTypes map[string]string `json:"mediaContentTypes,omitempty"`
+
+	path       string
+	downloaded map[string]bool
 }
 
 type Client struct {
 	Config *Config
+
+	// コンテンツAPIとマネジメントAPIのベースURL(末尾の/v1などを除く)
+	// 空の場合はサービスIDから組み立てる。テストでモックサーバーに向ける場合などに指定する
+	ContentsAPIBaseURL   string
+	ManagementAPIBaseURL string
+
+	checkpoint *Checkpoint
+	// XLSX形式の場合に、コンテンツを保存するワークブック
+	workbook *contentsWorkbook
+	// コンテンツ参照をIDで保存する場合に、置き換えたフィールドのパスを記録する
+	relationFields *relationFieldsRecorder
+	// 展開されたコンテンツ参照を加工する場合に、参照先のエンドポイントを引くためのコンテンツID
+	redactionTargets redactionTargets
 }
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 正常に終了したバックアップディレクトリに書き込む印のファイル名
+const completeMarkerFileName = "COMPLETE"
+
+// 書き込み途中の一時ファイルに付与する接頭辞
+const tempFilePrefix = ".tmp-"
+
+// writeFileAtomic は同じディレクトリの一時ファイルに書き込んだ後、リネームして保存する
+// 途中で中断・失敗した場合でも、書きかけのファイルが保存先に残らない
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	// リネームした後は一時ファイルが存在しないため、削除は失敗しても問題ない
+	defer os.Remove(tmp.Name())
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeStringAtomic は文字列をファイルにアトミックに書き込む
+func writeStringAtomic(path string, data string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, data)
+		return err
+	})
+}
+
+// removeTempFiles は前回の実行で残った書き込み途中の一時ファイルを削除する
+func removeTempFiles(baseDir string) error {
+	err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// writeCompleteMarker はバックアップが正常に終了したことを示す印を書き込む
+func writeCompleteMarker(baseDir string) error {
+	return writeStringAtomic(baseDir+completeMarkerFileName, time.Now().Format(time.RFC3339)+"\n")
+}
+
+// IsCompleteBackup はバックアップディレクトリが正常に終了したものかどうかを返す
+// 一覧表示や世代管理、差分バックアップなどでは、この印があるディレクトリのみを対象とする
+func IsCompleteBackup(baseDir string) bool {
+	if !strings.HasSuffix(baseDir, "/") {
+		baseDir += "/"
+	}
+	_, err := os.Stat(baseDir + completeMarkerFileName)
+	return err == nil
+}
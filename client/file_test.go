@@ -0,0 +1,82 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/test.json"
+
+	if err := writeStringAtomic(path, "old"); err != nil {
+		t.Fatalf("writeStringAtomic() error = %v", err)
+	}
+
+	// 書き込みに失敗した場合は、既存のファイルが変更されず一時ファイルも残らない
+	wantErr := errors.New("write failed")
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		if _, err := io.WriteString(w, "new"); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("writeFileAtomic() error = %v, want %v", err, wantErr)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(b) != "old" {
+		t.Errorf("ファイルの内容 = %q, want %q", string(b), "old")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("ディレクトリのファイル数 = %d, want %d", len(entries), 1)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"media/abc", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	tmpPath := baseDir + "media/abc/" + tempFilePrefix + "image.png-123"
+	keepPath := baseDir + "media/abc/image.png"
+	for _, path := range []string{tmpPath, keepPath} {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeTempFiles(baseDir); err != nil {
+		t.Fatalf("removeTempFiles() error = %v", err)
+	}
+	if _, err := os.Stat(tmpPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("一時ファイルが削除されていません")
+	}
+	if _, err := os.Stat(keepPath); err != nil {
+		t.Errorf("一時ファイル以外が削除されました: %v", err)
+	}
+}
+
+func TestCompleteMarker(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if IsCompleteBackup(baseDir) {
+		t.Fatalf("IsCompleteBackup() = true, want false")
+	}
+	if err := writeCompleteMarker(baseDir); err != nil {
+		t.Fatalf("writeCompleteMarker() error = %v", err)
+	}
+	if !IsCompleteBackup(baseDir) {
+		t.Errorf("IsCompleteBackup() = false, want true")
+	}
+}
@@ -1,17 +1,43 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"time"
 )
 
+// contentsAPIURL はコンテンツAPIのベースURLを返す
+func (c Client) contentsAPIURL() string {
+	if c.ContentsAPIBaseURL != "" {
+		return c.ContentsAPIBaseURL
+	}
+	return fmt.Sprintf("https://%s.microcms.io/api", c.Config.ServiceID)
+}
+
+// managementAPIURL はマネジメントAPIのベースURLを返す
+func (c Client) managementAPIURL() string {
+	if c.ManagementAPIBaseURL != "" {
+		return c.ManagementAPIBaseURL
+	}
+	return fmt.Sprintf("https://%s.microcms-management.io/api", c.Config.ServiceID)
+}
+
+// バックアップディレクトリ名の日時の形式
+const backupDirTimeFormat = "2006_01_02_15_04_05"
+
+// backupRootDir はサービスのバックアップディレクトリを作成するディレクトリを返す
+func (c Client) backupRootDir() string {
+	return "backup/" + c.Config.ServiceID + "/"
+}
+
 func (c Client) MakeBackupDir() (string, error) {
 	// バックアップのディレクトリ作成
 	t := time.Now()
-	timeDir := t.Format("2006_01_02_15_04_05")
-	baseDir := "backup/" + c.Config.ServiceID + "/" + timeDir + "/"
+	timeDir := t.Format(backupDirTimeFormat)
+	baseDir := c.backupRootDir() + timeDir + "/"
 
 	err := os.MkdirAll(baseDir, os.ModePerm)
 	if err != nil {
@@ -21,32 +47,164 @@ func (c Client) MakeBackupDir() (string, error) {
 	return baseDir, nil
 }
 
-func (c Client) StartBackup(baseDir string) error {
+// 中断・失敗したバックアップディレクトリに書き込む印のファイル名
+const incompleteMarkerFileName = "INCOMPLETE"
+
+// StartBackup はバックアップを実行し、終了後に設定された通知先へ結果を送信する
+func (c Client) StartBackup(ctx context.Context, baseDir string) error {
+	if err := c.Config.Notify.validate(); err != nil {
+		return err
+	}
+
+	startedAt := time.Now()
+	err := c.runBackup(ctx, baseDir)
+	c.notify(ctx, c.newBackupReport(baseDir, startedAt, time.Now(), err))
+	return err
+}
+
+func (c Client) runBackup(ctx context.Context, baseDir string) error {
 	log.Println("バックアップを開始します")
 
+	// 中断されたバックアップの場合は、チェックポイントから再開する
+	checkpoint, err := LoadCheckpoint(baseDir)
+	if err != nil {
+		return err
+	}
+	c.checkpoint = checkpoint
+
+	// 前回の実行で書き込まれた未完了の印と、書き込み途中の一時ファイルを取り除く
+	err = os.Remove(baseDir + incompleteMarkerFileName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = removeTempFiles(baseDir)
+	if err != nil {
+		return err
+	}
+
+	err = c.backupTarget(ctx, baseDir)
+	if err != nil {
+		// 一定件数ごとにしか保存していないメディアの進捗も、再開できるように保存する
+		if saveErr := c.checkpoint.save(); saveErr != nil {
+			log.Printf("チェックポイントの保存に失敗しました: %v", saveErr)
+		}
+		// 中断・失敗したディレクトリであることが分かるように印を残す
+		markErr := writeStringAtomic(baseDir+incompleteMarkerFileName, err.Error()+"\n")
+		if markErr != nil {
+			log.Printf("未完了の印の書き込みに失敗しました: %v", markErr)
+		}
+		if errors.Is(err, context.Canceled) {
+			log.Println("バックアップが中断されました")
+		}
+		return err
+	}
+
+	err = c.checkpoint.remove()
+	if err != nil {
+		return fmt.Errorf("チェックポイントの削除に失敗しました: %w", err)
+	}
+	// すべての処理が終わった後にのみ、完了の印を書き込む
+	err = writeCompleteMarker(baseDir)
+	if err != nil {
+		return fmt.Errorf("完了の印の書き込みに失敗しました: %w", err)
+	}
+	log.Println("正常にバックアップが終了しました")
+	return nil
+}
+
+func (c Client) backupTarget(ctx context.Context, baseDir string) error {
 	switch c.Config.Target {
 	case "all":
-		err := c.BackupContents(baseDir)
+		err := c.BackupContents(ctx, baseDir)
+		if err != nil {
+			return err
+		}
+		err = c.analyzeContents(ctx, baseDir)
 		if err != nil {
 			return err
 		}
-		err = c.BackupMedia(baseDir)
+		err = c.BackupMedia(ctx, baseDir)
 		if err != nil {
 			return err
 		}
+		if c.Config.Media.SaveReferenceReport {
+			// 参照されているメディアのみを取得した場合は、突き合わせる意味がないため作成しない
+			if c.Config.Media.Scope == "referenced" {
+				log.Println("メディアの範囲がreferencedのため、メディアの参照レポートは作成しません")
+			} else {
+				err = writeMediaReferenceReport(baseDir)
+				if err != nil {
+					return fmt.Errorf("メディアの参照レポートの作成でエラーが発生しました: %w", err)
+				}
+			}
+		}
+		if c.Config.Contents.SavePortableCopy {
+			err = savePortableContents(baseDir)
+			if err != nil {
+				return fmt.Errorf("ローカルのメディアを参照するコンテンツの複製でエラーが発生しました: %w", err)
+			}
+		}
 	case "contents":
-		err := c.BackupContents(baseDir)
+		err := c.BackupContents(ctx, baseDir)
+		if err != nil {
+			return err
+		}
+		err = c.analyzeContents(ctx, baseDir)
 		if err != nil {
 			return err
 		}
 	case "media":
-		err := c.BackupMedia(baseDir)
+		err := c.BackupMedia(ctx, baseDir)
 		if err != nil {
 			return err
 		}
 	default:
 		return fmt.Errorf("不明なターゲットが選択されました")
 	}
-	log.Println("正常にバックアップが終了しました")
+
+	if c.Config.SaveSQLite {
+		err := exportSQLite(baseDir, baseDir+sqliteFileName)
+		if err != nil {
+			return fmt.Errorf("SQLiteへの書き出しでエラーが発生しました: %w", err)
+		}
+	}
+	return nil
+}
+
+// analyzeContents はバックアップしたコンテンツの分析結果を保存する
+func (c Client) analyzeContents(ctx context.Context, baseDir string) error {
+	if c.Config.Contents.SaveReferenceGraph {
+		err := writeReferenceGraph(baseDir, c.completeEndpoints())
+		if err != nil {
+			return fmt.Errorf("コンテンツの参照関係の作成でエラーが発生しました: %w", err)
+		}
+	}
+	if redaction := c.Config.Contents.Redaction; len(redaction.Rules) > 0 {
+		if c.redactsAlongside() {
+			err := c.saveRedactedContents(ctx, baseDir)
+			if err != nil {
+				return fmt.Errorf("加工したコンテンツの保存でエラーが発生しました: %w", err)
+			}
+		} else {
+			err := writeRedactedMarker(baseDir, redaction)
+			if err != nil {
+				return fmt.Errorf("加工したバックアップであることを示すファイルの保存でエラーが発生しました: %w", err)
+			}
+			log.Println("フィールドの値を加工したコンテンツを保存しました")
+		}
+	}
 	return nil
 }
+
+// sleep は指定した時間だけ待機する
+// 待機中にキャンセルされた場合は、その時点でエラーを返す
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
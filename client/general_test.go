@@ -1,122 +1,169 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"os"
-	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
 )
 
-func init() {
-	// Get the current working directory
-	wd, err := os.Getwd()
-	if err != nil {
-		panic("Error getting working directory")
+// testMockKeys はモックサーバーが受け付けるAPIキーを返す
+func testMockKeys() mockcms.Keys {
+	return mockcms.Keys{
+		Publish:   "publish-key",
+		AllStatus: "all-status-key",
+		MetaData:  "meta-data-key",
+		Media:     "media-key",
+		Update:    "update-key",
+		Upload:    "upload-key",
 	}
+}
 
-	// Get the project root directory (where go.mod is located)
-	projectRoot := filepath.Dir(wd)
+// testMockFixture はテストで共通して利用するサービスのデータを返す
+func testMockFixture() mockcms.Fixture {
+	return mockcms.Fixture{
+		Keys: testMockKeys(),
+		Contents: map[string][]mockcms.Content{
+			"blogs": {
+				{Status: "PUBLISH", Body: `{"id":"a","title":"公開中"}`},
+				{Status: "PUBLISH_AND_DRAFT", Body: `{"id":"b","title":"公開中の内容"}`, DraftBody: `{"id":"b","title":"下書きの内容"}`},
+				{Status: "DRAFT", Body: `{"id":"c","title":"下書き"}`},
+				{Status: "CLOSED", Body: `{"id":"d","title":"公開終了"}`},
+			},
+			"categories": {
+				{Status: "PUBLISH", Body: `{"id":"news","name":"ニュース"}`},
+			},
+		},
+		Schemas: map[string]string{
+			"blogs": `[{"fieldId":"title","name":"タイトル","kind":"text","required":true}]`,
+		},
+		Media: []mockcms.Media{
+			{Id: "m1", Path: "abc/a.png", Width: 10, Height: 20, ContentType: "image/png", Data: []byte("png")},
+			{Id: "m2", Path: "def/%E6%97%A5%E6%9C%AC%E8%AA%9E%20%E5%90%8D.txt", ContentType: "text/plain", Data: []byte("text")},
+		},
+	}
+}
 
-	// Load .env file from the project root
-	envPath := filepath.Join(projectRoot, ".env")
-	if err := godotenv.Load(envPath); err != nil {
-		panic("Error loading .env file: " + envPath)
+// newMockClient はモックサーバーにリクエストするクライアントを作成する
+func newMockClient(server *mockcms.Server, config *Config) *Client {
+	return &Client{
+		Config:               config,
+		ContentsAPIBaseURL:   server.ContentsAPIBaseURL(),
+		ManagementAPIBaseURL: server.ManagementAPIBaseURL(),
 	}
 }
 
 func TestBackupAllTargets(t *testing.T) {
-	type args struct {
-		config  *Config
-		baseDir string
+	keys := testMockKeys()
+	contents := ContentsConfig{
+		GetPublishContentsAPIKey:   keys.Publish,
+		GetAllStatusContentsAPIKey: keys.AllStatus,
+		GetContentsMetaDataAPIKey:  keys.MetaData,
+		Endpoints:                  []Endpoint{{Name: "blogs"}, {Name: "categories"}},
+		RequestUnit:                10,
+		ClassifyByStatus:           true,
+		SaveAsCSV:                  true,
 	}
-
-	publishAPIKey := os.Getenv("PUBLISH_API_KEY")
-	allStatusAPIKey := os.Getenv("ALL_STATUS_API_KEY")
-	metaDataAPIKey := os.Getenv("META_DATA_API_KEY")
-	mediaAPIKey := os.Getenv("MEDIA_API_KEY")
-
-	if publishAPIKey == "" || allStatusAPIKey == "" || metaDataAPIKey == "" || mediaAPIKey == "" {
-		t.Skip("API keys not set in environment variables")
+	media := MediaConfig{
+		APIKey: keys.Media,
 	}
 
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name     string
+		config   *Config
+		failures map[string]int
+		want     bool
 	}{
 		{
-			name: "backup contents only",
-			args: args{
-				config: &Config{
-					Target:    "contents",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey:   publishAPIKey,
-						GetAllStatusContentsAPIKey: allStatusAPIKey,
-						GetContentsMetaDataAPIKey:  metaDataAPIKey,
-						Endpoints:                  []string{"test", "test2"},
-						RequestUnit:                10,
-						ClassifyByStatus:           true,
-						SaveAsCSV:                  true,
-					},
-				},
-				baseDir: "../backup/test/",
-			},
-			want: true,
+			name:   "backup contents only",
+			config: &Config{Target: "contents", ServiceID: "backup-test", Contents: contents},
+			want:   true,
 		},
 		{
-			name: "backup media only",
-			args: args{
-				config: &Config{
-					Target:    "media",
-					ServiceID: "backup-test",
-					Media: MediaConfig{
-						APIKey: mediaAPIKey,
-					},
-				},
-				baseDir: "../backup/test/",
-			},
-			want: true,
+			name:   "backup media only",
+			config: &Config{Target: "media", ServiceID: "backup-test", Media: media},
+			want:   true,
 		},
 		{
-			name: "backup all targets",
-			args: args{
-				config: &Config{
-					Target:    "all",
-					ServiceID: "backup-test",
-					Contents: ContentsConfig{
-						GetPublishContentsAPIKey:   publishAPIKey,
-						GetAllStatusContentsAPIKey: allStatusAPIKey,
-						GetContentsMetaDataAPIKey:  metaDataAPIKey,
-						Endpoints:                  []string{"test", "test2"},
-						RequestUnit:                10,
-						ClassifyByStatus:           true,
-						SaveAsCSV:                  true,
-					},
-					Media: MediaConfig{
-						APIKey: mediaAPIKey,
-					},
-				},
-				baseDir: "../backup/test/",
-			},
-			want: true,
+			name:   "backup all targets",
+			config: &Config{Target: "all", ServiceID: "backup-test", Contents: contents, Media: media},
+			want:   true,
+		},
+		{
+			name:     "media list failed",
+			config:   &Config{Target: "all", ServiceID: "backup-test", Contents: contents, Media: media},
+			failures: map[string]int{"/management/api/v2/media": 500},
+			want:     false,
+		},
+		{
+			name:   "unknown target",
+			config: &Config{Target: "unknown", ServiceID: "backup-test"},
+			want:   false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			time.Sleep(5 * time.Second)
+			fixture := testMockFixture()
+			fixture.Failures = tt.failures
+			server := mockcms.NewServer(fixture)
+			defer server.Close()
 
-			client := &Client{}
-			client.Config = tt.args.config
+			baseDir := t.TempDir() + "/"
+			client := newMockClient(server, tt.config)
 
-			err := client.StartBackup(tt.args.baseDir)
+			err := client.StartBackup(context.Background(), baseDir)
 			got := err == nil
 			if got != tt.want {
-				t.Errorf("StartBackup() = %v, want %v", got, tt.want)
+				t.Fatalf("StartBackup() = %v, want %v (error = %v)", got, tt.want, err)
+			}
+			// 成功した場合のみ完了の印が書き込まれる
+			if IsCompleteBackup(baseDir) != tt.want {
+				t.Errorf("IsCompleteBackup() = %v, want %v", IsCompleteBackup(baseDir), tt.want)
 			}
 		})
 	}
 }
+
+func TestStartBackupCanceled(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := &Client{}
+	client.Config = &Config{
+		Target:    "media",
+		ServiceID: "backup-test",
+	}
+
+	err := client.StartBackup(ctx, baseDir)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("StartBackup() error = %v, want %v", err, context.Canceled)
+	}
+
+	// 中断されたディレクトリには未完了の印が残る
+	if _, err := os.Stat(baseDir + incompleteMarkerFileName); err != nil {
+		t.Errorf("未完了の印が書き込まれていません: %v", err)
+	}
+	if IsCompleteBackup(baseDir) {
+		t.Errorf("中断されたディレクトリに完了の印が書き込まれました")
+	}
+}
+
+func TestSleepCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := sleep(ctx, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("sleep() error = %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("sleep() がキャンセル後も待機しました")
+	}
+}
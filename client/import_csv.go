@@ -0,0 +1,425 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// microCMSが設定するフィールド
+// idはコンテンツの特定に使い、それ以外は更新できないため取り込まない
+var systemFields = []string{"id", "createdAt", "updatedAt", "publishedAt", "revisedAt"}
+
+// importRow はCSVの1行から組み立てたコンテンツ
+type importRow struct {
+	// CSVファイルの行番号(ヘッダー行が1行目)
+	Line   int
+	Id     string
+	Fields []importField
+}
+
+// importField はコンテンツの1フィールド分の値
+// 値は書き込みAPIに送る形式のJSON
+type importField struct {
+	Key   string
+	Kind  string
+	Value json.RawMessage
+	// カスタムフィールド・繰り返しフィールドの中の、コンテンツ参照のフィールドのパス
+	Relations map[string]bool
+}
+
+// FieldDiff はフィールドの現在の値と、CSVの値の差分
+type FieldDiff struct {
+	Field   string
+	Current string
+	New     string
+}
+
+// ImportCSV はコンテンツのCSVファイルを読み込み、サービスの現在のコンテンツとの差分を表示する
+// applyがtrueの場合のみ、書き込みAPIで差分を反映する
+// 組み立てたコンテンツは、CSVファイルと同じディレクトリに<ファイル名>.import.jsonとして保存する
+func (c Client) ImportCSV(ctx context.Context, endpoint, csvPath string, apply bool) error {
+	if apply && c.Config.Contents.UpdateAPIKey == "" {
+		return errors.New("反映するには、contents.updateAPIKeyを設定してください")
+	}
+
+	records, err := readContentsCSVFile(csvPath)
+	if err != nil {
+		return fmt.Errorf("CSVファイルの読み込みでエラーが発生しました: %w", err)
+	}
+	schema, err := c.getAPISchema(ctx, endpoint)
+	if err != nil {
+		return fmt.Errorf("APIスキーマの取得でエラーが発生しました: %w", err)
+	}
+	fields := schema.APIFields
+	rows, err := buildImportRows(records, schema)
+	if err != nil {
+		return err
+	}
+
+	err = writeImportJSON(strings.TrimSuffix(csvPath, filepath.Ext(csvPath))+".import.json", rows)
+	if err != nil {
+		return fmt.Errorf("組み立てたコンテンツの保存でエラーが発生しました: %w", err)
+	}
+
+	// 下書き中のコンテンツとも比較できるよう、すべてのステータスを取得できるAPIキーを優先する
+	apiKey := c.Config.Contents.GetAllStatusContentsAPIKey
+	if apiKey == "" {
+		apiKey = c.Config.Contents.GetPublishContentsAPIKey
+	}
+
+	var required []string
+	for _, field := range fields {
+		if field.Required {
+			required = append(required, field.FieldId)
+		}
+	}
+
+	changed, applied, invalid := 0, 0, 0
+	for i, row := range rows {
+		if i > 0 {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
+		}
+
+		current, err := c.getContentWithGJSON(ctx, Endpoint{Name: endpoint}, apiKey, row.Id)
+		if err != nil {
+			return fmt.Errorf("%d行目 %s の現在のコンテンツの取得でエラーが発生しました: %w", row.Line, row.Id, err)
+		}
+		diffs, err := diffImportRow(row, current)
+		if err != nil {
+			return fmt.Errorf("%d行目 %s の比較でエラーが発生しました: %w", row.Line, row.Id, err)
+		}
+
+		missing := missingRequiredFields(row, current, required)
+
+		// 進捗状況と差分の表示
+		fmt.Printf("[%d / %d] %s\n", i+1, len(rows), row.Id)
+		for _, key := range missing {
+			fmt.Printf("  %s: 必須フィールドが空です\n", key)
+		}
+		if len(missing) > 0 {
+			// 書き込みAPIで更新できないため、反映しない
+			invalid++
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		changed++
+		for _, diff := range diffs {
+			fmt.Printf("  %s: %s -> %s\n", diff.Field, diff.Current, diff.New)
+		}
+
+		if apply && len(missing) == 0 {
+			if err := c.patchContent(ctx, endpoint, row, diffs); err != nil {
+				return fmt.Errorf("%d行目 %s の反映でエラーが発生しました: %w", row.Line, row.Id, err)
+			}
+			applied++
+		}
+	}
+
+	log.Printf("変更のあるコンテンツ: %d件 / 変更のないコンテンツ: %d件\n", changed, len(rows)-changed)
+	if apply {
+		log.Printf("%d件のコンテンツに反映しました\n", applied)
+	} else if changed > 0 {
+		log.Println("差分の表示のみのため、反映していません（反映する場合は-applyを指定してください）")
+	}
+	if invalid > 0 {
+		return fmt.Errorf("必須フィールドが空のコンテンツが%d件あります（反映されません）", invalid)
+	}
+	return nil
+}
+
+// missingRequiredFields は反映後に値が空となる必須フィールドを返す
+// CSVにないフィールドは、サービスの現在の値が残るものとする
+func missingRequiredFields(row importRow, current gjson.Result, required []string) []string {
+	var missing []string
+	for _, key := range required {
+		if slices.ContainsFunc(row.Fields, func(field importField) bool { return field.Key == key }) {
+			continue
+		}
+		value := current.Get(key)
+		if value.Type == gjson.Null || csvCellValue(value) == "" || csvCellValue(value) == "[]" {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// buildImportRows はCSVの行をAPIスキーマで検証し、書き込みAPIに送る形式のコンテンツを組み立てる
+// ヘッダー行がAPIスキーマの表示名の場合は、フィールドIDとして扱う
+// 1行でも検証に失敗した場合は、すべてのエラーをまとめて返す
+func buildImportRows(records [][]string, schema apiSchema) ([]importRow, error) {
+	if len(records) == 0 {
+		return nil, errors.New("CSVファイルが空です")
+	}
+
+	fields := schema.APIFields
+	relations := schema.relationPaths()
+	kinds := make(map[string]string, len(fields))
+	fieldIds := make(map[string]string, len(fields))
+	required := make(map[string]bool)
+	for _, field := range fields {
+		kinds[field.FieldId] = field.Kind
+		fieldIds[field.Name] = field.FieldId
+		required[field.FieldId] = field.Required
+	}
+	header := make([]string, len(records[0]))
+	for i, key := range records[0] {
+		if id, ok := fieldIds[key]; ok && kinds[key] == "" {
+			key = id
+		}
+		header[i] = key
+	}
+	if !slices.Contains(header, "id") {
+		return nil, errors.New("idのカラムがありません")
+	}
+
+	var errs []error
+	for _, key := range header {
+		switch {
+		case slices.Contains(systemFields, key), strings.HasPrefix(key, metaDataColumnPrefix):
+		case kinds[key] != "":
+		case strings.ContainsAny(key, ".["):
+			errs = append(errs, fmt.Errorf("展開されたカラムには対応していません（flattenを無効にして保存したCSVを使用してください）: %s", key))
+		default:
+			errs = append(errs, fmt.Errorf("APIスキーマに存在しないフィールドです: %s", key))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	rows := make([]importRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		row := importRow{Line: i + 2}
+		for j, key := range header {
+			if j >= len(record) {
+				continue
+			}
+			if key == "id" {
+				row.Id = record[j]
+				continue
+			}
+			kind := kinds[key]
+			if kind == "" {
+				// microCMSが設定するフィールドとメタデータは取り込まない
+				continue
+			}
+			fieldRelations := subFieldPaths(relations, key)
+			value, err := importCellValue(kind, record[j], fieldRelations)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%d行目 %s: %w", row.Line, key, err))
+				continue
+			}
+			// 空のセルは変更しないが、必須フィールドは空にできない
+			if value == nil {
+				if required[key] {
+					errs = append(errs, fmt.Errorf("%d行目 %s: 必須フィールドが空です", row.Line, key))
+				}
+				continue
+			}
+			row.Fields = append(row.Fields, importField{Key: key, Kind: kind, Value: value, Relations: fieldRelations})
+		}
+		if row.Id == "" {
+			errs = append(errs, fmt.Errorf("%d行目: idが空です", row.Line))
+		}
+		rows = append(rows, row)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return rows, nil
+}
+
+// importCellValue はCSVのセルの値を、フィールドの種類に合わせて書き込みAPIに送る形式のJSONに変換する
+// オブジェクトや配列のセルはJSON文字列として解釈し、空のセルの場合はnilを返す
+// relationsはフィールドの中のコンテンツ参照のフィールドのパスで、カスタムフィールド・繰り返しフィールドに使う
+func importCellValue(kind, cell string, relations map[string]bool) (json.RawMessage, error) {
+	if cell == "" {
+		return nil, nil
+	}
+
+	switch kind {
+	case "text", "textArea", "richEditor", "richEditorV2":
+		return json.Marshal(cell)
+	case "number":
+		if gjson.Parse(cell).Type != gjson.Number || !json.Valid([]byte(cell)) {
+			return nil, fmt.Errorf("数値ではありません: %s", cell)
+		}
+		return json.RawMessage(cell), nil
+	case "boolean":
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, fmt.Errorf("真偽値ではありません: %s", cell)
+		}
+		return json.Marshal(b)
+	case "date":
+		if _, err := time.Parse(time.RFC3339Nano, cell); err != nil {
+			return nil, fmt.Errorf("日時の形式が正しくありません: %s", cell)
+		}
+		return json.Marshal(cell)
+	case "select":
+		// 単一の値は1つだけ選択したものとする
+		if !json.Valid([]byte(cell)) || !gjson.Parse(cell).IsArray() {
+			return json.Marshal([]string{cell})
+		}
+		return json.RawMessage(cell), nil
+	case "relation":
+		// 展開されたコンテンツ参照、またはIDの文字列
+		if value := gjson.Parse(cell); json.Valid([]byte(cell)) && value.IsObject() {
+			id := value.Get("id")
+			if id.Type != gjson.String {
+				return nil, fmt.Errorf("コンテンツ参照のIDがありません: %s", cell)
+			}
+			return json.Marshal(id.String())
+		}
+		return json.Marshal(cell)
+	case "media", "file":
+		// 展開された画像・ファイル、またはURLの文字列
+		if value := gjson.Parse(cell); json.Valid([]byte(cell)) && value.IsObject() {
+			url := value.Get("url")
+			if url.Type != gjson.String {
+				return nil, fmt.Errorf("URLがありません: %s", cell)
+			}
+			return json.Marshal(url.String())
+		}
+		return json.Marshal(cell)
+	}
+
+	if !json.Valid([]byte(cell)) {
+		return nil, fmt.Errorf("JSONとして解釈できません: %s", cell)
+	}
+	value := gjson.Parse(cell)
+	switch kind {
+	case "relationList", "mediaList":
+		if !value.IsArray() {
+			return nil, fmt.Errorf("配列ではありません: %s", cell)
+		}
+		key := "id"
+		if kind == "mediaList" {
+			key = "url"
+		}
+		values := []string{}
+		for _, element := range value.Array() {
+			if element.IsObject() {
+				element = element.Get(key)
+			}
+			if element.Type != gjson.String {
+				return nil, fmt.Errorf("%sがない要素があります: %s", key, cell)
+			}
+			values = append(values, element.String())
+		}
+		return json.Marshal(values)
+	default:
+		// カスタムフィールド・繰り返しフィールドなどは、含まれるコンテンツ参照をIDにする
+		return json.RawMessage(compactRelationValue(cell, relations)), nil
+	}
+}
+
+// diffImportRow はサービスの現在のコンテンツと比較し、値が異なるフィールドを返す
+// 現在の値もCSVの値と同じ形式に変換してから比較する
+func diffImportRow(row importRow, current gjson.Result) ([]FieldDiff, error) {
+	var diffs []FieldDiff
+	for _, field := range row.Fields {
+		currentValue, err := importCellValue(field.Kind, csvCellValue(current.Get(field.Key)), field.Relations)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Key, err)
+		}
+		equal, err := jsonEqual(currentValue, field.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Key, err)
+		}
+		if equal {
+			continue
+		}
+		diff := FieldDiff{Field: field.Key, Current: "(なし)", New: string(field.Value)}
+		if currentValue != nil {
+			diff.Current = string(currentValue)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, nil
+}
+
+// jsonEqual は2つのJSONが同じ値かどうかを返す
+func jsonEqual(a, b json.RawMessage) (bool, error) {
+	if a == nil || b == nil {
+		return a == nil && b == nil, nil
+	}
+	var va, vb any
+	if err := json.Unmarshal(a, &va); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(va, vb), nil
+}
+
+// importRowJSON はコンテンツをCSVのカラムの順序のままJSONにする
+// diffsを指定した場合は、差分のあるフィールドのみとする
+func importRowJSON(row importRow, diffs []FieldDiff) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	first := true
+	write := func(key string, value json.RawMessage) {
+		if !first {
+			buf.WriteString(",")
+		}
+		first = false
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	if diffs == nil {
+		id, _ := json.Marshal(row.Id)
+		write("id", id)
+	}
+	for _, field := range row.Fields {
+		if diffs != nil && !slices.ContainsFunc(diffs, func(diff FieldDiff) bool { return diff.Field == field.Key }) {
+			continue
+		}
+		write(field.Key, field.Value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes()
+}
+
+// writeImportJSON は組み立てたコンテンツをJSONの配列として保存する
+func writeImportJSON(path string, rows []importRow) error {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.Write(importRowJSON(row, nil))
+	}
+	buf.WriteString("]")
+
+	formattedJson, err := formatJson(buf.String())
+	if err != nil {
+		return err
+	}
+	return writeStringAtomic(path, formattedJson+"\n")
+}
+
+// patchContent は書き込みAPIで、差分のあるフィールドのみを更新する
+func (c Client) patchContent(ctx context.Context, endpoint string, row importRow, diffs []FieldDiff) error {
+	return c.writeContent(ctx, http.MethodPatch, endpoint, row.Id, false, importRowJSON(row, diffs))
+}
@@ -0,0 +1,191 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+var importTestSchema = apiSchema{
+	APIFields: []APIField{
+		{FieldId: "title", Name: "タイトル", Kind: "text", Required: true},
+		{FieldId: "count", Kind: "number"},
+		{FieldId: "visible", Kind: "boolean"},
+		{FieldId: "category", Kind: "relation"},
+		{FieldId: "related", Kind: "relationList"},
+		{FieldId: "eyecatch", Kind: "media"},
+		{FieldId: "tags", Kind: "select"},
+		{FieldId: "repeater", Kind: "repeater", CustomFieldCreatedAtList: []string{"2024-01-01T00:00:00.000Z"}},
+	},
+	CustomFields: []APICustomField{
+		{FieldId: "link", CreatedAt: "2024-01-01T00:00:00.000Z", Fields: []APIField{{FieldId: "target", Kind: "relation"}, {FieldId: "image", Kind: "media"}}},
+	},
+}
+
+func TestImportCellValue(t *testing.T) {
+	tests := []struct {
+		kind      string
+		cell      string
+		relations map[string]bool
+		want      string
+		wantErr   bool
+	}{
+		{kind: "text", cell: "改行\nあり", want: `"改行\nあり"`},
+		{kind: "text", cell: "", want: ""},
+		{kind: "number", cell: "1.5", want: `1.5`},
+		{kind: "number", cell: "abc", wantErr: true},
+		{kind: "boolean", cell: "TRUE", want: `true`},
+		{kind: "boolean", cell: "yes", wantErr: true},
+		{kind: "date", cell: "2024-01-01T00:00:00.000Z", want: `"2024-01-01T00:00:00.000Z"`},
+		{kind: "date", cell: "2024/01/01", wantErr: true},
+		{kind: "select", cell: `["a","b"]`, want: `["a","b"]`},
+		{kind: "select", cell: "a", want: `["a"]`},
+		{kind: "relation", cell: `{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"}`, want: `"cat1"`},
+		{kind: "relation", cell: "cat1", want: `"cat1"`},
+		{kind: "relationList", cell: `[{"id":"a","createdAt":"2024-01-01T00:00:00.000Z"},"b"]`, want: `["a","b"]`},
+		{kind: "relationList", cell: `{"id":"a"}`, wantErr: true},
+		{kind: "media", cell: `{"url":"https://images.microcms-assets.io/a.png","width":100}`, want: `"https://images.microcms-assets.io/a.png"`},
+		{kind: "repeater", cell: `[{"fieldId":"link","target":{"id":"a","createdAt":"2024-01-01T00:00:00.000Z"}}]`, relations: map[string]bool{"target": true}, want: `[{"fieldId":"link","target":"a"}]`},
+		// APIスキーマでコンテンツ参照でないフィールドは、idを持つオブジェクトでもそのまま送る
+		{kind: "repeater", cell: `[{"fieldId":"link","image":{"id":"x","url":"https://images.microcms-assets.io/a.png"}}]`, relations: map[string]bool{"target": true}, want: `[{"fieldId":"link","image":{"id":"x","url":"https://images.microcms-assets.io/a.png"}}]`},
+		{kind: "repeater", cell: `[{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind+"/"+tt.cell, func(t *testing.T) {
+			got, err := importCellValue(tt.kind, tt.cell, tt.relations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("importCellValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("importCellValue() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildImportRows(t *testing.T) {
+	// 表示名のヘッダー(タイトル)はフィールドIDとして扱う
+	records := [][]string{
+		{"id", "createdAt", "タイトル", "count", "category", "_meta.status"},
+		{"a", "2024-01-01T00:00:00.000Z", "タイトル", "", `{"id":"cat1"}`, `["PUBLISH"]`},
+	}
+	rows, err := buildImportRows(records, importTestSchema)
+	if err != nil {
+		t.Fatalf("buildImportRows() error = %v", err)
+	}
+	want := []importRow{{
+		Line: 2,
+		Id:   "a",
+		Fields: []importField{
+			{Key: "title", Kind: "text", Value: json.RawMessage(`"タイトル"`)},
+			{Key: "category", Kind: "relation", Value: json.RawMessage(`"cat1"`)},
+		},
+	}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("buildImportRows() = %v, want %v", rows, want)
+	}
+	if got := string(importRowJSON(rows[0], nil)); got != `{"id":"a","title":"タイトル","category":"cat1"}` {
+		t.Errorf("importRowJSON() = %s", got)
+	}
+}
+
+func TestBuildImportRowsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		want    []string
+	}{
+		{
+			name:    "スキーマにないカラム",
+			records: [][]string{{"id", "unknown", "category.id"}, {"a", "x", "cat1"}},
+			want:    []string{"APIスキーマに存在しないフィールドです: unknown", "展開されたカラムには対応していません"},
+		},
+		{
+			name:    "値の検証",
+			records: [][]string{{"id", "count", "visible"}, {"a", "x", "true"}, {"", "1", "no"}},
+			want:    []string{"2行目 count: 数値ではありません", "3行目 visible: 真偽値ではありません", "3行目: idが空です"},
+		},
+		{
+			name:    "必須フィールドが空",
+			records: [][]string{{"id", "title"}, {"a", ""}},
+			want:    []string{"2行目 title: 必須フィールドが空です"},
+		},
+		{
+			name:    "idがない",
+			records: [][]string{{"title"}, {"x"}},
+			want:    []string{"idのカラムがありません"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildImportRows(tt.records, importTestSchema)
+			if err == nil {
+				t.Fatal("buildImportRows() error = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %v, want to contain %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffImportRow(t *testing.T) {
+	records := [][]string{
+		{"id", "title", "count", "category", "related", "eyecatch", "tags"},
+		{"a", "新しいタイトル", "3", "cat2", `["b","c"]`, `{"url":"https://images.microcms-assets.io/a.png"}`, "x"},
+	}
+	rows, err := buildImportRows(records, importTestSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := gjson.Parse(`{
+		"id": "a",
+		"title": "タイトル",
+		"count": 3.0,
+		"category": {"id": "cat1", "createdAt": "2024-01-01T00:00:00.000Z"},
+		"related": [{"id": "b", "createdAt": "2024-01-01T00:00:00.000Z"}, {"id": "c", "createdAt": "2024-01-01T00:00:00.000Z"}],
+		"eyecatch": {"url": "https://images.microcms-assets.io/a.png", "width": 100, "height": 100},
+		"tags": ["x"]
+	}`)
+
+	diffs, err := diffImportRow(rows[0], current)
+	if err != nil {
+		t.Fatalf("diffImportRow() error = %v", err)
+	}
+	want := []FieldDiff{
+		{Field: "title", Current: `"タイトル"`, New: `"新しいタイトル"`},
+		{Field: "category", Current: `"cat1"`, New: `"cat2"`},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("diffImportRow() = %v, want %v", diffs, want)
+	}
+	if got := string(importRowJSON(rows[0], diffs)); got != `{"title":"新しいタイトル","category":"cat2"}` {
+		t.Errorf("importRowJSON() = %s", got)
+	}
+}
+
+func TestMissingRequiredFields(t *testing.T) {
+	row := importRow{Line: 2, Id: "a", Fields: []importField{{Key: "count", Kind: "number", Value: json.RawMessage(`1`)}}}
+	tests := []struct {
+		name    string
+		current string
+		want    []string
+	}{
+		{name: "現在の値が残る", current: `{"id":"a","title":"タイトル"}`, want: nil},
+		{name: "現在の値がない", current: `{"id":"a"}`, want: []string{"title"}},
+		{name: "現在の値がnull", current: `{"id":"a","title":null}`, want: []string{"title"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingRequiredFields(row, gjson.Parse(tt.current), []string{"title"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingRequiredFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 変更履歴を保存するディレクトリ名
+const changeLogDirName = "changes"
+
+// Webhookの署名のヘッダー
+const webhookSignatureHeader = "X-MICROCMS-Signature"
+
+// 受け取るWebhookの本文の上限
+const maxWebhookBodySize = 10 << 20
+
+// WebhookPayload はmicroCMSから送られるWebhookの本文
+type WebhookPayload struct {
+	Service string `json:"service"`
+	// エンドポイント
+	API string `json:"api"`
+	// コンテンツID(APIの設定の変更などでは空となる)
+	Id string `json:"id"`
+	// "new", "edit", "delete"
+	Type     string `json:"type"`
+	Contents *struct {
+		New *struct {
+			Status []string `json:"status"`
+		} `json:"new"`
+	} `json:"contents"`
+}
+
+// ChangeLogEntry は変更履歴の1件
+type ChangeLogEntry struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Type       string    `json:"type"`
+	Endpoint   string    `json:"endpoint"`
+	Id         string    `json:"id,omitempty"`
+	// 変更後のステータス
+	Status []string `json:"status,omitempty"`
+	// 公開中の内容
+	Publish json.RawMessage `json:"publish,omitempty"`
+	// 下書き中・公開終了の内容(全ステータスのコンテンツを取得するAPIキーで取得したもの)
+	Unpublished json.RawMessage `json:"unpublished,omitempty"`
+	// コンテンツIDがない場合の、エンドポイントのすべての公開中のコンテンツ
+	Contents json.RawMessage `json:"contents,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// webhookReceiver はWebhookを受け取り、変更されたコンテンツを取得して変更履歴に追記する
+type webhookReceiver struct {
+	client Client
+	// エンドポイントごとの変更履歴(<エンドポイント>.ndjson)を保存するディレクトリ
+	logDir string
+	now    func() time.Time
+
+	// 変更履歴を受け取った順に追記する
+	mu sync.Mutex
+}
+
+// Listen はaddrでmicroCMSのWebhookを受け取り、変更されたコンテンツをbackup/<サービスID>/changes/以下の変更履歴に追記する
+// ctxがキャンセルされると、処理中のリクエストを待ってから終了する
+func (c Client) Listen(ctx context.Context, addr string) error {
+	if c.Config.Listen.Secret == "" {
+		return errors.New("listen.secretでWebhookのシークレットを指定してください")
+	}
+	if err := c.validateRedaction(); err != nil {
+		return err
+	}
+	// 起動後に作成された参照先のコンテンツIDは分からないため、展開されたコンテンツ参照は加工できない
+	if c.needsRedactionTargets() && !c.redactsAlongside() {
+		return errors.New("変更履歴でフィールドを加工する場合は、展開されたコンテンツ参照に加工前の値が残らないよう、relationsにidを指定してください")
+	}
+	// コンテンツ参照をIDで記録する場合は、APIスキーマからコンテンツ参照のフィールドを求める
+	if c.storesRelationIDs() {
+		relationFields, err := c.loadRelationFields(ctx)
+		if err != nil {
+			return err
+		}
+		c.relationFields = relationFields
+	}
+	receiver := &webhookReceiver{
+		client: c,
+		logDir: c.backupRootDir() + changeLogDirName + "/",
+		now:    time.Now,
+	}
+
+	srv := &http.Server{Addr: addr, Handler: receiver}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("http://%s/webhook でWebhookを受け取ります\n", addr)
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/webhook" {
+		writeServeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeServeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		writeServeError(w, http.StatusRequestEntityTooLarge, "Request body is too large.")
+		return
+	}
+	if !verifyWebhookSignature(body, r.Header.Get(webhookSignatureHeader), wr.client.Config.Listen.Secret) {
+		log.Println("署名が正しくないWebhookを受け取りました")
+		writeServeError(w, http.StatusUnauthorized, "Invalid signature.")
+		return
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.API == "" {
+		writeServeError(w, http.StatusBadRequest, "Invalid payload.")
+		return
+	}
+
+	i := slices.IndexFunc(wr.client.Config.Contents.Endpoints, func(e Endpoint) bool { return e.Name == payload.API })
+	if i < 0 {
+		log.Printf("%sはバックアップの対象ではないため、Webhookを無視します\n", payload.API)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	entry := wr.fetch(r.Context(), wr.client.Config.Contents.Endpoints[i], payload)
+	if err := wr.append(entry); err != nil {
+		log.Printf("変更履歴の書き込みに失敗しました: %v\n", err)
+		writeServeError(w, http.StatusInternalServerError, "Failed to write change log.")
+		return
+	}
+	if entry.Error != "" {
+		log.Printf("%s/%s: 変更されたコンテンツの取得に失敗しました: %s\n", entry.Endpoint, entry.Id, entry.Error)
+		writeServeError(w, http.StatusInternalServerError, "Failed to fetch content.")
+		return
+	}
+	log.Printf("%s/%s(%s)を変更履歴に追記しました\n", entry.Endpoint, entry.Id, entry.Type)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyWebhookSignature は本文をシークレットで署名したHMAC-SHA256(16進数)が、署名のヘッダーと一致するかを返す
+func verifyWebhookSignature(body []byte, signature, secret string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// fetch はWebhookで通知されたコンテンツを取得し、変更履歴の1件を作成する
+// 削除された場合は取得しない。取得に失敗した場合もエラーを記録した変更履歴を返す
+func (wr *webhookReceiver) fetch(ctx context.Context, endpoint Endpoint, payload WebhookPayload) ChangeLogEntry {
+	entry := ChangeLogEntry{
+		ReceivedAt: wr.now(),
+		Type:       payload.Type,
+		Endpoint:   payload.API,
+		Id:         payload.Id,
+	}
+	if payload.Contents != nil && payload.Contents.New != nil {
+		entry.Status = payload.Contents.New.Status
+	}
+	if payload.Type == "delete" {
+		return entry
+	}
+
+	c := wr.client
+	var err error
+	switch {
+	case payload.Id == "":
+		entry.Contents, err = c.getAllContents(ctx, endpoint, c.Config.Contents.GetPublishContentsAPIKey)
+	default:
+		// ステータスが分からない場合は、公開中の内容のみを取得する
+		publish := len(entry.Status) == 0 || slices.Contains(entry.Status, "PUBLISH")
+		unpublished := slices.Contains(entry.Status, "DRAFT") || slices.Contains(entry.Status, "CLOSED")
+		if publish {
+			entry.Publish, err = c.getContent(ctx, endpoint, c.Config.Contents.GetPublishContentsAPIKey, payload.Id)
+		}
+		if err == nil && unpublished {
+			if c.Config.Contents.GetAllStatusContentsAPIKey == "" {
+				err = errors.New("下書き中・公開終了のコンテンツの取得には、getAllStatusContentsAPIKeyが必要です")
+			} else {
+				entry.Unpublished, err = c.getContent(ctx, endpoint, c.Config.Contents.GetAllStatusContentsAPIKey, payload.Id)
+			}
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
+
+// getContent はコンテンツを1件取得し、加工のルールを適用したJSONを返す
+// コンテンツ参照をIDで保存する場合は、バックアップと同じくIDに置き換える
+func (c Client) getContent(ctx context.Context, endpoint Endpoint, apiKey, id string) (json.RawMessage, error) {
+	item, err := c.getContentWithGJSON(ctx, endpoint, apiKey, id)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(c.changeLogContent(endpoint.Name, item)), nil
+}
+
+// changeLogContent は変更履歴に記録するコンテンツのJSON文字列を返す
+func (c Client) changeLogContent(endpoint string, item gjson.Result) string {
+	raw := c.redactContent(endpoint, item).Raw
+	if c.storesRelationIDs() {
+		raw = compactRelations(raw, c.relationFields.schemaPaths(endpoint), nil)
+	}
+	return raw
+}
+
+// getAllContents はエンドポイントのすべてのコンテンツを取得し、加工のルールを適用したJSONの配列を返す
+func (c Client) getAllContents(ctx context.Context, endpoint Endpoint, apiKey string) (json.RawMessage, error) {
+	limit := c.Config.Contents.RequestUnit
+	if limit <= 0 {
+		limit = serveDefaultLimit
+	}
+	var items []string
+	for offset := 0; ; offset += limit {
+		url := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint.Name, endpoint.listQuery(limit, offset))
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req.Header.Set("X-MICROCMS-API-KEY", apiKey)
+
+		resp, err := new(http.Client).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+		}
+
+		contents := gjson.GetBytes(body, "contents")
+		if !contents.IsArray() {
+			return nil, fmt.Errorf("contentsが配列ではありません")
+		}
+		for _, item := range contents.Array() {
+			items = append(items, c.changeLogContent(endpoint.Name, item))
+		}
+		if len(contents.Array()) < limit || len(items) >= int(gjson.GetBytes(body, "totalCount").Int()) {
+			break
+		}
+	}
+	return json.RawMessage("[" + strings.Join(items, ",") + "]"), nil
+}
+
+// append は変更履歴をエンドポイントごとのNDJSONファイルに1行として追記する
+// 既存の行は変更しない
+func (wr *webhookReceiver) append(entry ChangeLogEntry) error {
+	// リッチエディタのHTMLをそのまま残すため、エスケープしない
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		return err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if err := os.MkdirAll(wr.logDir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(wr.logDir+entry.Endpoint+".ndjson", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
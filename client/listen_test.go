@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
+	"github.com/tidwall/gjson"
+)
+
+func TestWebhookReceiver(t *testing.T) {
+	keys := testMockKeys()
+	fixture := testMockFixture()
+	fixture.Contents["blogs"][0].Body = `{"id":"a","title":"公開中","category":{"id":"news","createdAt":"2024-01-01T00:00:00.000Z","name":"ニュース"}}`
+	fixture.Schemas["blogs"] = `[{"fieldId":"title","name":"タイトル","kind":"text"},{"fieldId":"category","name":"カテゴリ","kind":"relation"}]`
+	server := mockcms.NewServer(fixture)
+	defer server.Close()
+
+	client := newMockClient(server, &Config{
+		Contents: ContentsConfig{
+			GetPublishContentsAPIKey:   keys.Publish,
+			GetAllStatusContentsAPIKey: keys.AllStatus,
+			GetContentsMetaDataAPIKey:  keys.MetaData,
+			Endpoints:                  []Endpoint{{Name: "blogs"}},
+			RequestUnit:                2,
+			// コンテンツ参照はバックアップと同じくIDで記録する
+			Relations: "id",
+		},
+		Listen: ListenConfig{Secret: "webhook-secret"},
+	})
+	relationFields, err := client.loadRelationFields(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.relationFields = relationFields
+	logDir := t.TempDir() + "/"
+	receiver := &webhookReceiver{
+		client: *client,
+		logDir: logDir,
+		now:    func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("webhook-secret"))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		signature  string
+		wantStatus int
+	}{
+		{name: "GET", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+		{name: "署名なし", method: http.MethodPost, body: `{"api":"blogs","id":"a","type":"edit"}`, wantStatus: http.StatusUnauthorized},
+		{name: "署名が正しくない", method: http.MethodPost, body: `{"api":"blogs","id":"a","type":"edit"}`, signature: sign(`{"api":"blogs","id":"b","type":"edit"}`), wantStatus: http.StatusUnauthorized},
+		{name: "対象外のエンドポイント", method: http.MethodPost, body: `{"api":"categories","id":"news","type":"edit"}`, wantStatus: http.StatusNoContent},
+		{name: "公開", method: http.MethodPost, body: `{"service":"test","api":"blogs","id":"a","type":"new","contents":{"old":null,"new":{"id":"a","status":["PUBLISH"]}}}`, wantStatus: http.StatusNoContent},
+		{name: "公開中かつ下書き中", method: http.MethodPost, body: `{"service":"test","api":"blogs","id":"b","type":"edit","contents":{"new":{"id":"b","status":["PUBLISH","DRAFT"]}}}`, wantStatus: http.StatusNoContent},
+		{name: "削除", method: http.MethodPost, body: `{"service":"test","api":"blogs","id":"z","type":"delete","contents":{"new":null}}`, wantStatus: http.StatusNoContent},
+		{name: "コンテンツIDなし", method: http.MethodPost, body: `{"service":"test","api":"blogs","id":null,"type":"edit"}`, wantStatus: http.StatusNoContent},
+		{name: "取得できない", method: http.MethodPost, body: `{"service":"test","api":"blogs","id":"missing","type":"edit","contents":{"new":{"status":["PUBLISH"]}}}`, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/webhook", strings.NewReader(tt.body))
+			signature := tt.signature
+			if signature == "" && tt.wantStatus != http.StatusUnauthorized {
+				signature = sign(tt.body)
+			}
+			req.Header.Set(webhookSignatureHeader, signature)
+			rec := httptest.NewRecorder()
+			receiver.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	b, err := os.ReadFile(logDir + "blogs.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("変更履歴の件数 = %d, want 5: %s", len(lines), b)
+	}
+	wants := []map[string]string{
+		{"type": "new", "id": "a", "publish.title": "公開中", "publish.category": "news", "unpublished": ""},
+		{"type": "edit", "id": "b", "publish.title": "公開中の内容", "unpublished.title": "下書きの内容"},
+		{"type": "delete", "id": "z", "publish": "", "unpublished": ""},
+		{"type": "edit", "id": "", "contents.#": "2", "contents.1.id": "b"},
+		{"type": "edit", "id": "missing", "publish": "", "error": "ステータスコード:404 正常にレスポンスを取得できませんでした"},
+	}
+	for i, want := range wants {
+		for path, value := range want {
+			if got := gjson.Get(lines[i], path).String(); got != value {
+				t.Errorf("%d行目の%s = %q, want %q", i+1, path, got, value)
+			}
+		}
+	}
+	if _, err := os.Stat(logDir + "categories.ndjson"); !os.IsNotExist(err) {
+		t.Errorf("対象外のエンドポイントの変更履歴が作成されました: %v", err)
+	}
+}
+
+func TestListenRedactionRelations(t *testing.T) {
+	client := Client{Config: &Config{
+		Contents: ContentsConfig{
+			Redaction: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "drop"}}}},
+		},
+		Listen: ListenConfig{Secret: "webhook-secret"},
+	}}
+	err := client.Listen(context.Background(), "localhost:0")
+	if err == nil || !strings.Contains(err.Error(), "relationsにid") {
+		t.Errorf("Listen() error = %v", err)
+	}
+}
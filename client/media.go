@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,29 +13,52 @@ import (
 	"time"
 )
 
-func (c Client) BackupMedia(baseDir string) error {
+func (c Client) BackupMedia(ctx context.Context, baseDir string) error {
 	log.Println("メディアのバックアップを開始します")
-	const requestUnit = 100
-	totalCount, err := c.getTotalCount()
-	if err != nil {
-		return fmt.Errorf("合計件数の取得でエラーが発生しました: %w", err)
+
+	var mediaAry []Media
+	var totalCount int
+	switch c.Config.Media.Scope {
+	case "", "all":
+		const requestUnit = 100
+		var err error
+		totalCount, err = c.getTotalCount(ctx)
+		if err != nil {
+			return fmt.Errorf("合計件数の取得でエラーが発生しました: %w", err)
+		}
+		requiredRequestCount := (totalCount/requestUnit + 1)
+
+		mediaAry, err = c.getAllMedia(ctx, requiredRequestCount, requestUnit)
+		if err != nil {
+			return fmt.Errorf("メディア一覧の取得でエラーが発生しました: %w", err)
+		}
+	case "referenced":
+		// メディア一覧は取得せず、コンテンツから参照されているメディアのみを対象とする
+		var err error
+		mediaAry, err = collectReferencedMedia(baseDir)
+		if err != nil {
+			return fmt.Errorf("コンテンツから参照されているメディアの収集でエラーが発生しました: %w", err)
+		}
+		totalCount = len(mediaAry)
+		log.Printf("コンテンツから参照されているメディアが%d件見つかりました\n", totalCount)
+	default:
+		return fmt.Errorf("不明なメディアの範囲が選択されました: %s", c.Config.Media.Scope)
 	}
-	requiredRequestCount := (totalCount/requestUnit + 1)
 
-	mediaAry, err := c.getAllMedia(requiredRequestCount, requestUnit)
+	entries, err := c.saveMedia(ctx, mediaAry, totalCount, baseDir)
 	if err != nil {
-		return fmt.Errorf("メディア一覧の取得でエラーが発生しました: %w", err)
+		return fmt.Errorf("メディアの保存でエラーが発生しました: %w", err)
 	}
-	err = c.saveMedia(mediaAry, totalCount, baseDir)
+	err = writeMediaIndex(baseDir, entries)
 	if err != nil {
-		return fmt.Errorf("メディアの保存でエラーが発生しました: %w", err)
+		return fmt.Errorf("メディア一覧の保存でエラーが発生しました: %w", err)
 	}
 	return nil
 }
 
-func (c Client) getTotalCount() (int, error) {
-	url := fmt.Sprintf("https://%s.microcms-management.io/api/v2/media?limit=0", c.Config.ServiceID)
-	req, _ := http.NewRequest("GET", url, nil)
+func (c Client) getTotalCount(ctx context.Context) (int, error) {
+	url := fmt.Sprintf("%s/v2/media?limit=0", c.managementAPIURL())
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("X-MICROCMS-API-KEY", c.Config.Media.APIKey)
 
 	client := new(http.Client)
@@ -63,20 +87,28 @@ func (c Client) getTotalCount() (int, error) {
 	return response.TotalCount, err
 }
 
-func (c Client) getAllMedia(requiredRequestCount int, requestUnit int) ([]Media, error) {
-	var ary []Media
-	var token string
+func (c Client) getAllMedia(ctx context.Context, requiredRequestCount int, requestUnit int) ([]Media, error) {
+	// 中断されたバックアップの場合は、取得済みの一覧とトークンから再開する
+	ary, token, completed := c.checkpoint.mediaList()
+	if completed {
+		log.Println("取得済みのメディア一覧を利用します")
+		return ary, nil
+	}
+	start := len(ary) / requestUnit
 
-	for i := 0; i < requiredRequestCount; i++ {
+	for i := start; i < requiredRequestCount; i++ {
 		// 1秒のディレイを追加
-		if i > 0 {
-			time.Sleep(3 * time.Second)
+		if i > start {
+			if err := sleep(ctx, 3*time.Second); err != nil {
+				return nil, err
+			}
 		}
 
 		client := new(http.Client)
-		req, _ := http.NewRequest(
+		req, _ := http.NewRequestWithContext(
+			ctx,
 			"GET",
-			fmt.Sprintf("https://%s.microcms-management.io/api/v2/media?limit=%d&token=%s", c.Config.ServiceID, requestUnit, token),
+			fmt.Sprintf("%s/v2/media?limit=%d&token=%s", c.managementAPIURL(), requestUnit, token),
 			nil,
 		)
 		req.Header.Set("X-MICROCMS-API-KEY", c.Config.Media.APIKey)
@@ -102,55 +134,104 @@ func (c Client) getAllMedia(requiredRequestCount int, requestUnit int) ([]Media,
 
 		ary = append(ary, response.Media...)
 		token = response.Token
+
+		err = c.checkpoint.setMediaList(ary, token, false)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	err := c.checkpoint.setMediaList(ary, token, true)
+	if err != nil {
+		return nil, err
+	}
 	return ary, nil
 }
 
-func (c Client) saveMedia(medias []Media, totalCount int, baseDir string) error {
+func (c Client) saveMedia(ctx context.Context, medias []Media, totalCount int, baseDir string) ([]MediaIndexEntry, error) {
+	entries := make([]MediaIndexEntry, 0, len(medias))
 	for i, media := range medias {
 		// 進捗状況の表示
 		fmt.Printf("[%d / %d] %s\n", i+1, totalCount, media.Url)
 
-		client := new(http.Client)
-		req, _ := http.NewRequest("GET", media.Url, nil)
-		req.Header.Set("X-MICROCMS-API-KEY", c.Config.Media.APIKey)
-
-		resp, err := client.Do(req)
+		fileDirectory, fileName, err := mediaLocalPath(media)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+		localPath := "media/" + fileDirectory + "/" + fileName
+		filePath := baseDir + localPath
+
+		// コンテンツから参照されているメディアはIDを持たないため、URLで記録する
+		key := media.Id
+		if key == "" {
+			key = media.Url
 		}
-		defer resp.Body.Close()
 
-		ary := strings.Split(media.Url, "/")
-		fileName := ary[len(ary)-1]
-		fileName, err = url.QueryUnescape(fileName)
-		if err != nil {
-			return err
+		// 中断されたバックアップの場合は、ダウンロード済みでファイルが残っているものをスキップする
+		if c.checkpoint.isMediaDownloaded(key) {
+			if info, err := os.Stat(filePath); err == nil {
+				entries = append(entries, newMediaIndexEntry(media, localPath, info.Size(), c.checkpoint.mediaContentType(key)))
+				continue
+			}
 		}
-		fileDirectory := ary[len(ary)-2]
 
 		// ファイルごとのディレクトリを作成する
 		// (同じファイル名でアップロード可能なため、一意となるようなパスが付与されている)
 		err = os.MkdirAll(baseDir+"media/"+fileDirectory, os.ModePerm)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		file, err := os.Create(baseDir + "media/" + fileDirectory + "/" + fileName)
+		size, contentType, err := c.downloadMedia(ctx, media, filePath)
 		if err != nil {
-			return err
-
+			return nil, err
 		}
-		defer file.Close()
+		entries = append(entries, newMediaIndexEntry(media, localPath, size, contentType))
 
-		_, err = io.Copy(file, resp.Body)
+		err = c.checkpoint.markMediaDownloaded(key, contentType)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return entries, c.checkpoint.save()
+}
+
+// downloadMedia はメディアをダウンロードし、書き込んだバイト数とContent-Typeを返す
+func (c Client) downloadMedia(ctx context.Context, media Media, filePath string) (int64, string, error) {
+	client := new(http.Client)
+	req, _ := http.NewRequestWithContext(ctx, "GET", media.Url, nil)
+	req.Header.Set("X-MICROCMS-API-KEY", c.Config.Media.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+	}
+
+	// 中断・失敗した場合は、書きかけのファイルを残さない
+	var size int64
+	err = writeFileAtomic(filePath, func(w io.Writer) error {
+		size, err = io.Copy(w, resp.Body)
+		return err
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	return size, resp.Header.Get("Content-Type"), nil
+}
+
+// mediaLocalPath はメディアのURLから保存先のディレクトリ名とファイル名を返す
+func mediaLocalPath(media Media) (string, string, error) {
+	ary := strings.Split(media.Url, "/")
+	if len(ary) < 2 {
+		return "", "", fmt.Errorf("メディアのURLが不正です: %s", media.Url)
+	}
+	fileName, err := url.QueryUnescape(ary[len(ary)-1])
+	if err != nil {
+		return "", "", err
+	}
+	return ary[len(ary)-2], fileName, nil
 }
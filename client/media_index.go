@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+)
+
+// Mediaの既知のフィールド
+var mediaKnownFields = []string{"id", "url", "width", "height"}
+
+// UnmarshalJSON は既知のフィールド以外の属性をAttributesに保持する
+func (m *Media) UnmarshalJSON(b []byte) error {
+	type media Media
+	var known media
+	if err := json.Unmarshal(b, &known); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for _, key := range mediaKnownFields {
+		delete(fields, key)
+	}
+	if len(fields) > 0 {
+		known.Attributes = fields
+	}
+
+	*m = Media(known)
+	return nil
+}
+
+// MarshalJSON はAttributesを既知のフィールドと同じ階層に書き出す
+func (m Media) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]any, len(m.Attributes)+len(mediaKnownFields))
+	for key, value := range m.Attributes {
+		fields[key] = value
+	}
+	fields["id"] = m.Id
+	fields["url"] = m.Url
+	fields["width"] = m.Width
+	fields["height"] = m.Height
+	return json.Marshal(fields)
+}
+
+// newMediaIndexEntry はダウンロードしたメディアの情報から一覧の1件分を作成する
+// レスポンスからContent-Typeが得られない場合は、拡張子から推測する
+func newMediaIndexEntry(media Media, localPath string, size int64, contentType string) MediaIndexEntry {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(localPath))
+	}
+	return MediaIndexEntry{
+		Id:          media.Id,
+		Url:         media.Url,
+		LocalPath:   localPath,
+		Width:       media.Width,
+		Height:      media.Height,
+		Size:        size,
+		ContentType: contentType,
+		Attributes:  media.Attributes,
+	}
+}
+
+// writeMediaIndex はメディア一覧をJSONとCSVで保存する
+func writeMediaIndex(baseDir string, entries []MediaIndexEntry) error {
+	// メディアが1件もない場合は、media/が作成されていない
+	if err := os.MkdirAll(baseDir+"media", os.ModePerm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeStringAtomic(baseDir+"media/index.json", string(b)+"\n")
+	if err != nil {
+		return err
+	}
+
+	// APIが返したその他の属性は、キーの昇順でカラムに追加する
+	attributeKeys := make(map[string]bool)
+	for _, entry := range entries {
+		for key := range entry.Attributes {
+			attributeKeys[key] = true
+		}
+	}
+	orderedAttributeKeys := slices.Sorted(maps.Keys(attributeKeys))
+
+	return writeFileAtomic(baseDir+"media/index.csv", func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+
+		header := []string{"id", "url", "localPath", "width", "height", "size", "contentType"}
+		header = append(header, orderedAttributeKeys...)
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			row := []string{
+				entry.Id,
+				entry.Url,
+				entry.LocalPath,
+				strconv.Itoa(entry.Width),
+				strconv.Itoa(entry.Height),
+				strconv.FormatInt(entry.Size, 10),
+				entry.ContentType,
+			}
+			for _, key := range orderedAttributeKeys {
+				value, ok := entry.Attributes[key]
+				if !ok {
+					row = append(row, "")
+					continue
+				}
+				row = append(row, csvCellValue(gjson.ParseBytes(value)))
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("メディア一覧のCSVの書き込みに失敗しました: %w", err)
+		}
+		return nil
+	})
+}
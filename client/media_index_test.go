@@ -0,0 +1,92 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMediaJSON(t *testing.T) {
+	raw := `{"id":"abc","url":"https://images.microcms-assets.io/assets/xxx/yyy/sample.png","width":100,"height":50,"alt":"サンプル","description":{"text":"説明"}}`
+
+	var media Media
+	if err := json.Unmarshal([]byte(raw), &media); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if media.Id != "abc" || media.Width != 100 || media.Height != 50 {
+		t.Errorf("Media = %+v", media)
+	}
+	if string(media.Attributes["alt"]) != `"サンプル"` {
+		t.Errorf("Attributes[alt] = %s", media.Attributes["alt"])
+	}
+	if _, ok := media.Attributes["id"]; ok {
+		t.Errorf("既知のフィールドがAttributesに含まれています")
+	}
+
+	// チェックポイントに保存して読み込み直しても、属性が失われない
+	b, err := json.Marshal(media)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var restored Media
+	if err := json.Unmarshal(b, &restored); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(media, restored) {
+		t.Errorf("restored = %+v, want %+v", restored, media)
+	}
+}
+
+func TestWriteMediaIndex(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"media", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []MediaIndexEntry{
+		newMediaIndexEntry(
+			Media{Id: "a", Url: "https://example.com/a/image.png", Width: 10, Height: 20, Attributes: map[string]json.RawMessage{"alt": json.RawMessage(`"代替テキスト"`)}},
+			"media/a/image.png", 123, "image/png",
+		),
+		newMediaIndexEntry(
+			Media{Id: "b", Url: "https://example.com/b/file.pdf"},
+			"media/b/file.pdf", 456, "",
+		),
+	}
+
+	if err := writeMediaIndex(baseDir, entries); err != nil {
+		t.Fatalf("writeMediaIndex() error = %v", err)
+	}
+
+	b, err := os.ReadFile(baseDir + "media/index.json")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var got []MediaIndexEntry
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if len(got) != 2 || got[1].ContentType != "application/pdf" {
+		t.Errorf("index.json = %+v", got)
+	}
+
+	f, err := os.Open(baseDir + "media/index.csv")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	want := [][]string{
+		{"id", "url", "localPath", "width", "height", "size", "contentType", "alt"},
+		{"a", "https://example.com/a/image.png", "media/a/image.png", "10", "20", "123", "image/png", "代替テキスト"},
+		{"b", "https://example.com/b/file.pdf", "media/b/file.pdf", "0", "0", "456", "application/pdf", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("index.csv = %v, want %v", records, want)
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"regexp"
+
+	"github.com/tidwall/gjson"
+)
+
+// コンテンツ内のmicroCMSのメディアURL(画像・ファイル)に一致する正規表現
+// 1つ目のグループはクエリ文字列を除いたURL、2つ目のグループは画像変換などのクエリ文字列
+// JSONの文字列やリッチエディタのHTMLに埋め込まれていても、引用符やエスケープで区切れるようにする
+var mediaURLPattern = regexp.MustCompile(`(https://[a-z0-9-]+\.microcms-assets\.io/[^?#"'\s<>\\)]+)(\?[^#"'\s<>\\)]*)?`)
+
+// findMediaURLs はテキストに含まれるメディアURLを、クエリ文字列を除いて出現順に返す
+func findMediaURLs(text string) []string {
+	var urls []string
+	for _, match := range mediaURLPattern.FindAllStringSubmatch(text, -1) {
+		urls = append(urls, match[1])
+	}
+	return urls
+}
+
+// replaceMediaURLs はテキストに含まれるメディアURLを、クエリ文字列ごとreplaceの戻り値に置き換える
+// replaceがfalseを返したURLは変更しない
+func replaceMediaURLs(text string, replace func(url string) (string, bool)) string {
+	return mediaURLPattern.ReplaceAllStringFunc(text, func(match string) string {
+		url := mediaURLPattern.FindStringSubmatch(match)[1]
+		replaced, ok := replace(url)
+		if !ok {
+			return match
+		}
+		return replaced
+	})
+}
+
+// collectReferencedMedia はバックアップしたコンテンツ(contents/以下)を走査し、
+// 参照されているメディアを最初に出現した順に返す
+// 画像フィールドのように幅・高さを持つオブジェクトから参照されている場合は、その値も設定する
+func collectReferencedMedia(baseDir string) ([]Media, error) {
+	var medias []Media
+	indexes := make(map[string]int)
+
+	err := readBackupContents(baseDir, func(content backupContent) error {
+		for _, field := range content.Fields {
+			// リッチエディタのHTMLやカスタムフィールド、繰り返しフィールドの中も含めて、文字列としてURLを探す
+			for _, mediaURL := range findMediaURLs(field.Value) {
+				if _, ok := indexes[mediaURL]; ok {
+					continue
+				}
+				indexes[mediaURL] = len(medias)
+				medias = append(medias, Media{Url: mediaURL})
+			}
+
+			// 画像フィールドの幅・高さを設定する
+			walkMediaObjects(gjson.Parse(field.Value), func(mediaURL string, width, height int) {
+				if i, ok := indexes[mediaURL]; ok && medias[i].Width == 0 && medias[i].Height == 0 {
+					medias[i].Width = width
+					medias[i].Height = height
+				}
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return medias, nil
+}
+
+// walkMediaObjects はJSONを再帰的に走査し、urlにメディアURLを持つオブジェクトごとにfnを呼び出す
+func walkMediaObjects(value gjson.Result, fn func(mediaURL string, width, height int)) {
+	if value.IsObject() {
+		if match := mediaURLPattern.FindStringSubmatch(value.Get("url").String()); match != nil {
+			fn(match[1], int(value.Get("width").Int()), int(value.Get("height").Int()))
+		}
+	}
+	if value.IsObject() || value.IsArray() {
+		value.ForEach(func(_, child gjson.Result) bool {
+			walkMediaObjects(child, fn)
+			return true
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFindMediaURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "画像フィールド",
+			text: `{"image":{"url":"https://images.microcms-assets.io/assets/xxx/abc/sample.png","height":100,"width":200}}`,
+			want: []string{"https://images.microcms-assets.io/assets/xxx/abc/sample.png"},
+		},
+		{
+			name: "リッチエディタのHTML内の画像変換クエリ付きURL",
+			text: `{"body":"<p><img src=\"https://images.microcms-assets.io/assets/xxx/abc/sample.png?w=300&h=200\" alt=\"\"></p>"}`,
+			want: []string{"https://images.microcms-assets.io/assets/xxx/abc/sample.png"},
+		},
+		{
+			name: "ファイルフィールドと複数のURL",
+			text: `{"file":{"url":"https://files.microcms-assets.io/assets/xxx/def/doc.pdf"},"link":"https://example.com/a.png","image":{"url":"https://images.microcms-assets.io/assets/xxx/ghi/%E7%94%BB%E5%83%8F.jpg"}}`,
+			want: []string{
+				"https://files.microcms-assets.io/assets/xxx/def/doc.pdf",
+				"https://images.microcms-assets.io/assets/xxx/ghi/%E7%94%BB%E5%83%8F.jpg",
+			},
+		},
+		{
+			name: "メディアURLなし",
+			text: `{"title":"タイトル"}`,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findMediaURLs(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findMediaURLs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceMediaURLs(t *testing.T) {
+	text := `<img src="https://images.microcms-assets.io/assets/xxx/abc/a.png?w=300"><img src="https://images.microcms-assets.io/assets/xxx/def/b.png">`
+	got := replaceMediaURLs(text, func(url string) (string, bool) {
+		if url == "https://images.microcms-assets.io/assets/xxx/abc/a.png" {
+			return "media/abc/a.png", true
+		}
+		return "", false
+	})
+	want := `<img src="media/abc/a.png"><img src="https://images.microcms-assets.io/assets/xxx/def/b.png">`
+	if got != want {
+		t.Errorf("replaceMediaURLs() = %v, want %v", got, want)
+	}
+}
+
+func TestCollectReferencedMedia(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"contents/blogs/PUBLISH", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(baseDir+"contents/news/PUBLISH", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		// 画像フィールドとリッチエディタ
+		"contents/blogs/PUBLISH/1.json": `{"id":"a","eyecatch":{"url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","height":100,"width":200},"body":"<img src=\"https://images.microcms-assets.io/assets/xxx/def/b.png?w=10\">"}`,
+		// 繰り返しフィールドと、他のコンテンツと重複するメディア
+		"contents/blogs/PUBLISH/2.json": `{"id":"b","repeater":[{"fieldId":"image","image":{"url":"https://images.microcms-assets.io/assets/xxx/def/b.png","height":30,"width":40}},{"fieldId":"image","image":{"url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","height":100,"width":200}}]}`,
+		// CSV形式で保存したコンテンツ
+		"contents/news/PUBLISH/contents.csv": "id,file\nc,\"{\"\"url\"\":\"\"https://files.microcms-assets.io/assets/xxx/ghi/c.pdf\"\"}\"\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := collectReferencedMedia(baseDir)
+	if err != nil {
+		t.Fatalf("collectReferencedMedia() error = %v", err)
+	}
+	want := []Media{
+		{Url: "https://images.microcms-assets.io/assets/xxx/abc/a.png", Width: 200, Height: 100},
+		{Url: "https://images.microcms-assets.io/assets/xxx/def/b.png", Width: 40, Height: 30},
+		{Url: "https://files.microcms-assets.io/assets/xxx/ghi/c.pdf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectReferencedMedia() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCollectReferencedMediaWithoutContents(t *testing.T) {
+	_, err := collectReferencedMedia(t.TempDir() + "/")
+	if err == nil {
+		t.Errorf("collectReferencedMedia() error = nil, want error")
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// メディアの参照レポートのファイル名
+const mediaReferenceReportFileName = "media_report.json"
+
+// MediaReferenceReport はメディアとコンテンツの参照関係を突き合わせた結果
+type MediaReferenceReport struct {
+	// どのコンテンツからも参照されていないメディア
+	OrphanedMedia []MediaIndexEntry `json:"orphanedMedia"`
+	// メディア一覧に存在しないメディアを参照しているフィールド(エンドポイント、コンテンツIDごと)
+	BrokenReferences map[string]map[string][]BrokenMediaReference `json:"brokenReferences"`
+}
+
+// BrokenMediaReference は存在しないメディアへの参照
+type BrokenMediaReference struct {
+	Status string `json:"status"`
+	Field  string `json:"field"`
+	Url    string `json:"url"`
+}
+
+// newMediaReferenceReport はバックアップのmedia/index.jsonとcontents/以下を突き合わせてレポートを作成する
+func newMediaReferenceReport(baseDir string) (*MediaReferenceReport, error) {
+	b, err := os.ReadFile(baseDir + "media/index.json")
+	if err != nil {
+		return nil, err
+	}
+	var entries []MediaIndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	mediaURLs := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		mediaURLs[entry.Url] = true
+	}
+
+	report := &MediaReferenceReport{
+		OrphanedMedia:    []MediaIndexEntry{},
+		BrokenReferences: make(map[string]map[string][]BrokenMediaReference),
+	}
+	referenced := make(map[string]bool)
+	err = readBackupContents(baseDir, func(content backupContent) error {
+		for _, field := range content.Fields {
+			for _, mediaURL := range findMediaURLs(field.Value) {
+				referenced[mediaURL] = true
+				if mediaURLs[mediaURL] {
+					continue
+				}
+				if report.BrokenReferences[content.Endpoint] == nil {
+					report.BrokenReferences[content.Endpoint] = make(map[string][]BrokenMediaReference)
+				}
+				report.BrokenReferences[content.Endpoint][content.Id] = append(
+					report.BrokenReferences[content.Endpoint][content.Id],
+					BrokenMediaReference{Status: content.Status, Field: field.Key, Url: mediaURL},
+				)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !referenced[entry.Url] {
+			report.OrphanedMedia = append(report.OrphanedMedia, entry)
+		}
+	}
+	return report, nil
+}
+
+// writeMediaReferenceReport はメディアの参照レポートを作成し、バックアップディレクトリに保存する
+func writeMediaReferenceReport(baseDir string) error {
+	log.Println("メディアの参照レポートを作成します")
+
+	report, err := newMediaReferenceReport(baseDir)
+	if err != nil {
+		return err
+	}
+
+	brokenCount := 0
+	for _, contents := range report.BrokenReferences {
+		for _, references := range contents {
+			brokenCount += len(references)
+		}
+	}
+	log.Printf("参照されていないメディア: %d件, 存在しないメディアへの参照: %d件\n", len(report.OrphanedMedia), brokenCount)
+
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStringAtomic(baseDir+mediaReferenceReportFileName, string(b)+"\n")
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNewMediaReferenceReport(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	for _, dir := range []string{"contents/blogs/PUBLISH", "contents/blogs/DRAFT", "contents/news/PUBLISH", "media"} {
+		if err := os.MkdirAll(baseDir+dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"contents/blogs/PUBLISH/1.json":      `{"id":"a","eyecatch":{"url":"https://images.microcms-assets.io/assets/xxx/abc/used.png"}}`,
+		"contents/blogs/PUBLISH/1.meta.json": `{"id":"a","status":["PUBLISH"]}`,
+		"contents/blogs/DRAFT/1.json":        `{"id":"b","body":"<img src=\"https://images.microcms-assets.io/assets/xxx/zzz/deleted.png?w=10\">"}`,
+		"contents/news/PUBLISH/contents.csv": "id,file,_meta.status\nc,\"{\"\"url\"\":\"\"https://files.microcms-assets.io/assets/xxx/yyy/deleted.pdf\"\"}\",\"[\"\"PUBLISH\"\"]\"\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := []MediaIndexEntry{
+		{Id: "used", Url: "https://images.microcms-assets.io/assets/xxx/abc/used.png", LocalPath: "media/abc/used.png"},
+		{Id: "orphan", Url: "https://images.microcms-assets.io/assets/xxx/def/orphan.png", LocalPath: "media/def/orphan.png"},
+	}
+	if err := writeMediaIndex(baseDir, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := newMediaReferenceReport(baseDir)
+	if err != nil {
+		t.Fatalf("newMediaReferenceReport() error = %v", err)
+	}
+
+	if len(report.OrphanedMedia) != 1 || report.OrphanedMedia[0].Id != "orphan" {
+		t.Errorf("OrphanedMedia = %+v", report.OrphanedMedia)
+	}
+	want := map[string]map[string][]BrokenMediaReference{
+		"blogs": {
+			"b": {{Status: "DRAFT", Field: "body", Url: "https://images.microcms-assets.io/assets/xxx/zzz/deleted.png"}},
+		},
+		"news": {
+			"c": {{Status: "PUBLISH", Field: "file", Url: "https://files.microcms-assets.io/assets/xxx/yyy/deleted.pdf"}},
+		},
+	}
+	if !reflect.DeepEqual(report.BrokenReferences, want) {
+		t.Errorf("BrokenReferences = %+v, want %+v", report.BrokenReferences, want)
+	}
+
+	if err := writeMediaReferenceReport(baseDir); err != nil {
+		t.Fatalf("writeMediaReferenceReport() error = %v", err)
+	}
+	if _, err := os.Stat(baseDir + mediaReferenceReportFileName); err != nil {
+		t.Errorf("レポートが保存されていません: %v", err)
+	}
+}
@@ -1,92 +1,166 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
 	"testing"
-	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
 )
 
-func init() {
-	// Get the current working directory
-	wd, err := os.Getwd()
-	if err != nil {
-		panic("Error getting working directory")
-	}
-
-	// Get the project root directory (where go.mod is located)
-	projectRoot := filepath.Dir(wd)
-
-	// Load .env file from the project root
-	envPath := filepath.Join(projectRoot, ".env")
-	if err := godotenv.Load(envPath); err != nil {
-		panic("Error loading .env file: " + envPath)
-	}
-}
-
 func TestBackupMedia(t *testing.T) {
-	type args struct {
-		config  *Config
-		baseDir string
-	}
+	keys := testMockKeys()
 
-	mediaAPIKey := os.Getenv("MEDIA_API_KEY")
-	if mediaAPIKey == "" {
-		t.Skip("Media API key not set in environment variable")
+	// 1回の取得件数(100件)を超えるメディアで、トークンによるページ送りを確認する
+	var manyMedia []mockcms.Media
+	for i := range 101 {
+		manyMedia = append(manyMedia, mockcms.Media{Id: fmt.Sprintf("m%d", i), Path: fmt.Sprintf("dir%d/%d.txt", i, i), Data: []byte("data")})
 	}
 
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name     string
+		apiKey   string
+		media    []mockcms.Media
+		failures map[string]int
+		want     bool
+		// バックアップディレクトリからの相対パスと、その内容
+		wantFiles map[string]string
 	}{
 		{
-			name: "api key incorrect",
-			args: args{
-				config: &Config{
-					Target:    "media",
-					ServiceID: "backup-test",
-					Media: MediaConfig{
-						APIKey: "incorrectkey",
-					},
-				},
-				baseDir: "../backup/test/",
+			name:   "api key incorrect",
+			apiKey: "incorrectkey",
+			want:   false,
+		},
+		{
+			name:   "normal",
+			apiKey: keys.Media,
+			want:   true,
+			wantFiles: map[string]string{
+				"media/abc/a.png":     "png",
+				"media/def/日本語 名.txt": "text",
 			},
-			want: false,
 		},
 		{
-			name: "normal",
-			args: args{
-				config: &Config{
-					Target:    "media",
-					ServiceID: "backup-test",
-					Media: MediaConfig{
-						APIKey: mediaAPIKey,
-					},
-				},
-				baseDir: "../backup/test/",
+			name:   "token pagination",
+			apiKey: keys.Media,
+			media:  manyMedia,
+			want:   true,
+			wantFiles: map[string]string{
+				"media/dir0/0.txt":     "data",
+				"media/dir100/100.txt": "data",
+			},
+		},
+		{
+			name:   "no media",
+			apiKey: keys.Media,
+			media:  []mockcms.Media{},
+			want:   true,
+			wantFiles: map[string]string{
+				"media/index.json": "[]\n",
 			},
-			want: true,
+		},
+		{
+			name:     "download failed",
+			apiKey:   keys.Media,
+			failures: map[string]int{"/assets/abc/a.png": 500},
+			want:     false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			time.Sleep(5 * time.Second)
+			fixture := testMockFixture()
+			if tt.media != nil {
+				fixture.Media = tt.media
+			}
+			fixture.Failures = tt.failures
+			server := mockcms.NewServer(fixture)
+			defer server.Close()
 
-			client := Client{}
-			client.Config = tt.args.config
+			baseDir := t.TempDir() + "/"
+			client := newMockClient(server, &Config{
+				Target:    "media",
+				ServiceID: "backup-test",
+				Media: MediaConfig{
+					APIKey: tt.apiKey,
+				},
+			})
 
-			err := client.BackupMedia(tt.args.baseDir)
-			if err != nil {
-				fmt.Println(err)
-			}
+			err := client.BackupMedia(context.Background(), baseDir)
 			got := err == nil
 			if got != tt.want {
-				t.Errorf("backupMedia() = %v, want %v", got, tt.want)
+				t.Fatalf("backupMedia() = %v, want %v (error = %v)", got, tt.want, err)
+			}
+			for path, want := range tt.wantFiles {
+				b, err := os.ReadFile(baseDir + path)
+				if err != nil {
+					t.Errorf("%s が保存されていません: %v", path, err)
+					continue
+				}
+				if string(b) != want {
+					t.Errorf("%s = %s, want %s", path, b, want)
+				}
 			}
 		})
 	}
 }
+
+func TestBackupMediaResume(t *testing.T) {
+	keys := testMockKeys()
+	fixture := testMockFixture()
+	fixture.Failures = map[string]int{"/assets/def/日本語 名.txt": 500}
+	server := mockcms.NewServer(fixture)
+	defer server.Close()
+
+	baseDir := t.TempDir() + "/"
+	client := newMockClient(server, &Config{
+		Target:    "media",
+		ServiceID: "backup-test",
+		Media:     MediaConfig{APIKey: keys.Media},
+	})
+	if err := client.StartBackup(context.Background(), baseDir); err == nil {
+		t.Fatal("StartBackup() error = nil")
+	}
+
+	// 失敗した時点までにダウンロードしたメディアが、チェックポイントに保存されている
+	cp, err := LoadCheckpoint(baseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cp.isMediaDownloaded("m1") || cp.mediaContentType("m1") != "image/png" {
+		t.Fatalf("チェックポイント = %+v", cp)
+	}
+	if !client.CanResume(baseDir) {
+		t.Fatal("CanResume() = false, want true")
+	}
+
+	server.SetFailures(nil)
+	if err := client.StartBackup(context.Background(), baseDir); err != nil {
+		t.Fatalf("StartBackup() error = %v", err)
+	}
+
+	// ダウンロード済みのメディアは再開時にダウンロードしない
+	downloads := 0
+	for _, req := range server.Requests() {
+		if req.URI == "/assets/abc/a.png" {
+			downloads++
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("a.pngのダウンロード回数 = %d, want 1", downloads)
+	}
+
+	// 再開した場合も、中断しなかった場合と同じContent-Typeを記録する
+	b, err := os.ReadFile(baseDir + "media/index.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []MediaIndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ContentType != "image/png" || entries[1].ContentType != "text/plain" {
+		t.Errorf("index.json = %s", b)
+	}
+}
@@ -0,0 +1,559 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 移行の計画と進捗を保存するディレクトリ
+const migrateDirName = "migrate"
+
+// 移行先への書き込みの種類
+const (
+	// コンテンツの作成(PUT)
+	migrateActionCreate = "create"
+	// 後から書き込むコンテンツ参照の更新(PATCH)
+	migrateActionRelations = "relations"
+	// 公開中かつ下書き中のコンテンツの、下書きの内容の更新(PATCH)
+	migrateActionDraft = "draft"
+)
+
+// MigrateStep は移行先への1回の書き込み
+type MigrateStep struct {
+	Action string `json:"action"`
+	// 移行先のエンドポイント
+	Endpoint string `json:"endpoint"`
+	Id       string `json:"id"`
+	// 下書きとして書き込むかどうか
+	Draft bool `json:"draft"`
+	// 書き込みAPIに送るJSON
+	Body json.RawMessage `json:"body"`
+}
+
+// key は進捗の記録に使う、書き込みを特定する文字列
+func (s MigrateStep) key() string {
+	return s.Action + " " + s.Endpoint + "/" + s.Id
+}
+
+// FieldKindMismatch は移行元と移行先で種類が異なるフィールド
+type FieldKindMismatch struct {
+	Field  string `json:"field"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// SchemaMismatch はエンドポイントごとの、移行元と移行先のAPIスキーマの差異
+type SchemaMismatch struct {
+	Endpoint       string `json:"endpoint"`
+	TargetEndpoint string `json:"targetEndpoint"`
+	// 移行先にないため、移行しないフィールド
+	MissingFields []string `json:"missingFields,omitempty"`
+	// 移行元にないフィールド
+	ExtraFields []string `json:"extraFields,omitempty"`
+	// 移行先で必須だが、移行元にないフィールド
+	RequiredFields []string            `json:"requiredFields,omitempty"`
+	KindMismatches []FieldKindMismatch `json:"kindMismatches,omitempty"`
+}
+
+// MigratePlan は移行の計画
+type MigratePlan struct {
+	SchemaMismatches []SchemaMismatch `json:"schemaMismatches"`
+	// アップロードするメディアの件数
+	Media int `json:"media"`
+	// メディアのバックアップに含まれず、移行先のURLに置き換えられないメディアのURL
+	UnmappedMediaURLs []string `json:"unmappedMediaUrls"`
+	// 公開終了のため、下書きとして作成するコンテンツの件数
+	ClosedAsDraft int `json:"closedAsDraft"`
+	// バックアップにコンテンツがないエンドポイント
+	EmptyEndpoints []string `json:"emptyEndpoints,omitempty"`
+	// 移行元と移行先のどちらのAPIスキーマにもないため、移行しないバックアップのフィールド
+	UnknownFields []UnknownField `json:"unknownFields,omitempty"`
+	Steps         []MigrateStep  `json:"steps"`
+}
+
+// UnknownField はAPIスキーマにないバックアップのフィールド
+type UnknownField struct {
+	Endpoint string `json:"endpoint"`
+	Field    string `json:"field"`
+}
+
+// migrateEndpoint は移行するエンドポイントと、移行先のフィールドの種類
+type migrateEndpoint struct {
+	Source string
+	Target string
+	// 移行先のフィールドIDごとの種類
+	Kinds map[string]string
+	// 移行先で必須のフィールドID
+	Required []string
+	// 移行元のフィールドID
+	SourceFields []string
+	// 移行先のコンテンツ参照のフィールドのパス
+	Relations map[string]bool
+}
+
+// MigrationTarget はmigrateの設定から、移行先のサービスのクライアントを作成する
+func (c Client) MigrationTarget() *Client {
+	m := c.Config.Migrate
+	return &Client{Config: &Config{
+		ServiceID: m.ServiceID,
+		Contents: ContentsConfig{
+			GetContentsMetaDataAPIKey: m.GetContentsMetaDataAPIKey,
+			UpdateAPIKey:              m.WriteAPIKey,
+		},
+		Media: MediaConfig{
+			UploadAPIKey: m.UploadAPIKey,
+		},
+	}}
+}
+
+// Migrate はバックアップディレクトリのコンテンツとメディアを、移行先のサービスに書き込む
+// applyがfalseの場合は、計画とAPIスキーマの差異の表示のみを行う
+// 計画はmigrate/plan.jsonに保存し、書き込み済みのものはmigrate/progress.jsonに記録してスキップするため、中断した場合も再実行できる
+func (c Client) Migrate(ctx context.Context, target *Client, baseDir string, apply bool) error {
+	if target.Config.ServiceID == "" {
+		return errors.New("移行先のサービスIDをmigrate.serviceIdに設定してください")
+	}
+	if apply && target.Config.Contents.UpdateAPIKey == "" {
+		return errors.New("反映するには、migrate.writeAPIKeyを設定してください")
+	}
+
+	endpoints, mismatches, err := c.migrateEndpoints(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	files, err := listBackupMediaFiles(baseDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("メディアファイルの一覧の取得でエラーが発生しました: %w", err)
+	}
+	mapping, err := LoadMediaURLMapping(baseDir, target.Config.ServiceID)
+	if err != nil {
+		return fmt.Errorf("URLの対応表の読み込みでエラーが発生しました: %w", err)
+	}
+
+	plan, err := buildMigratePlan(baseDir, endpoints, mapping)
+	if err != nil {
+		return err
+	}
+	plan.SchemaMismatches = mismatches
+	plan.Media = max(len(files)-len(mapping), 0)
+	if err := writeMigratePlan(baseDir, plan); err != nil {
+		return fmt.Errorf("移行の計画の保存でエラーが発生しました: %w", err)
+	}
+	printMigratePlan(plan)
+
+	if !apply {
+		log.Println("計画の表示のみのため、移行先には書き込んでいません（書き込む場合は-applyを指定してください）")
+		return nil
+	}
+
+	// メディアをアップロードし直し、コンテンツのメディアURLを移行先のURLに置き換えてから書き込む
+	if plan.Media > 0 {
+		if target.Config.Media.UploadAPIKey == "" {
+			return errors.New("メディアを移行するには、migrate.uploadAPIKeyを設定してください")
+		}
+		if err := target.RestoreMedia(ctx, baseDir); err != nil {
+			return err
+		}
+		mapping, err = LoadMediaURLMapping(baseDir, target.Config.ServiceID)
+		if err != nil {
+			return fmt.Errorf("URLの対応表の読み込みでエラーが発生しました: %w", err)
+		}
+		plan, err = buildMigratePlan(baseDir, endpoints, mapping)
+		if err != nil {
+			return err
+		}
+		plan.SchemaMismatches = mismatches
+		if err := writeMigratePlan(baseDir, plan); err != nil {
+			return fmt.Errorf("移行の計画の保存でエラーが発生しました: %w", err)
+		}
+	}
+
+	return target.applyMigratePlan(ctx, baseDir, plan)
+}
+
+// migrateEndpoints は移行元と移行先のAPIスキーマを取得し、移行するエンドポイントと差異を返す
+func (c Client) migrateEndpoints(ctx context.Context, target *Client) ([]migrateEndpoint, []SchemaMismatch, error) {
+	var endpoints []migrateEndpoint
+	var mismatches []SchemaMismatch
+	for _, endpoint := range c.Config.Contents.Endpoints {
+		targetName := endpoint.Name
+		if name, ok := c.Config.Migrate.Endpoints[endpoint.Name]; ok {
+			targetName = name
+		}
+
+		sourceFields, err := c.getAPIFields(ctx, endpoint.Name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%sのAPIスキーマの取得でエラーが発生しました: %w", endpoint.Name, err)
+		}
+		targetSchema, err := target.getAPISchema(ctx, targetName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("移行先の%sのAPIスキーマの取得でエラーが発生しました: %w", targetName, err)
+		}
+		targetFields := targetSchema.APIFields
+
+		e := migrateEndpoint{Source: endpoint.Name, Target: targetName, Kinds: make(map[string]string, len(targetFields)), Relations: targetSchema.relationPaths()}
+		for _, field := range sourceFields {
+			e.SourceFields = append(e.SourceFields, field.FieldId)
+		}
+		for _, field := range targetFields {
+			e.Kinds[field.FieldId] = field.Kind
+			if field.Required {
+				e.Required = append(e.Required, field.FieldId)
+			}
+		}
+		endpoints = append(endpoints, e)
+
+		if mismatch := compareSchemas(endpoint.Name, targetName, sourceFields, targetFields); mismatch != nil {
+			mismatches = append(mismatches, *mismatch)
+		}
+	}
+	return endpoints, mismatches, nil
+}
+
+// compareSchemas は移行元と移行先のフィールドを比較し、差異がない場合はnilを返す
+func compareSchemas(source, target string, sourceFields, targetFields []APIField) *SchemaMismatch {
+	mismatch := SchemaMismatch{Endpoint: source, TargetEndpoint: target}
+	for _, field := range sourceFields {
+		i := slices.IndexFunc(targetFields, func(f APIField) bool { return f.FieldId == field.FieldId })
+		if i < 0 {
+			mismatch.MissingFields = append(mismatch.MissingFields, field.FieldId)
+			continue
+		}
+		if targetFields[i].Kind != field.Kind {
+			mismatch.KindMismatches = append(mismatch.KindMismatches, FieldKindMismatch{Field: field.FieldId, Source: field.Kind, Target: targetFields[i].Kind})
+		}
+	}
+	for _, field := range targetFields {
+		if slices.ContainsFunc(sourceFields, func(f APIField) bool { return f.FieldId == field.FieldId }) {
+			continue
+		}
+		mismatch.ExtraFields = append(mismatch.ExtraFields, field.FieldId)
+		if field.Required {
+			mismatch.RequiredFields = append(mismatch.RequiredFields, field.FieldId)
+		}
+	}
+
+	if mismatch.MissingFields == nil && mismatch.ExtraFields == nil && mismatch.KindMismatches == nil {
+		return nil
+	}
+	return &mismatch
+}
+
+// migrateVersions は同じIDのコンテンツの、ステータスごとの内容
+type migrateVersions struct {
+	publish, draft, closed *backupContent
+}
+
+// buildMigratePlan はバックアップしたコンテンツを移行先のAPIスキーマに合わせて変換し、書き込みの計画を組み立てる
+// 書き込みは、すべてのコンテンツの作成、コンテンツ参照の更新、下書きの内容の更新の順とする
+// 変換に失敗したコンテンツがある場合は、すべてのエラーをまとめて返す
+// XLSX形式などコンテンツを読み込めないバックアップや、flattenで展開したCSVの場合もエラーとする
+func buildMigratePlan(baseDir string, endpoints []migrateEndpoint, mapping map[string]string) (*MigratePlan, error) {
+	if _, err := os.Stat(baseDir + xlsxFileName); err == nil {
+		return nil, errors.New("XLSX形式のバックアップは移行できません")
+	}
+
+	// エンドポイントごとに、同じIDのコンテンツをまとめる
+	versions := make(map[string]map[string]*migrateVersions)
+	// エンドポイントとステータスごとの、バックアップした順のID
+	statusIds := make(map[string]map[string][]string)
+	err := readBackupContents(baseDir, func(content backupContent) error {
+		if versions[content.Endpoint] == nil {
+			versions[content.Endpoint] = make(map[string]*migrateVersions)
+			statusIds[content.Endpoint] = make(map[string][]string)
+		}
+		v, ok := versions[content.Endpoint][content.Id]
+		if !ok {
+			v = &migrateVersions{}
+			versions[content.Endpoint][content.Id] = v
+		}
+		statusIds[content.Endpoint][content.Status] = append(statusIds[content.Endpoint][content.Status], content.Id)
+		switch content.Status {
+		case "PUBLISH":
+			v.publish = &content
+		case "DRAFT":
+			v.draft = &content
+		case "CLOSED":
+			v.closed = &content
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("コンテンツの読み込みでエラーが発生しました: %w", err)
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("バックアップからコンテンツを読み込めませんでした")
+	}
+
+	// メディアのバックアップに含まれるURLは、アップロード後に移行先のURLに置き換えられる
+	indexURLs, err := loadMediaURLsByLocalPath(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("メディア一覧の読み込みでエラーが発生しました: %w", err)
+	}
+	backedUp := make(map[string]bool, len(indexURLs))
+	for _, url := range indexURLs {
+		backedUp[url] = true
+	}
+
+	plan := &MigratePlan{UnmappedMediaURLs: []string{}, Steps: []MigrateStep{}}
+	var relations, drafts []MigrateStep
+	var errs []error
+	convert := func(e migrateEndpoint, content *backupContent) ([]importField, []importField) {
+		var fields, deferred []importField
+		for _, field := range content.Fields {
+			kind := e.Kinds[field.Key]
+			if slices.Contains(systemFields, field.Key) {
+				continue
+			}
+			if kind == "" {
+				// 移行元のAPIスキーマにあるフィールドは、APIスキーマの差異として表示する
+				unknown := UnknownField{Endpoint: e.Source, Field: field.Key}
+				if !slices.Contains(e.SourceFields, field.Key) && !slices.Contains(plan.UnknownFields, unknown) {
+					plan.UnknownFields = append(plan.UnknownFields, unknown)
+					if strings.ContainsAny(field.Key, ".[") {
+						errs = append(errs, fmt.Errorf("%s: 展開されたカラムには対応していません（flattenを無効にして保存したバックアップを使用してください）: %s", e.Source, field.Key))
+					}
+				}
+				continue
+			}
+			cell := rewriteMediaURLs(field.Value, mapping, func(url string) {
+				if !backedUp[url] && !slices.Contains(plan.UnmappedMediaURLs, url) {
+					plan.UnmappedMediaURLs = append(plan.UnmappedMediaURLs, url)
+				}
+			})
+			fieldRelations := subFieldPaths(e.Relations, field.Key)
+			value, err := importCellValue(kind, cell, fieldRelations)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s/%s %s: %w", e.Source, content.Id, field.Key, err))
+				continue
+			}
+			if value == nil {
+				continue
+			}
+			f := importField{Key: field.Key, Kind: kind, Value: value, Relations: fieldRelations}
+			// 参照先がまだ作成されていない場合があるため、必須でないコンテンツ参照は作成後に書き込む
+			if (kind == "relation" || kind == "relationList") && !slices.Contains(e.Required, field.Key) {
+				deferred = append(deferred, f)
+				continue
+			}
+			fields = append(fields, f)
+		}
+		return fields, deferred
+	}
+
+	for _, e := range endpoints {
+		if len(versions[e.Source]) == 0 {
+			plan.EmptyEndpoints = append(plan.EmptyEndpoints, e.Source)
+			continue
+		}
+		// 公開中、下書き、公開終了の順に作成する
+		var ids []string
+		for _, status := range []string{"PUBLISH", "DRAFT", "CLOSED"} {
+			for _, id := range statusIds[e.Source][status] {
+				if !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+		}
+		for _, id := range ids {
+			v := versions[e.Source][id]
+			base, draft := v.publish, false
+			switch {
+			case base != nil:
+			case v.draft != nil:
+				base, draft = v.draft, true
+			default:
+				// 公開終了の状態は書き込みAPIで作成できないため、下書きとする
+				base, draft = v.closed, true
+				plan.ClosedAsDraft++
+			}
+
+			fields, deferred := convert(e, base)
+			plan.Steps = append(plan.Steps, MigrateStep{Action: migrateActionCreate, Endpoint: e.Target, Id: id, Draft: draft, Body: migrateFieldsJSON(fields)})
+			if len(deferred) > 0 {
+				relations = append(relations, MigrateStep{Action: migrateActionRelations, Endpoint: e.Target, Id: id, Draft: draft, Body: migrateFieldsJSON(deferred)})
+			}
+
+			// 公開中かつ下書き中の場合は、公開中の内容で作成した後に下書きの内容を書き込む
+			if v.publish != nil && v.draft != nil {
+				fields, deferred := convert(e, v.draft)
+				drafts = append(drafts, MigrateStep{Action: migrateActionDraft, Endpoint: e.Target, Id: id, Draft: true, Body: migrateFieldsJSON(append(fields, deferred...))})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	plan.Steps = append(plan.Steps, relations...)
+	plan.Steps = append(plan.Steps, drafts...)
+	return plan, nil
+}
+
+// rewriteMediaURLs はテキストに含まれるメディアURLを、対応表の移行先のURLに置き換える
+// 画像変換などのクエリ文字列はそのまま残し、対応表にないURLはunmappedを呼び出して変更しない
+func rewriteMediaURLs(text string, mapping map[string]string, unmapped func(url string)) string {
+	return mediaURLPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := mediaURLPattern.FindStringSubmatch(match)
+		newURL, ok := mapping[m[1]]
+		if !ok {
+			unmapped(m[1])
+			return match
+		}
+		return newURL + m[2]
+	})
+}
+
+// migrateFieldsJSON はフィールドをバックアップの順序のままJSONにする
+func migrateFieldsJSON(fields []importField) json.RawMessage {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		k, _ := json.Marshal(field.Key)
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(field.Value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes()
+}
+
+func writeMigratePlan(baseDir string, plan *MigratePlan) error {
+	if err := os.MkdirAll(baseDir+migrateDirName, os.ModePerm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStringAtomic(baseDir+migrateDirName+"/plan.json", string(b)+"\n")
+}
+
+// printMigratePlan は計画の概要とAPIスキーマの差異を表示する
+func printMigratePlan(plan *MigratePlan) {
+	for _, m := range plan.SchemaMismatches {
+		fmt.Printf("APIスキーマの差異: %s -> %s\n", m.Endpoint, m.TargetEndpoint)
+		for _, field := range m.MissingFields {
+			fmt.Printf("  %s: 移行先にないため移行しません\n", field)
+		}
+		for _, field := range m.ExtraFields {
+			if slices.Contains(m.RequiredFields, field) {
+				fmt.Printf("  %s: 移行先で必須ですが、移行元にありません\n", field)
+				continue
+			}
+			fmt.Printf("  %s: 移行元にありません\n", field)
+		}
+		for _, k := range m.KindMismatches {
+			fmt.Printf("  %s: 種類が異なります（%s -> %s）\n", k.Field, k.Source, k.Target)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, step := range plan.Steps {
+		counts[step.Action]++
+	}
+	log.Printf("作成するコンテンツ: %d件 / コンテンツ参照の更新: %d件 / 下書きの内容の更新: %d件 / アップロードするメディア: %d件\n",
+		counts[migrateActionCreate], counts[migrateActionRelations], counts[migrateActionDraft], plan.Media)
+	if plan.ClosedAsDraft > 0 {
+		log.Printf("公開終了の%d件のコンテンツは、下書きとして作成します\n", plan.ClosedAsDraft)
+	}
+	if len(plan.UnmappedMediaURLs) > 0 {
+		log.Printf("メディアのバックアップに含まれないため、移行元のURLのまま書き込むメディア: %d件\n", len(plan.UnmappedMediaURLs))
+	}
+	for _, endpoint := range plan.EmptyEndpoints {
+		log.Printf("%sはバックアップにコンテンツがないため、移行しません\n", endpoint)
+	}
+	for _, field := range plan.UnknownFields {
+		log.Printf("%sの%sはAPIスキーマにないため、移行しません\n", field.Endpoint, field.Field)
+	}
+}
+
+// applyMigratePlan は計画の書き込みを順に行う
+func (c Client) applyMigratePlan(ctx context.Context, baseDir string, plan *MigratePlan) error {
+	progressPath := baseDir + migrateDirName + "/progress.json"
+	var done []string
+	b, err := os.ReadFile(progressPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &done); err != nil {
+			return fmt.Errorf("移行の進捗の読み込みでエラーが発生しました: %w", err)
+		}
+	}
+
+	written := 0
+	for i, step := range plan.Steps {
+		// 進捗状況の表示
+		fmt.Printf("[%d / %d] %s\n", i+1, len(plan.Steps), step.key())
+
+		if slices.Contains(done, step.key()) {
+			continue
+		}
+		if written > 0 {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
+		}
+
+		method := http.MethodPatch
+		if step.Action == migrateActionCreate {
+			method = http.MethodPut
+		}
+		if err := c.writeContent(ctx, method, step.Endpoint, step.Id, step.Draft, step.Body); err != nil {
+			return fmt.Errorf("%sの書き込みでエラーが発生しました: %w", step.key(), err)
+		}
+		written++
+
+		// 中断した場合に同じコンテンツを重複して作成しないよう、1件ごとに保存する
+		done = append(done, step.key())
+		b, err := json.MarshalIndent(done, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeStringAtomic(progressPath, string(b)+"\n"); err != nil {
+			return fmt.Errorf("移行の進捗の保存でエラーが発生しました: %w", err)
+		}
+	}
+
+	log.Println("正常に移行が終了しました")
+	return nil
+}
+
+// writeContent は書き込みAPIでコンテンツを作成(PUT)・更新(PATCH)する
+// draftがtrueの場合は下書きとして書き込む
+func (c Client) writeContent(ctx context.Context, method, endpoint, id string, draft bool, body []byte) error {
+	url := fmt.Sprintf("%s/v1/%s/%s", c.contentsAPIURL(), endpoint, id)
+	if draft {
+		url += "?status=draft"
+	}
+	req, _ := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	req.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.UpdateAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := new(http.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ステータスコード:%d 正常に書き込めませんでした: %s", resp.StatusCode, b)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
+	"github.com/tidwall/gjson"
+)
+
+func TestMigrate(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	for _, dir := range []string{"contents/blogs/PUBLISH", "contents/blogs/DRAFT", "contents/blogs/CLOSED", "contents/categories/PUBLISH", "media/abc"} {
+		if err := os.MkdirAll(baseDir+dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"contents/blogs/PUBLISH/1.json": `{"id":"a","createdAt":"2024-01-01T00:00:00.000Z","title":"公開中","category":{"id":"news","createdAt":"2024-01-01T00:00:00.000Z","name":"ニュース"},` +
+			`"eyecatch":{"url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","width":10,"height":20},` +
+			`"body":"<img src=\"https://images.microcms-assets.io/assets/xxx/abc/a.png?w=100\"><img src=\"https://images.microcms-assets.io/assets/xxx/zzz/missing.png\">","legacy":"旧フィールド"}`,
+		"contents/blogs/PUBLISH/2.json":      `{"id":"b","title":"公開中の内容","note":"スキーマにないフィールド"}`,
+		"contents/blogs/DRAFT/1.json":        `{"id":"b","title":"下書きの内容"}`,
+		"contents/blogs/CLOSED/1.json":       `{"id":"d","title":"公開終了"}`,
+		"contents/categories/PUBLISH/1.json": `{"id":"news","name":"ニュース"}`,
+		"media/abc/a.png":                    "png",
+		"media/index.json":                   `[{"id":"m1","url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","localPath":"media/abc/a.png"}]`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := testMockKeys()
+	source := mockcms.NewServer(mockcms.Fixture{
+		Keys: keys,
+		Schemas: map[string]string{
+			"blogs":      `[{"fieldId":"title","kind":"text"},{"fieldId":"category","kind":"relation"},{"fieldId":"eyecatch","kind":"media"},{"fieldId":"body","kind":"richEditorV2"},{"fieldId":"legacy","kind":"text"}]`,
+			"categories": `[{"fieldId":"name","kind":"text"}]`,
+		},
+	})
+	defer source.Close()
+	target := mockcms.NewServer(mockcms.Fixture{
+		Keys:     keys,
+		Contents: map[string][]mockcms.Content{"posts": {}, "categories": {}},
+		Schemas: map[string]string{
+			"posts":      `[{"fieldId":"title","kind":"text"},{"fieldId":"category","kind":"relation"},{"fieldId":"eyecatch","kind":"media"},{"fieldId":"body","kind":"richEditorV2"},{"fieldId":"summary","kind":"textArea","required":true}]`,
+			"categories": `[{"fieldId":"name","kind":"text"}]`,
+		},
+	})
+	defer target.Close()
+
+	client := newMockClient(source, &Config{
+		ServiceID: "source",
+		Contents: ContentsConfig{
+			GetContentsMetaDataAPIKey: keys.MetaData,
+			Endpoints:                 []Endpoint{{Name: "blogs"}, {Name: "categories"}},
+		},
+		Migrate: MigrateConfig{
+			ServiceID:                 "target",
+			GetContentsMetaDataAPIKey: keys.MetaData,
+			WriteAPIKey:               keys.Update,
+			UploadAPIKey:              keys.Upload,
+			Endpoints:                 map[string]string{"blogs": "posts"},
+		},
+	})
+	migrationTarget := client.MigrationTarget()
+	migrationTarget.ContentsAPIBaseURL = target.ContentsAPIBaseURL()
+	migrationTarget.ManagementAPIBaseURL = target.ManagementAPIBaseURL()
+
+	// 計画の表示のみでは、移行先に書き込まない
+	if err := client.Migrate(context.Background(), migrationTarget, baseDir, false); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for _, req := range target.Requests() {
+		if req.Method != "GET" {
+			t.Errorf("計画の表示のみで書き込みました: %s %s", req.Method, req.URI)
+		}
+	}
+
+	b, err := os.ReadFile(baseDir + "migrate/plan.json")
+	if err != nil {
+		t.Fatalf("計画が保存されていません: %v", err)
+	}
+	var plan MigratePlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		t.Fatal(err)
+	}
+	wantMismatches := []SchemaMismatch{{
+		Endpoint:       "blogs",
+		TargetEndpoint: "posts",
+		MissingFields:  []string{"legacy"},
+		ExtraFields:    []string{"summary"},
+		RequiredFields: []string{"summary"},
+	}}
+	if !reflect.DeepEqual(plan.SchemaMismatches, wantMismatches) {
+		t.Errorf("SchemaMismatches = %+v, want %+v", plan.SchemaMismatches, wantMismatches)
+	}
+	if want := []UnknownField{{Endpoint: "blogs", Field: "note"}}; !reflect.DeepEqual(plan.UnknownFields, want) {
+		t.Errorf("UnknownFields = %+v, want %+v", plan.UnknownFields, want)
+	}
+	var steps []string
+	for _, step := range plan.Steps {
+		steps = append(steps, step.key())
+	}
+	wantSteps := []string{"create posts/a", "create posts/b", "create posts/d", "create categories/news", "relations posts/a", "draft posts/b"}
+	if !reflect.DeepEqual(steps, wantSteps) {
+		t.Errorf("Steps = %v, want %v", steps, wantSteps)
+	}
+	if plan.Media != 1 || plan.ClosedAsDraft != 1 || !reflect.DeepEqual(plan.UnmappedMediaURLs, []string{"https://images.microcms-assets.io/assets/xxx/zzz/missing.png"}) {
+		t.Errorf("Media, ClosedAsDraft, UnmappedMediaURLs = %d, %d, %v", plan.Media, plan.ClosedAsDraft, plan.UnmappedMediaURLs)
+	}
+
+	// 書き込み
+	if err := client.Migrate(context.Background(), migrationTarget, baseDir, true); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	media := target.MediaFiles()
+	if len(media) != 1 || string(media[0].Data) != "png" {
+		t.Fatalf("アップロードされたメディア = %+v", media)
+	}
+	newURL := target.MediaURL(media[0].Path)
+	if _, err := os.Stat(mediaURLMappingPath(baseDir, migrationTarget.Config.ServiceID)); err != nil {
+		t.Errorf("移行先のサービスの対応表が保存されていません: %v", err)
+	}
+
+	posts := make(map[string]mockcms.Content)
+	for _, content := range target.Contents("posts") {
+		posts[gjson.Get(content.Body, "id").String()] = content
+	}
+	a := posts["a"]
+	if a.Status != "PUBLISH" {
+		t.Errorf("a.Status = %s, want PUBLISH", a.Status)
+	}
+	for path, want := range map[string]string{"title": "公開中", "category": "news", "eyecatch": newURL} {
+		if got := gjson.Get(a.Body, path).String(); got != want {
+			t.Errorf("a.%s = %s, want %s", path, got, want)
+		}
+	}
+	if body := gjson.Get(a.Body, "body").String(); !strings.Contains(body, newURL+"?w=100") || !strings.Contains(body, "zzz/missing.png") {
+		t.Errorf("a.body のメディアURLが置き換えられていません: %s", body)
+	}
+	if gjson.Get(a.Body, "legacy").Exists() || gjson.Get(a.Body, "createdAt").Exists() {
+		t.Errorf("移行先にないフィールドが書き込まれました: %s", a.Body)
+	}
+	if b := posts["b"]; b.Status != "PUBLISH_AND_DRAFT" || gjson.Get(b.Body, "title").String() != "公開中の内容" || gjson.Get(b.DraftBody, "title").String() != "下書きの内容" {
+		t.Errorf("b = %+v", b)
+	}
+	if d := posts["d"]; d.Status != "DRAFT" {
+		t.Errorf("d.Status = %s, want DRAFT", d.Status)
+	}
+	if categories := target.Contents("categories"); len(categories) != 1 {
+		t.Errorf("categories = %+v", categories)
+	}
+
+	// 再実行した場合は、書き込み済みのものをスキップする
+	written := len(target.Requests())
+	if err := client.Migrate(context.Background(), migrationTarget, baseDir, true); err != nil {
+		t.Fatalf("再実行の Migrate() error = %v", err)
+	}
+	for _, req := range target.Requests()[written:] {
+		if req.Method != "GET" {
+			t.Errorf("再実行で書き込みました: %s %s", req.Method, req.URI)
+		}
+	}
+}
+
+func TestBuildMigratePlanErrors(t *testing.T) {
+	endpoints := []migrateEndpoint{{Source: "blogs", Target: "blogs", Kinds: map[string]string{"title": "text", "category": "relation"}, SourceFields: []string{"title", "category"}}}
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "XLSX形式",
+			files: map[string]string{"contents.xlsx": "", "contents/.keep": ""},
+			want:  "XLSX形式のバックアップは移行できません",
+		},
+		{
+			name:  "コンテンツがない",
+			files: map[string]string{"contents/blogs/PUBLISH/contents.csv": "id,title\n"},
+			want:  "バックアップからコンテンツを読み込めませんでした",
+		},
+		{
+			name:  "展開されたカラム",
+			files: map[string]string{"contents/blogs/PUBLISH/contents.csv": "id,title,category.id\na,タイトル,news\n"},
+			want:  "展開されたカラムには対応していません（flattenを無効にして保存したバックアップを使用してください）: category.id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseDir := t.TempDir() + "/"
+			for path, content := range tt.files {
+				if err := os.MkdirAll(filepath.Dir(baseDir+path), os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := buildMigratePlan(baseDir, endpoints, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("buildMigratePlan() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
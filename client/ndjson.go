@@ -0,0 +1,197 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NDJSON形式で保存する場合のファイル名
+const ndjsonFileName = "contents.ndjson"
+
+// gzip圧縮したファイルに付与する拡張子
+const gzipExt = ".gz"
+
+// contentsFormat は設定からコンテンツの保存形式("json", "csv", "ndjson")を返す
+// formatを省略した場合は、saveAsCSVに従う
+func (c Client) contentsFormat() string {
+	if c.Config.Contents.Format != "" {
+		return c.Config.Contents.Format
+	}
+	if c.Config.Contents.SaveAsCSV {
+		return "csv"
+	}
+	return "json"
+}
+
+// ndjsonFile は書き込み途中のNDJSONファイル
+type ndjsonFile struct {
+	path string
+	tmp  *os.File
+	gz   *gzip.Writer
+	w    *bufio.Writer
+}
+
+// ndjsonWriter はエンドポイント・ステータスごとのNDJSONファイルに、コンテンツを1行ずつ書き込む
+// 取得したページごとに書き込み、すべて書き終えてからcommitで保存先にリネームする
+// 中断・失敗した場合は一時ファイルのみが残り、次回の実行時に削除される
+type ndjsonWriter struct {
+	gzip  bool
+	files map[string]*ndjsonFile
+}
+
+func newNDJSONWriter(gzip bool) *ndjsonWriter {
+	return &ndjsonWriter{gzip: gzip, files: make(map[string]*ndjsonFile)}
+}
+
+// write はdir/nameのファイルにJSON文字列を1行として追記する
+// キーの順序はそのまま保持し、改行を含まないよう圧縮する
+func (n *ndjsonWriter) write(dir, name, raw string) error {
+	path := filepath.Join(dir, name)
+	if n.gzip {
+		path += gzipExt
+	}
+
+	f, ok := n.files[path]
+	if !ok {
+		tmp, err := os.CreateTemp(dir, tempFilePrefix+filepath.Base(path)+"-*")
+		if err != nil {
+			return err
+		}
+		f = &ndjsonFile{path: path, tmp: tmp}
+		if n.gzip {
+			f.gz = gzip.NewWriter(tmp)
+			f.w = bufio.NewWriter(f.gz)
+		} else {
+			f.w = bufio.NewWriter(tmp)
+		}
+		n.files[path] = f
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(raw)); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := f.w.Write(buf.Bytes())
+	return err
+}
+
+// commit は書き込んだすべてのファイルを閉じて、保存先にリネームする
+func (n *ndjsonWriter) commit() error {
+	for path, f := range n.files {
+		err := f.w.Flush()
+		if err == nil && f.gz != nil {
+			err = f.gz.Close()
+		}
+		if err == nil {
+			err = f.tmp.Sync()
+		}
+		if err == nil {
+			err = f.tmp.Chmod(0644)
+		}
+		if closeErr := f.tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.tmp.Name(), path)
+		}
+		if err != nil {
+			n.discard()
+			return err
+		}
+		delete(n.files, path)
+	}
+	return nil
+}
+
+// discard は書き込み途中のファイルを削除する
+// commitした後に呼び出しても何もしない
+func (n *ndjsonWriter) discard() {
+	for path, f := range n.files {
+		f.tmp.Close()
+		os.Remove(f.tmp.Name())
+		delete(n.files, path)
+	}
+}
+
+// writeContentNDJSON はコンテンツ参照の保存形式に応じて、コンテンツをcontents.ndjson(とcontents.expanded.ndjson)に書き込む
+func (c Client) writeContentNDJSON(n *ndjsonWriter, endpoint, dir, itemRaw string) error {
+	if c.storesRelationIDs() {
+		if c.keepsExpandedRelations() {
+			err := n.write(dir, "contents.expanded.ndjson", itemRaw)
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		itemRaw, err = c.compactRelationsIn(endpoint, dir, itemRaw)
+		if err != nil {
+			return err
+		}
+	}
+	return n.write(dir, ndjsonFileName, itemRaw)
+}
+
+// isNDJSONFile はファイル名がコンテンツのNDJSONファイル(gzip圧縮を含む)かどうかを返す
+func isNDJSONFile(name string) bool {
+	return name == ndjsonFileName || name == ndjsonFileName+gzipExt
+}
+
+// readNDJSON はNDJSONファイルを1行ずつ読み込む
+// 拡張子が.gzの場合は展開して読み込む
+func readNDJSON(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, gzipExt) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	scanner := bufio.NewScanner(r)
+	// リッチエディタなどで1行が長くなるため、上限を大きくする
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readMaybeGzipFile はファイルを読み込む
+// 拡張子が.gzの場合は展開した内容を返す
+func readMaybeGzipFile(path string) ([]byte, error) {
+	if !strings.HasSuffix(path, gzipExt) {
+		return os.ReadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
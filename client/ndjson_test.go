@@ -0,0 +1,131 @@
+package client
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestContentsFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents ContentsConfig
+		want     string
+	}{
+		{name: "省略時はJSON", contents: ContentsConfig{}, want: "json"},
+		{name: "saveAsCSV", contents: ContentsConfig{SaveAsCSV: true}, want: "csv"},
+		{name: "formatを優先", contents: ContentsConfig{SaveAsCSV: true, Format: "ndjson"}, want: "ndjson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Client{Config: &Config{Contents: tt.contents}}
+			if got := c.contentsFormat(); got != tt.want {
+				t.Errorf("contentsFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	for _, gzip := range []bool{false, true} {
+		t.Run(map[bool]string{false: "plain", true: "gzip"}[gzip], func(t *testing.T) {
+			baseDir := t.TempDir() + "/"
+			c := Client{
+				Config:         &Config{Contents: ContentsConfig{Relations: "both"}},
+				relationFields: testRelationFields(map[string][]string{"blogs": {"category"}}),
+			}
+			n := newNDJSONWriter(gzip)
+			defer n.discard()
+
+			dir, err := makeSaveDir(baseDir, "blogs", "PUBLISH", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := []string{
+				"{\n  \"id\": \"a\",\n  \"title\": \"改行\\nを含む\",\n  \"category\": {\"id\": \"cat1\", \"createdAt\": \"2024-01-01T00:00:00.000Z\"}\n}",
+				`{"id":"b","title":"b"}`,
+			}
+			for _, item := range items {
+				if err := c.writeContentNDJSON(n, "blogs", dir, item); err != nil {
+					t.Fatalf("writeContentNDJSON() error = %v", err)
+				}
+			}
+
+			// commitするまでは保存先にファイルが存在しない
+			var got []backupContent
+			err = readBackupContents(baseDir, func(content backupContent) error {
+				got = append(got, content)
+				return nil
+			})
+			if err != nil || len(got) != 0 {
+				t.Fatalf("readBackupContents() before commit = %v, %v", got, err)
+			}
+
+			if err := n.commit(); err != nil {
+				t.Fatalf("commit() error = %v", err)
+			}
+
+			err = readBackupContents(baseDir, func(content backupContent) error {
+				got = append(got, content)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("readBackupContents() error = %v", err)
+			}
+			// 展開済みの内容がある場合は、そちらを読み込む
+			want := []backupContent{
+				{Endpoint: "blogs", Status: "PUBLISH", Id: "a", Fields: []backupField{{"id", "a"}, {"title", "改行\nを含む"}, {"category", `{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"}`}}, Raw: `{"id":"a","title":"改行\nを含む","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"}}`},
+				{Endpoint: "blogs", Status: "PUBLISH", Id: "b", Fields: []backupField{{"id", "b"}, {"title", "b"}}, Raw: `{"id":"b","title":"b"}`},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("readBackupContents() = %v, want %v", got, want)
+			}
+
+			// IDで置き換えた内容と展開済みの内容が、それぞれ1行ずつ保存される
+			wantFiles := map[string][]string{
+				ndjsonFileName: {
+					`{"id":"a","title":"改行\nを含む","category":"cat1"}`,
+					`{"id":"b","title":"b"}`,
+				},
+				"contents.expanded.ndjson": {
+					`{"id":"a","title":"改行\nを含む","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"}}`,
+					`{"id":"b","title":"b"}`,
+				},
+			}
+			for name, wantLines := range wantFiles {
+				path := dir + "/" + name
+				if gzip {
+					path += gzipExt
+				}
+				var lines []string
+				err = readNDJSON(path, func(line []byte) error {
+					lines = append(lines, string(line))
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("readNDJSON() error = %v", err)
+				}
+				if !reflect.DeepEqual(lines, wantLines) {
+					t.Errorf("%s lines = %v, want %v", name, lines, wantLines)
+				}
+			}
+		})
+	}
+}
+
+func TestNDJSONWriterDiscard(t *testing.T) {
+	dir := t.TempDir()
+	n := newNDJSONWriter(false)
+	if err := n.write(dir, ndjsonFileName, `{"id":"a"}`); err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	n.discard()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files remain after discard: %v", entries)
+	}
+}
@@ -0,0 +1,342 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 通知の送信にかける時間の上限
+const notifyTimeout = 30 * time.Second
+
+// BackupReport はバックアップの結果
+type BackupReport struct {
+	ServiceID       string    `json:"serviceId"`
+	BackupDir       string    `json:"backupDir"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	StartedAt       time.Time `json:"startedAt"`
+	FinishedAt      time.Time `json:"finishedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// エンドポイントごとの保存したコンテンツの件数(targetがmediaの場合は空)
+	Endpoints []EndpointReport `json:"endpoints"`
+	// 保存したメディアの件数と合計サイズ(targetがcontentsの場合は空)
+	Media *MediaReport `json:"media,omitempty"`
+}
+
+// EndpointReport はエンドポイントごとの保存したコンテンツの件数
+type EndpointReport struct {
+	Endpoint string `json:"endpoint"`
+	Total    int    `json:"total"`
+	// ステータスごとの件数
+	Statuses map[string]int `json:"statuses"`
+}
+
+// MediaReport は保存したメディアの件数と合計サイズ
+type MediaReport struct {
+	Count     int   `json:"count"`
+	TotalSize int64 `json:"totalSize"`
+}
+
+// validate は通知の設定を検証する
+func (cfg NotifyConfig) validate() error {
+	for i, webhook := range cfg.Webhooks {
+		if webhook.URL == "" {
+			return fmt.Errorf("notify.webhooks[%d]: urlを指定してください", i)
+		}
+		switch webhook.Format {
+		case "", "json", "slack":
+		default:
+			return fmt.Errorf("notify.webhooks[%d]: 不明な通知の形式が選択されました: %s", i, webhook.Format)
+		}
+	}
+	if cfg.Email.Host != "" && (cfg.Email.From == "" || len(cfg.Email.To) == 0) {
+		return errors.New("notify.email: 送信元(from)と送信先(to)を指定してください")
+	}
+	return nil
+}
+
+// newBackupReport はバックアップディレクトリに保存された内容から、バックアップの結果を作成する
+// 失敗した場合も、それまでに保存した件数を数える
+func (c Client) newBackupReport(baseDir string, startedAt, finishedAt time.Time, backupErr error) BackupReport {
+	report := BackupReport{
+		ServiceID:       c.Config.ServiceID,
+		BackupDir:       baseDir,
+		Success:         backupErr == nil,
+		StartedAt:       startedAt,
+		FinishedAt:      finishedAt,
+		DurationSeconds: finishedAt.Sub(startedAt).Seconds(),
+		Endpoints:       []EndpointReport{},
+	}
+	if backupErr != nil {
+		report.Error = backupErr.Error()
+	}
+
+	if c.Config.Target == "all" || c.Config.Target == "contents" {
+		counts := make(map[string]map[string]int)
+		// 公開中かつ下書き中のコンテンツは公開中と下書き中の両方に保存されるため、合計はIDの重複を除いて数える
+		ids := make(map[string]map[string]bool)
+		add := func(endpoint, status string, n int, contentIDs ...string) {
+			if counts[endpoint] == nil {
+				counts[endpoint] = make(map[string]int)
+				ids[endpoint] = make(map[string]bool)
+			}
+			counts[endpoint][status] += n
+			for _, id := range contentIDs {
+				ids[endpoint][id] = true
+			}
+		}
+		// コンテンツを保存する前に失敗した場合は0件となる
+		if c.contentsFormat() == "xlsx" {
+			readXLSXContentIDs(baseDir+xlsxFileName, func(sheet xlsxSheet, contentIDs []string) {
+				// ステータス別分類なしのシートは、公開中のコンテンツのみを保存している
+				status := sheet.Status
+				if status == "" {
+					status = "PUBLISH"
+				}
+				add(sheet.Endpoint, status, sheet.Count, contentIDs...)
+			})
+		} else {
+			readBackupContents(baseDir, func(content backupContent) error {
+				add(content.Endpoint, content.Status, 1, content.Id)
+				return nil
+			})
+		}
+		for _, endpoint := range c.Config.Contents.Endpoints {
+			statuses := counts[endpoint.Name]
+			if statuses == nil {
+				statuses = make(map[string]int)
+			}
+			report.Endpoints = append(report.Endpoints, EndpointReport{Endpoint: endpoint.Name, Total: len(ids[endpoint.Name]), Statuses: statuses})
+		}
+	}
+
+	if c.Config.Target == "all" || c.Config.Target == "media" {
+		report.Media = newMediaReport(baseDir)
+	}
+	return report
+}
+
+// newMediaReport はメディア一覧から、保存したメディアの件数と合計サイズを求める
+// メディア一覧はすべてのメディアを保存した後に書き込むため、一覧がない場合(途中で失敗した場合)は保存済みのファイルから数える
+func newMediaReport(baseDir string) *MediaReport {
+	report := &MediaReport{}
+	b, err := os.ReadFile(baseDir + "media/index.json")
+	if err == nil {
+		var entries []MediaIndexEntry
+		if json.Unmarshal(b, &entries) == nil {
+			for _, entry := range entries {
+				report.Count++
+				report.TotalSize += entry.Size
+			}
+		}
+		return report
+	}
+
+	files, _ := listBackupMediaFiles(baseDir)
+	for _, file := range files {
+		info, err := os.Stat(baseDir + file)
+		if err != nil {
+			continue
+		}
+		report.Count++
+		report.TotalSize += info.Size()
+	}
+	return report
+}
+
+// text は通知する本文を返す
+func (r BackupReport) text() string {
+	var sb strings.Builder
+	if r.Success {
+		fmt.Fprintf(&sb, "microCMSのバックアップが成功しました (%s)\n", r.ServiceID)
+	} else {
+		fmt.Fprintf(&sb, "microCMSのバックアップが失敗しました (%s)\n", r.ServiceID)
+	}
+	fmt.Fprintf(&sb, "バックアップディレクトリ: %s\n", r.BackupDir)
+	fmt.Fprintf(&sb, "所要時間: %s\n", r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	if len(r.Endpoints) > 0 {
+		sb.WriteString("コンテンツ:\n")
+		for _, endpoint := range r.Endpoints {
+			fmt.Fprintf(&sb, "  %s: %d件", endpoint.Endpoint, endpoint.Total)
+			if len(endpoint.Statuses) > 0 {
+				var statuses []string
+				for _, status := range slices.Sorted(maps.Keys(endpoint.Statuses)) {
+					statuses = append(statuses, fmt.Sprintf("%s: %d", status, endpoint.Statuses[status]))
+				}
+				fmt.Fprintf(&sb, " (%s)", strings.Join(statuses, ", "))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	if r.Media != nil {
+		fmt.Fprintf(&sb, "メディア: %d件 (%dバイト)\n", r.Media.Count, r.Media.TotalSize)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(&sb, "エラー: %s\n", r.Error)
+	}
+	return sb.String()
+}
+
+// notify は設定された通知先にバックアップの結果を送信する
+// 送信に失敗してもバックアップの結果には影響させず、ログに出力するのみとする
+func (c Client) notify(ctx context.Context, report BackupReport) {
+	cfg := c.Config.Notify
+	if report.Success && cfg.OnlyFailure {
+		return
+	}
+	if len(cfg.Webhooks) == 0 && cfg.Email.Host == "" {
+		return
+	}
+
+	// 中断された場合も通知するため、キャンセルは引き継がない
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+
+	// URLにトークンを含む場合があるため、ログには出力しない
+	sent := 0
+	for i, webhook := range cfg.Webhooks {
+		err := sendWebhookNotification(ctx, webhook, report)
+		if err != nil {
+			log.Printf("notify.webhooks[%d]への通知に失敗しました: %v\n", i, err)
+			continue
+		}
+		sent++
+	}
+	if cfg.Email.Host != "" {
+		err := sendEmailNotification(ctx, cfg.Email, report)
+		if err != nil {
+			log.Printf("メールでの通知に失敗しました: %v\n", err)
+		} else {
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Println("バックアップの結果を通知しました")
+	}
+}
+
+// sendWebhookNotification はWebhookに結果をPOSTする
+func sendWebhookNotification(ctx context.Context, webhook NotifyWebhook, report BackupReport) error {
+	var payload any = report
+	if webhook.Format == "slack" {
+		payload = map[string]string{"text": report.text()}
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range webhook.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := new(http.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("ステータスコード:%d 正常に送信できませんでした", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendEmailNotification はSMTPで結果をメールで送信する
+// サーバーが対応している場合はSTARTTLSで暗号化する
+func sendEmailNotification(ctx context.Context, cfg NotifyEmail, report BackupReport) error {
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	conn, err := new(net.Dialer).DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(emailMessage(cfg, report)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailMessage は結果を本文とするメールのメッセージを作成する
+func emailMessage(cfg NotifyEmail, report BackupReport) []byte {
+	subject := fmt.Sprintf("[microcms-backup-tool] %s のバックアップが成功しました", report.ServiceID)
+	if !report.Success {
+		subject = fmt.Sprintf("[microcms-backup-tool] %s のバックアップが失敗しました", report.ServiceID)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", report.FinishedAt.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("\r\n")
+
+	// 1行76文字で折り返す
+	body := base64.StdEncoding.EncodeToString([]byte(report.text()))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return buf.Bytes()
+}
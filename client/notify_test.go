@@ -0,0 +1,326 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
+	"github.com/tidwall/gjson"
+)
+
+// testSMTPServer は受け取ったメールを保持するSMTPサーバーの代わり
+type testSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	// 送信先と、DATAで受け取ったメッセージ
+	recipients []string
+	messages   []string
+}
+
+func newTestSMTPServer(t *testing.T) *testSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testSMTPServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *testSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Start mail input")
+			b, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(b))
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	keys := testMockKeys()
+	server := mockcms.NewServer(testMockFixture())
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		apiKey      string
+		onlyFailure bool
+		wantNotify  bool
+		wantSuccess bool
+	}{
+		{name: "成功", apiKey: keys.Publish, wantNotify: true, wantSuccess: true},
+		{name: "失敗", apiKey: "incorrectkey", wantNotify: true, wantSuccess: false},
+		{name: "失敗した場合のみ通知で成功", apiKey: keys.Publish, onlyFailure: true, wantNotify: false},
+		{name: "失敗した場合のみ通知で失敗", apiKey: "incorrectkey", onlyFailure: true, wantNotify: true, wantSuccess: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			received := make(map[string]string)
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				received[r.URL.Path] = string(b)
+				received[r.URL.Path+":token"] = r.Header.Get("Authorization")
+				mu.Unlock()
+			}))
+			defer webhook.Close()
+			smtpServer := newTestSMTPServer(t)
+			host, port, _ := net.SplitHostPort(smtpServer.listener.Addr().String())
+			smtpPort, _ := net.LookupPort("tcp", port)
+
+			client := newMockClient(server, &Config{
+				Target:    "all",
+				ServiceID: "test-service",
+				Contents: ContentsConfig{
+					GetPublishContentsAPIKey: tt.apiKey,
+					Endpoints:                []Endpoint{{Name: "blogs"}, {Name: "categories"}},
+					RequestUnit:              10,
+				},
+				Media: MediaConfig{APIKey: keys.Media},
+				Notify: NotifyConfig{
+					OnlyFailure: tt.onlyFailure,
+					Webhooks: []NotifyWebhook{
+						{URL: webhook.URL + "/json", Headers: map[string]string{"Authorization": "Bearer token"}},
+						{URL: webhook.URL + "/slack", Format: "slack"},
+					},
+					Email: NotifyEmail{Host: host, Port: smtpPort, From: "backup@example.com", To: []string{"admin@example.com"}},
+				},
+			})
+			baseDir := t.TempDir() + "/"
+			err := client.StartBackup(context.Background(), baseDir)
+			if (err == nil) != (tt.apiKey == keys.Publish) {
+				t.Fatalf("StartBackup() error = %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			smtpServer.mu.Lock()
+			defer smtpServer.mu.Unlock()
+			if !tt.wantNotify {
+				if len(received) != 0 || len(smtpServer.messages) != 0 {
+					t.Errorf("通知されました: %v, %v", received, smtpServer.messages)
+				}
+				return
+			}
+
+			var report BackupReport
+			if err := json.Unmarshal([]byte(received["/json"]), &report); err != nil {
+				t.Fatalf("JSONの通知 = %q: %v", received["/json"], err)
+			}
+			if report.ServiceID != "test-service" || report.BackupDir != baseDir || report.Success != tt.wantSuccess || (report.Error == "") != tt.wantSuccess {
+				t.Errorf("report = %+v", report)
+			}
+			if received["/json:token"] != "Bearer token" {
+				t.Errorf("Authorization = %q", received["/json:token"])
+			}
+			if tt.wantSuccess {
+				if len(report.Endpoints) != 2 || report.Endpoints[0].Total != 2 || report.Endpoints[0].Statuses["PUBLISH"] != 2 || report.Endpoints[1].Total != 1 {
+					t.Errorf("Endpoints = %+v", report.Endpoints)
+				}
+				if report.Media == nil || report.Media.Count != 2 {
+					t.Errorf("Media = %+v", report.Media)
+				}
+			}
+
+			text := gjson.Get(received["/slack"], "text").String()
+			wantText := "バックアップが成功しました"
+			if !tt.wantSuccess {
+				wantText = "バックアップが失敗しました"
+			}
+			if !strings.Contains(text, wantText) || !strings.Contains(text, "test-service") {
+				t.Errorf("Slackの通知 = %q", text)
+			}
+
+			if len(smtpServer.messages) != 1 || len(smtpServer.recipients) != 1 || smtpServer.recipients[0] != "admin@example.com" {
+				t.Fatalf("メール = %v, 送信先 = %v", smtpServer.messages, smtpServer.recipients)
+			}
+			message, err := textproto.NewReader(bufio.NewReader(strings.NewReader(smtpServer.messages[0]))).ReadMIMEHeader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			subject, _ := new(mime.WordDecoder).DecodeHeader(message.Get("Subject"))
+			if !strings.Contains(subject, wantText) {
+				t.Errorf("Subject = %q", subject)
+			}
+			// DotReaderにより改行はLFとなる
+			_, encodedBody, _ := strings.Cut(smtpServer.messages[0], "\n\n")
+			body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(encodedBody, "\n", ""))
+			if err != nil || !strings.Contains(string(body), wantText) {
+				t.Errorf("本文 = %q: %v", body, err)
+			}
+		})
+	}
+}
+
+func TestNotifyConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  NotifyConfig
+		wantErr bool
+	}{
+		{name: "省略", config: NotifyConfig{}},
+		{name: "正しい設定", config: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "http://localhost", Format: "slack"}}, Email: NotifyEmail{Host: "localhost", From: "a@example.com", To: []string{"b@example.com"}}}},
+		{name: "URLがない", config: NotifyConfig{Webhooks: []NotifyWebhook{{}}}, wantErr: true},
+		{name: "不明な形式", config: NotifyConfig{Webhooks: []NotifyWebhook{{URL: "http://localhost", Format: "teams"}}}, wantErr: true},
+		{name: "送信先がない", config: NotifyConfig{Email: NotifyEmail{Host: "localhost", From: "a@example.com"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewBackupReport(t *testing.T) {
+	keys := testMockKeys()
+	server := mockcms.NewServer(testMockFixture())
+	defer server.Close()
+
+	for _, format := range []string{"json", "csv", "ndjson", "xlsx"} {
+		t.Run(format, func(t *testing.T) {
+			client := newMockClient(server, &Config{
+				Target: "contents",
+				Contents: ContentsConfig{
+					GetPublishContentsAPIKey:   keys.Publish,
+					GetAllStatusContentsAPIKey: keys.AllStatus,
+					GetContentsMetaDataAPIKey:  keys.MetaData,
+					Endpoints:                  []Endpoint{{Name: "blogs"}},
+					RequestUnit:                10,
+					ClassifyByStatus:           true,
+					Format:                     format,
+				},
+			})
+			baseDir := t.TempDir() + "/"
+			if err := client.StartBackup(context.Background(), baseDir); err != nil {
+				t.Fatalf("StartBackup() error = %v", err)
+			}
+
+			// 公開中かつ下書き中のコンテンツは、ステータスごとには両方に数え、合計では1件と数える
+			report := client.newBackupReport(baseDir, time.Now(), time.Now(), nil)
+			want := EndpointReport{Endpoint: "blogs", Total: 4, Statuses: map[string]int{"PUBLISH": 2, "DRAFT": 2, "CLOSED": 1}}
+			if len(report.Endpoints) != 1 || !reflect.DeepEqual(report.Endpoints[0], want) {
+				t.Errorf("Endpoints = %+v, want %+v", report.Endpoints, want)
+			}
+		})
+	}
+}
+
+func TestNewBackupReportMedia(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	for path, data := range map[string]string{"media/a/image.png": "png", "media/b/file.txt": "text"} {
+		if err := os.MkdirAll(filepath.Dir(baseDir+path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(baseDir+path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := Client{Config: &Config{Target: "media"}}
+
+	// メディア一覧を保存する前に失敗した場合は、保存済みのファイルを数える
+	report := client.newBackupReport(baseDir, time.Now(), time.Now(), errors.New("失敗"))
+	if want := (MediaReport{Count: 2, TotalSize: 7}); report.Media == nil || *report.Media != want {
+		t.Errorf("Media = %+v, want %+v", report.Media, want)
+	}
+
+	entries := []MediaIndexEntry{{Id: "a", LocalPath: "media/a/image.png", Size: 100}}
+	if err := writeMediaIndex(baseDir, entries); err != nil {
+		t.Fatal(err)
+	}
+	report = client.newBackupReport(baseDir, time.Now(), time.Now(), nil)
+	if want := (MediaReport{Count: 1, TotalSize: 100}); report.Media == nil || *report.Media != want {
+		t.Errorf("Media = %+v, want %+v", report.Media, want)
+	}
+}
+
+func TestNotifyLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failed.Close()
+	succeeded := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer succeeded.Close()
+
+	tests := []struct {
+		name     string
+		webhooks []NotifyWebhook
+		want     bool
+	}{
+		{name: "すべて失敗", webhooks: []NotifyWebhook{{URL: failed.URL}, {URL: failed.URL}}, want: false},
+		{name: "一部が成功", webhooks: []NotifyWebhook{{URL: failed.URL}, {URL: succeeded.URL}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			client := Client{Config: &Config{Notify: NotifyConfig{Webhooks: tt.webhooks}}}
+			client.notify(context.Background(), BackupReport{Success: true})
+			if got := strings.Contains(buf.String(), "バックアップの結果を通知しました"); got != tt.want {
+				t.Errorf("ログ = %q, want %v", buf.String(), tt.want)
+			}
+		})
+	}
+}
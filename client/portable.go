@@ -0,0 +1,99 @@
+package client
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// savePortableContents はcontents/以下のファイルを複製し、media/に保存済みのメディアURLを
+// ローカルの相対パスに書き換えたものをportable/contents/以下に保存する
+// contents/以下の元のファイルは変更しない
+func savePortableContents(baseDir string) error {
+	log.Println("ローカルのメディアを参照するコンテンツの複製を開始します")
+
+	b, err := os.ReadFile(baseDir + "media/index.json")
+	if errors.Is(err, os.ErrNotExist) {
+		log.Println("メディア一覧が存在しないため、コンテンツの複製をスキップします")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []MediaIndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+	localPaths := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		localPaths[entry.Url] = entry.LocalPath
+	}
+
+	contentsDir := filepath.Clean(baseDir + "contents")
+	err = filepath.WalkDir(contentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(baseDir, "portable", rel)
+		destDir := filepath.Dir(destPath)
+
+		src, err := readMaybeGzipFile(path)
+		if err != nil {
+			return err
+		}
+
+		portable := replaceMediaURLs(string(src), func(mediaURL string) (string, bool) {
+			localPath, ok := localPaths[mediaURL]
+			if !ok {
+				return "", false
+			}
+			relPath, err := filepath.Rel(destDir, filepath.Join(baseDir, localPath))
+			if err != nil {
+				return "", false
+			}
+			return escapeRelativePath(relPath), true
+		})
+
+		if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, gzipExt) {
+			return writeFileAtomic(destPath, func(w io.Writer) error {
+				gz := gzip.NewWriter(w)
+				if _, err := io.WriteString(gz, portable); err != nil {
+					return err
+				}
+				return gz.Close()
+			})
+		}
+		return writeStringAtomic(destPath, portable)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// escapeRelativePath は相対パスの各要素をURLのパスとして使えるようにエスケープする
+func escapeRelativePath(relPath string) string {
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSavePortableContents(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"contents/blogs/PUBLISH", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(baseDir+"media", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := `{"image":{"url":"https://images.microcms-assets.io/assets/xxx/abc/sample%20image.png?w=100"},"other":"https://images.microcms-assets.io/assets/xxx/zzz/missing.png"}`
+	if err := os.WriteFile(baseDir+"contents/blogs/PUBLISH/1.json", []byte(raw), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries := []MediaIndexEntry{{
+		Id:        "a",
+		Url:       "https://images.microcms-assets.io/assets/xxx/abc/sample%20image.png",
+		LocalPath: "media/abc/sample image.png",
+	}}
+	if err := writeMediaIndex(baseDir, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := savePortableContents(baseDir); err != nil {
+		t.Fatalf("savePortableContents() error = %v", err)
+	}
+
+	got, err := os.ReadFile(baseDir + "portable/contents/blogs/PUBLISH/1.json")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	// 一覧にあるメディアのみ、複製したファイルからの相対パスに書き換えられる
+	want := `{"image":{"url":"../../../../media/abc/sample%20image.png"},"other":"https://images.microcms-assets.io/assets/xxx/zzz/missing.png"}`
+	if string(got) != want {
+		t.Errorf("portable = %s, want %s", got, want)
+	}
+
+	// 元のファイルは変更されない
+	src, err := os.ReadFile(baseDir + "contents/blogs/PUBLISH/1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(src) != raw {
+		t.Errorf("元のファイルが変更されました: %s", src)
+	}
+}
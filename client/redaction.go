@@ -0,0 +1,590 @@
+package client
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// 加工したバックアップであることを示すファイル名
+const redactedMarkerFileName = "REDACTED"
+
+// 元のバックアップに加えて保存する、加工したコンテンツのディレクトリ名
+const redactedDirName = "redacted"
+
+// validate はフィールドの加工の設定を検証する
+func (rc RedactionConfig) validate() error {
+	switch rc.Mode {
+	case "", "instead", "alongside":
+	default:
+		return fmt.Errorf("不明な加工したコンテンツの保存方法が選択されました: %s", rc.Mode)
+	}
+	for endpoint, rules := range rc.Rules {
+		for _, rule := range rules {
+			if rule.Field == "" {
+				return fmt.Errorf("%s: 加工するフィールドを指定してください", endpoint)
+			}
+			// saltがないと、元の値からハッシュ値を求めて照合できてしまう
+			if (rule.Action == "hash" || rule.Action == "fake") && rc.Salt == "" {
+				return fmt.Errorf("%s.%s: hash・fakeで加工する場合は、saltを指定してください", endpoint, rule.Field)
+			}
+			switch rule.Action {
+			case "drop", "hash":
+			case "fake":
+				switch rule.Fake {
+				case "", "text", "name", "email", "phone":
+				default:
+					return fmt.Errorf("%s.%s: 不明な置き換える値の種類が選択されました: %s", endpoint, rule.Field, rule.Fake)
+				}
+			case "truncate":
+				if rule.Length <= 0 {
+					return fmt.Errorf("%s.%s: truncateで残す文字数は1以上で指定してください", endpoint, rule.Field)
+				}
+			default:
+				return fmt.Errorf("%s.%s: 不明な加工方法が選択されました: %s", endpoint, rule.Field, rule.Action)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRedaction はフィールドの加工の設定を、コンテンツの保存形式と合わせて検証する
+func (c Client) validateRedaction() error {
+	redaction := c.Config.Contents.Redaction
+	if err := redaction.validate(); err != nil {
+		return err
+	}
+	// 展開したカラムからは、どのカラムが展開されたコンテンツ参照のものかを判別できない
+	if c.redactsAlongside() && c.contentsFormat() == "csv" && c.Config.Contents.CSV.Flatten && c.Config.Contents.Relations != "id" {
+		return errors.New("CSVのflattenで加工したコンテンツを別に保存(alongside)する場合は、展開されたコンテンツ参照に加工前の値が残らないよう、relationsにidを指定してください")
+	}
+	return nil
+}
+
+// needsRedactionTargets は展開されたコンテンツ参照を加工するために、参照先のコンテンツIDが必要かどうかを返す
+// コンテンツ参照をIDのみで保存する(relationsがid)場合は、参照先の値が残らないため不要
+func (c Client) needsRedactionTargets() bool {
+	return len(c.Config.Contents.Redaction.Rules) > 0 && c.Config.Contents.Relations != "id"
+}
+
+// redactionTargets はコンテンツIDごとの、そのIDのコンテンツがある加工のルールを指定したエンドポイント
+// 他のエンドポイントのコンテンツに展開されたコンテンツ参照を、参照先のエンドポイントのルールで加工するために使う
+type redactionTargets map[string][]string
+
+// loadRedactionTargets は加工のルールを指定したエンドポイントのすべてのコンテンツIDを取得する
+// 下書き中のコンテンツも参照先になるため、getAllStatusContentsAPIKeyがある場合はそちらを使用する
+func (c Client) loadRedactionTargets(ctx context.Context) (redactionTargets, error) {
+	apiKey := c.Config.Contents.GetAllStatusContentsAPIKey
+	if apiKey == "" {
+		apiKey = c.Config.Contents.GetPublishContentsAPIKey
+	}
+	endpoints := slices.Sorted(maps.Keys(c.Config.Contents.Redaction.Rules))
+
+	targets := make(redactionTargets)
+	for _, endpoint := range endpoints {
+		ids, err := c.getContentIDs(ctx, endpoint, apiKey)
+		if err != nil {
+			return nil, fmt.Errorf("%sのコンテンツIDの取得でエラーが発生しました: %w", endpoint, err)
+		}
+		for _, id := range ids {
+			targets[id] = append(targets[id], endpoint)
+		}
+	}
+	return targets, nil
+}
+
+// getContentIDs はエンドポイントのすべてのコンテンツIDを取得する
+func (c Client) getContentIDs(ctx context.Context, endpoint, apiKey string) ([]string, error) {
+	const limit = 100
+	query := Endpoint{Name: endpoint, Fields: "id"}
+	var ids []string
+	for offset := 0; ; offset += limit {
+		url := fmt.Sprintf("%s/v1/%s?%s", c.contentsAPIURL(), endpoint, query.listQuery(limit, offset))
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req.Header.Set("X-MICROCMS-API-KEY", apiKey)
+
+		resp, err := new(http.Client).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+		}
+
+		contents := gjson.GetBytes(body, "contents")
+		if !contents.IsArray() {
+			return nil, fmt.Errorf("contentsが配列ではありません")
+		}
+		for _, item := range contents.Array() {
+			ids = append(ids, item.Get("id").String())
+		}
+		if len(contents.Array()) < limit || len(ids) >= int(gjson.GetBytes(body, "totalCount").Int()) {
+			return ids, nil
+		}
+	}
+}
+
+// redact は展開されたコンテンツ参照に、参照先のエンドポイントの加工のルールを適用したJSON文字列を返す
+// コンテンツ参照は、IDが加工のルールを指定したエンドポイントのコンテンツIDと一致するオブジェクトとする
+// 参照先の中に展開されたコンテンツ参照にも適用し、rootがtrueの場合は値自体(保存するコンテンツ)には適用しない
+func (t redactionTargets) redact(value gjson.Result, redaction RedactionConfig, root bool) string {
+	if len(t) == 0 {
+		return value.Raw
+	}
+	switch {
+	case value.IsArray():
+		var sb strings.Builder
+		sb.WriteString("[")
+		for i, element := range value.Array() {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(t.redact(element, redaction, false))
+		}
+		sb.WriteString("]")
+		return sb.String()
+	case value.IsObject():
+		if id := value.Get("id"); !root && id.Type == gjson.String {
+			for _, endpoint := range t[id.String()] {
+				value = gjson.Parse(redactJSON(value, redaction.Rules[endpoint], redaction.Salt))
+			}
+		}
+		var sb strings.Builder
+		sb.WriteString("{")
+		first := true
+		value.ForEach(func(key, child gjson.Result) bool {
+			if !first {
+				sb.WriteString(",")
+			}
+			first = false
+			sb.WriteString(key.Raw)
+			sb.WriteString(":")
+			sb.WriteString(t.redact(child, redaction, false))
+			return true
+		})
+		sb.WriteString("}")
+		return sb.String()
+	}
+	return value.Raw
+}
+
+// redactsAlongside は元のコンテンツに加えて、加工したコンテンツを別に保存するかどうかを返す
+func (c Client) redactsAlongside() bool {
+	return c.Config.Contents.Redaction.Mode == "alongside" && len(c.Config.Contents.Redaction.Rules) > 0
+}
+
+// redactContents は取得したコンテンツの配列に、エンドポイントの加工のルールを適用する
+// 加工したコンテンツのみを保存する場合(instead)に、保存する前のすべてのコンテンツに適用する
+func (c Client) redactContents(endpoint string, contents gjson.Result) gjson.Result {
+	redaction := c.Config.Contents.Redaction
+	if redaction.Mode == "alongside" || (len(redaction.Rules[endpoint]) == 0 && len(c.redactionTargets) == 0) {
+		return contents
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i, item := range contents.Array() {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(c.redactContentJSON(endpoint, item))
+	}
+	sb.WriteString("]")
+	return gjson.Parse(sb.String())
+}
+
+// redactContent は取得した1件のコンテンツに、エンドポイントの加工のルールを適用する
+func (c Client) redactContent(endpoint string, content gjson.Result) gjson.Result {
+	return c.redactContents(endpoint, gjson.Parse("["+content.Raw+"]")).Get("0")
+}
+
+// redactContentJSON は1件のコンテンツに、エンドポイントのルールと、展開されたコンテンツ参照の参照先のルールを適用する
+func (c Client) redactContentJSON(endpoint string, content gjson.Result) string {
+	redaction := c.Config.Contents.Redaction
+	raw := redactJSON(content, redaction.Rules[endpoint], redaction.Salt)
+	return c.redactionTargets.redact(gjson.Parse(raw), redaction, true)
+}
+
+// redactJSON はJSONの値に加工のルールを適用したJSON文字列を返す
+// ルールのフィールドは"."で区切ってオブジェクトの中を指定でき、配列の場合は各要素に適用する
+// キーの順序はそのまま保持する
+func redactJSON(value gjson.Result, rules []RedactionRule, salt string) string {
+	switch {
+	case value.IsArray():
+		var sb strings.Builder
+		sb.WriteString("[")
+		for i, element := range value.Array() {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(redactJSON(element, rules, salt))
+		}
+		sb.WriteString("]")
+		return sb.String()
+	case value.IsObject():
+		var sb strings.Builder
+		sb.WriteString("{")
+		first := true
+		value.ForEach(func(key, child gjson.Result) bool {
+			raw, ok := redactField(key.String(), child, rules, salt)
+			if !ok {
+				return true
+			}
+			if !first {
+				sb.WriteString(",")
+			}
+			first = false
+			sb.WriteString(key.Raw)
+			sb.WriteString(":")
+			sb.WriteString(raw)
+			return true
+		})
+		sb.WriteString("}")
+		return sb.String()
+	}
+	return value.Raw
+}
+
+// redactField はオブジェクトの1つのキーの値に加工のルールを適用し、JSON文字列を返す
+// 値を削除する場合はfalseを返す
+func redactField(key string, value gjson.Result, rules []RedactionRule, salt string) (string, bool) {
+	var nested []RedactionRule
+	for _, rule := range rules {
+		if rule.Field == key {
+			if rule.Action == "drop" {
+				return "", false
+			}
+			return redactValue(rule, value, salt), true
+		}
+		if rest, ok := strings.CutPrefix(rule.Field, key+"."); ok {
+			rule.Field = rest
+			nested = append(nested, rule)
+		}
+	}
+	if len(nested) == 0 {
+		return value.Raw, true
+	}
+	return redactJSON(value, nested, salt), true
+}
+
+// redactValue は値を加工方法に従って置き換えたJSON文字列を返す
+// 値がない(null)場合は置き換えない
+func redactValue(rule RedactionRule, value gjson.Result, salt string) string {
+	if value.Type == gjson.Null {
+		return value.Raw
+	}
+	// 同じ値は同じ値に置き換わるよう、値から求めたハッシュ値をもとにする
+	source := value.Raw
+	if value.Type == gjson.String {
+		source = value.String()
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(source))
+	digest := mac.Sum(nil)
+	hexDigest := hex.EncodeToString(digest)
+
+	var replaced string
+	switch rule.Action {
+	case "hash":
+		replaced = hexDigest
+	case "fake":
+		switch rule.Fake {
+		case "name":
+			replaced = "ユーザー" + hexDigest[:6]
+		case "email":
+			replaced = "user-" + hexDigest[:8] + "@example.com"
+		case "phone":
+			replaced = fmt.Sprintf("000-%04d-%04d", (int(digest[0])<<8|int(digest[1]))%10000, (int(digest[2])<<8|int(digest[3]))%10000)
+		default:
+			replaced = "redacted-" + hexDigest[:8]
+		}
+	case "truncate":
+		// 文字列以外は切り詰めない
+		if value.Type != gjson.String {
+			return value.Raw
+		}
+		runes := []rune(value.String())
+		if len(runes) <= rule.Length {
+			return value.Raw
+		}
+		replaced = string(runes[:rule.Length])
+	default:
+		return value.Raw
+	}
+	b, _ := json.Marshal(replaced)
+	return string(b)
+}
+
+// writeRedactedMarker は加工したバックアップであることと、適用したルールを示すファイルを書き込む
+// hash・fakeの秘密の値は書き込まない
+func writeRedactedMarker(dir string, redaction RedactionConfig) error {
+	var sb strings.Builder
+	sb.WriteString("このディレクトリのコンテンツは、以下のルールで加工されています\n")
+	endpoints := make([]string, 0, len(redaction.Rules))
+	for endpoint := range redaction.Rules {
+		endpoints = append(endpoints, endpoint)
+	}
+	slices.Sort(endpoints)
+	for _, endpoint := range endpoints {
+		for _, rule := range redaction.Rules[endpoint] {
+			fmt.Fprintf(&sb, "%s.%s: %s", endpoint, rule.Field, rule.Action)
+			switch rule.Action {
+			case "fake":
+				if rule.Fake != "" {
+					fmt.Fprintf(&sb, " (%s)", rule.Fake)
+				}
+			case "truncate":
+				fmt.Fprintf(&sb, " (%d)", rule.Length)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return writeStringAtomic(dir+redactedMarkerFileName, sb.String())
+}
+
+// saveRedactedContents はcontents/以下のファイルに加工のルールを適用したものを、redacted/contents/以下に保存する
+// JSON・NDJSON・CSVのいずれの保存形式にも対応する(メタデータは加工されないため保存しない)
+func (c Client) saveRedactedContents(ctx context.Context, baseDir string) error {
+	log.Println("加工したコンテンツの保存を開始します")
+
+	if c.needsRedactionTargets() {
+		targets, err := c.loadRedactionTargets(ctx)
+		if err != nil {
+			return err
+		}
+		c.redactionTargets = targets
+	}
+	redaction := c.Config.Contents.Redaction
+	redactedDir := baseDir + redactedDirName + "/"
+	contentsDir := filepath.Clean(baseDir + "contents")
+	err := filepath.WalkDir(contentsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		// contents/<エンドポイント>/<ステータス>/(<下書きの状態>/)<ファイル名>
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if len(parts) < 3 {
+			return nil
+		}
+		endpoint := parts[1]
+		destPath := filepath.Join(redactedDir, rel)
+		if err := os.MkdirAll(filepath.Dir(destPath), os.ModePerm); err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(d.Name(), gzipExt)
+		switch {
+		case strings.HasSuffix(name, ".meta.json"), strings.HasPrefix(name, "contents.meta."):
+			return nil
+		case strings.HasSuffix(name, ".columns.json"), name == relationFieldsFileName:
+			return copyFile(path, destPath)
+		case filepath.Ext(name) == ".json":
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return writeFormattedJSON(destPath, c.redactContentJSON(endpoint, gjson.ParseBytes(b)))
+		case filepath.Ext(name) == ".ndjson":
+			return writeRedactedNDJSON(path, destPath, func(content gjson.Result) string {
+				return c.redactContentJSON(endpoint, content)
+			})
+		case filepath.Ext(name) == ".csv":
+			records, err := readCSVFile(path)
+			if err != nil {
+				return err
+			}
+			return writeFileAtomic(destPath, func(w io.Writer) error {
+				writer, err := c.Config.Contents.CSV.newCSVWriter(w)
+				if err != nil {
+					return err
+				}
+				if err := writer.WriteAll(c.redactionTargets.redactCSV(redactCSV(records, redaction.Rules[endpoint], redaction.Salt), redaction)); err != nil {
+					return err
+				}
+				return writer.Error()
+			})
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeRedactedMarker(redactedDir, redaction); err != nil {
+		return err
+	}
+	log.Printf("加工したコンテンツを%sに保存しました", redactedDir)
+	return nil
+}
+
+// writeRedactedNDJSON はNDJSONファイルの各行のコンテンツを加工して保存する
+// 拡張子が.gzの場合は圧縮して保存する
+func writeRedactedNDJSON(path, destPath string, redact func(content gjson.Result) string) error {
+	return writeFileAtomic(destPath, func(w io.Writer) error {
+		var gz *gzip.Writer
+		if strings.HasSuffix(path, gzipExt) {
+			gz = gzip.NewWriter(w)
+			w = gz
+		}
+		bw := bufio.NewWriter(w)
+		err := readNDJSON(path, func(line []byte) error {
+			if _, err := bw.WriteString(redact(gjson.ParseBytes(line))); err != nil {
+				return err
+			}
+			return bw.WriteByte('\n')
+		})
+		if err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			return gz.Close()
+		}
+		return nil
+	})
+}
+
+// 展開したカラム名の配列の添字
+var csvIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// redactCSV はCSVの各カラムに加工のルールを適用する
+// 展開したカラム(field.key、field[0])はフィールドIDの"."区切りとして扱い、JSON文字列のセルは中の値にも適用する
+func redactCSV(records [][]string, rules []RedactionRule, salt string) [][]string {
+	if len(records) == 0 {
+		return records
+	}
+	header := records[0]
+
+	// カラムごとに適用するルール
+	columnRules := make([][]RedactionRule, len(header))
+	var keep []int
+	for j, column := range header {
+		path := csvIndexPattern.ReplaceAllString(column, "")
+		dropped := false
+		// メタデータは加工されないため保存しない
+		if strings.HasPrefix(column, metaDataColumnPrefix) {
+			continue
+		}
+		for _, rule := range rules {
+			switch {
+			case path == rule.Field || strings.HasPrefix(path, rule.Field+"."):
+				if rule.Action == "drop" {
+					dropped = true
+				}
+				// セルの値全体に適用する
+				rule.Field = ""
+				columnRules[j] = append(columnRules[j], rule)
+			case strings.HasPrefix(rule.Field, path+"."):
+				rule.Field = strings.TrimPrefix(rule.Field, path+".")
+				columnRules[j] = append(columnRules[j], rule)
+			}
+		}
+		if !dropped {
+			keep = append(keep, j)
+		}
+	}
+
+	redacted := make([][]string, 0, len(records))
+	for i, record := range records {
+		row := make([]string, 0, len(keep))
+		for _, j := range keep {
+			if j >= len(record) {
+				row = append(row, "")
+				continue
+			}
+			cell := record[j]
+			if i > 0 && cell != "" {
+				cell = redactCSVCell(cell, columnRules[j], salt)
+			}
+			row = append(row, cell)
+		}
+		redacted = append(redacted, row)
+	}
+	return redacted
+}
+
+// redactCSVCell はセルの値にルールを適用する
+// フィールドが空のルールはセルの値全体に、それ以外はJSON文字列のセルの中の値に適用する
+func redactCSVCell(cell string, rules []RedactionRule, salt string) string {
+	var value gjson.Result
+	if json.Valid([]byte(cell)) && (gjson.Parse(cell).IsObject() || gjson.Parse(cell).IsArray()) {
+		value = gjson.Parse(cell)
+	} else {
+		value = gjson.Result{Type: gjson.String, Str: cell}
+	}
+
+	var nested []RedactionRule
+	for _, rule := range rules {
+		if rule.Field == "" {
+			return csvCellValue(gjson.Parse(redactValue(rule, value, salt)))
+		}
+		nested = append(nested, rule)
+	}
+	if len(nested) == 0 || !(value.IsObject() || value.IsArray()) {
+		return cell
+	}
+	return redactJSON(value, nested, salt)
+}
+
+// redactCSV はJSON文字列のセルに展開されたコンテンツ参照に、参照先のエンドポイントの加工のルールを適用する
+func (t redactionTargets) redactCSV(records [][]string, redaction RedactionConfig) [][]string {
+	if len(t) == 0 {
+		return records
+	}
+	for _, record := range records[min(1, len(records)):] {
+		for j, cell := range record {
+			if value := gjson.Parse(cell); json.Valid([]byte(cell)) && (value.IsObject() || value.IsArray()) {
+				record[j] = t.redact(value, redaction, false)
+			}
+		}
+	}
+	return records
+}
+
+// copyFile はファイルをそのまま複製する
+func copyFile(src, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeFileAtomic(dest, func(w io.Writer) error {
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// testHMAC はsaltをキーとした値のHMAC-SHA256を16進数で返す
+func testHMAC(salt, value string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		rules []RedactionRule
+		want  string
+	}{
+		{
+			name:  "削除",
+			raw:   `{"id":"a","email":"taro@example.jp","title":"タイトル"}`,
+			rules: []RedactionRule{{Field: "email", Action: "drop"}},
+			want:  `{"id":"a","title":"タイトル"}`,
+		},
+		{
+			name:  "ハッシュ化",
+			raw:   `{"id":"a","email":"taro@example.jp"}`,
+			rules: []RedactionRule{{Field: "email", Action: "hash"}},
+			want:  `{"id":"a","email":"` + testHMAC("salt", "taro@example.jp") + `"}`,
+		},
+		{
+			name:  "ダミー値",
+			raw:   `{"name":"山田太郎","email":"taro@example.jp","note":"メモ"}`,
+			rules: []RedactionRule{{Field: "name", Action: "fake", Fake: "name"}, {Field: "email", Action: "fake", Fake: "email"}, {Field: "note", Action: "fake"}},
+			want: `{"name":"ユーザー` + testHMAC("salt", "山田太郎")[:6] + `","email":"user-` + testHMAC("salt", "taro@example.jp")[:8] + `@example.com",` +
+				`"note":"redacted-` + testHMAC("salt", "メモ")[:8] + `"}`,
+		},
+		{
+			name:  "切り詰め",
+			raw:   `{"body":"あいうえおかきくけこ","short":"あい","count":12345}`,
+			rules: []RedactionRule{{Field: "body", Action: "truncate", Length: 5}, {Field: "short", Action: "truncate", Length: 5}, {Field: "count", Action: "truncate", Length: 2}},
+			want:  `{"body":"あいうえお","short":"あい","count":12345}`,
+		},
+		{
+			name:  "カスタムフィールド・繰り返しフィールドの中",
+			raw:   `{"author":{"fieldId":"author","email":"a@example.jp"},"members":[{"fieldId":"member","email":"b@example.jp","role":"x"},{"fieldId":"member","role":"y"}]}`,
+			rules: []RedactionRule{{Field: "author.email", Action: "drop"}, {Field: "members.email", Action: "drop"}},
+			want:  `{"author":{"fieldId":"author"},"members":[{"fieldId":"member","role":"x"},{"fieldId":"member","role":"y"}]}`,
+		},
+		{
+			name:  "nullはそのまま",
+			raw:   `{"email":null}`,
+			rules: []RedactionRule{{Field: "email", Action: "hash"}},
+			want:  `{"email":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactJSON(gjson.Parse(tt.raw), tt.rules, "salt"); got != tt.want {
+				t.Errorf("redactJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactionTargetsRedact(t *testing.T) {
+	redaction := RedactionConfig{
+		Salt: "salt",
+		Rules: map[string][]RedactionRule{
+			"users": {{Field: "email", Action: "drop"}},
+			"teams": {{Field: "secret", Action: "hash"}},
+		},
+	}
+	targets := redactionTargets{"u1": {"users"}, "u2": {"users"}, "t1": {"teams"}}
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "コンテンツ参照",
+			raw:  `{"id":"a","author":{"id":"u1","email":"taro@example.jp"}}`,
+			want: `{"id":"a","author":{"id":"u1"}}`,
+		},
+		{
+			name: "複数コンテンツ参照と、参照先の中の参照",
+			raw:  `{"id":"a","members":[{"id":"u1","email":"a@example.jp"},{"id":"u2","email":"b@example.jp","team":{"id":"t1","secret":"x"}}]}`,
+			want: `{"id":"a","members":[{"id":"u1"},{"id":"u2","team":{"id":"t1","secret":"` + testHMAC("salt", "x") + `"}}]}`,
+		},
+		{
+			name: "保存するコンテンツ自体には適用しない",
+			raw:  `{"id":"u1","email":"taro@example.jp"}`,
+			want: `{"id":"u1","email":"taro@example.jp"}`,
+		},
+		{
+			name: "参照先でないオブジェクト",
+			raw:  `{"id":"a","profile":{"id":"x","email":"taro@example.jp"}}`,
+			want: `{"id":"a","profile":{"id":"x","email":"taro@example.jp"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targets.redact(gjson.Parse(tt.raw), redaction, true); got != tt.want {
+				t.Errorf("redact() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactionConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RedactionConfig
+		wantErr bool
+	}{
+		{name: "省略", config: RedactionConfig{}},
+		{name: "正しい設定", config: RedactionConfig{Mode: "alongside", Salt: "salt", Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "fake", Fake: "email"}, {Field: "bio", Action: "truncate", Length: 10}}}}},
+		{name: "saltなしのdrop・truncate", config: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "drop"}, {Field: "bio", Action: "truncate", Length: 10}}}}},
+		{name: "saltなしのhash", config: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "hash"}}}}, wantErr: true},
+		{name: "saltなしのfake", config: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "fake", Fake: "email"}}}}, wantErr: true},
+		{name: "不明な保存方法", config: RedactionConfig{Mode: "both"}, wantErr: true},
+		{name: "不明な加工方法", config: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "mask"}}}}, wantErr: true},
+		{name: "不明なダミー値", config: RedactionConfig{Salt: "salt", Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "fake", Fake: "address"}}}}, wantErr: true},
+		{name: "切り詰める文字数がない", config: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Field: "bio", Action: "truncate"}}}}, wantErr: true},
+		{name: "フィールドがない", config: RedactionConfig{Rules: map[string][]RedactionRule{"users": {{Action: "drop"}}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedactCSV(t *testing.T) {
+	records := [][]string{
+		{"id", "email", "author.name", "author.email", "tags[0]", "profile", "_meta.status"},
+		{"a", "taro@example.jp", "山田", "a@example.jp", "x", `{"phone":"090-1234-5678","city":"東京"}`, "PUBLISH"},
+	}
+	rules := []RedactionRule{
+		{Field: "email", Action: "drop"},
+		{Field: "author.email", Action: "hash"},
+		{Field: "tags", Action: "fake"},
+		{Field: "profile.phone", Action: "drop"},
+		{Field: "status", Action: "drop"},
+	}
+	// メタデータのカラムは保存しない
+	want := [][]string{
+		{"id", "author.name", "author.email", "tags[0]", "profile"},
+		{"a", "山田", testHMAC("salt", "a@example.jp"), "redacted-" + testHMAC("salt", "x")[:8], `{"city":"東京"}`},
+	}
+	if got := redactCSV(records, rules, "salt"); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactCSV() = %v, want %v", got, want)
+	}
+}
+
+func TestSaveRedactedContents(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	files := map[string]string{
+		"contents/users/PUBLISH/1.json":      `{"id":"a","email":"taro@example.jp"}`,
+		"contents/users/PUBLISH/1.meta.json": `{"id":"a","email":"taro@example.jp"}`,
+		"contents/blogs/PUBLISH/1.json":      `{"id":"b","email":"hanako@example.jp"}`,
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(baseDir+path[:strings.LastIndex(path, "/")], os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := Client{Config: &Config{Contents: ContentsConfig{Relations: "id", Redaction: RedactionConfig{
+		Mode:  "alongside",
+		Salt:  "secret-salt",
+		Rules: map[string][]RedactionRule{"users": {{Field: "email", Action: "drop"}}},
+	}}}}
+	if err := c.saveRedactedContents(context.Background(), baseDir); err != nil {
+		t.Fatalf("saveRedactedContents() error = %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		notWant string
+	}{
+		// 元のコンテンツは加工しない
+		{path: "contents/users/PUBLISH/1.json", want: "taro@example.jp"},
+		{path: "redacted/contents/users/PUBLISH/1.json", want: `"id": "a"`, notWant: "email"},
+		// ルールのないエンドポイントはそのまま
+		{path: "redacted/contents/blogs/PUBLISH/1.json", want: "hanako@example.jp"},
+		// 秘密の値は書き込まない
+		{path: "redacted/REDACTED", want: "users.email: drop", notWant: "secret-salt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b, err := os.ReadFile(baseDir + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tt.want) {
+				t.Errorf("%s に %q が含まれていません: %s", tt.path, tt.want, b)
+			}
+			if tt.notWant != "" && strings.Contains(string(b), tt.notWant) {
+				t.Errorf("%s に %q が含まれています: %s", tt.path, tt.notWant, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ReferenceGraph はエンドポイントをまたいだコンテンツの参照関係
+type ReferenceGraph struct {
+	Nodes []ContentNode   `json:"nodes"`
+	Edges []ReferenceEdge `json:"edges"`
+	// 存在しない(削除された)コンテンツへの参照
+	Dangling []DanglingReference `json:"dangling"`
+	// 参照先のエンドポイントがすべてバックアップされていないため、存在するかどうかを判定できない参照
+	Unknown []UnknownReference `json:"unknown"`
+}
+
+// ContentNode は参照関係の中の1件分のコンテンツ
+type ContentNode struct {
+	Endpoint string `json:"endpoint"`
+	Id       string `json:"id"`
+}
+
+// ReferenceEdge はコンテンツ参照フィールドによる参照
+// Fieldは参照元のフィールドのパス(繰り返しフィールドや複数参照の場合は"field[0].related"のような形式)
+type ReferenceEdge struct {
+	From  ContentNode `json:"from"`
+	Field string      `json:"field"`
+	To    ContentNode `json:"to"`
+}
+
+// DanglingReference はバックアップした参照先のエンドポイントに存在しないコンテンツへの参照
+type DanglingReference struct {
+	From  ContentNode `json:"from"`
+	Field string      `json:"field"`
+	Id    string      `json:"id"`
+}
+
+// UnknownReference は参照先が見つからず、参照先のエンドポイントも分からないか、
+// 絞り込んで一部のみバックアップしたエンドポイントへの参照
+type UnknownReference struct {
+	From  ContentNode `json:"from"`
+	Field string      `json:"field"`
+	Id    string      `json:"id"`
+}
+
+// newReferenceGraph はバックアップしたコンテンツから参照関係を作成する
+// スキーマは使わず、idを持つオブジェクトを参照とみなし、idが一致するコンテンツを参照先とする
+// 参照先が見つからない場合は、同じフィールドの他の参照の参照先を、そのフィールドの参照先のエンドポイントとみなし、
+// そのエンドポイントがすべてバックアップされている(completeに含まれる)場合のみ、削除されたコンテンツへの参照とする
+func newReferenceGraph(baseDir string, complete map[string]bool) (*ReferenceGraph, error) {
+	var contents []backupContent
+	endpointsByID := make(map[string][]string)
+	seen := make(map[ContentNode]bool)
+	err := readBackupContents(baseDir, func(content backupContent) error {
+		if content.Id == "" {
+			return nil
+		}
+		contents = append(contents, content)
+		node := ContentNode{Endpoint: content.Endpoint, Id: content.Id}
+		if !seen[node] {
+			seen[node] = true
+			endpointsByID[content.Id] = append(endpointsByID[content.Id], content.Endpoint)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &ReferenceGraph{
+		Nodes:    []ContentNode{},
+		Edges:    []ReferenceEdge{},
+		Dangling: []DanglingReference{},
+		Unknown:  []UnknownReference{},
+	}
+	// ステータスごとに同じコンテンツが保存されている場合があるため、重複する参照は1件にまとめる
+	seenEdges := make(map[ReferenceEdge]bool)
+	seenUnresolved := make(map[UnknownReference]bool)
+	var unresolved []UnknownReference
+	// 参照元のエンドポイントとフィールドのパス(配列の添字を除く)ごとの、参照先のエンドポイント
+	targets := make(map[[2]string]map[string]bool)
+	for node := range seen {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	for _, content := range contents {
+		from := ContentNode{Endpoint: content.Endpoint, Id: content.Id}
+
+		for _, field := range content.Fields {
+			value := gjson.Parse(field.Value)
+			if !value.IsObject() && !value.IsArray() {
+				continue
+			}
+			walkContentReferences(value, field.Key, func(path string, id string) {
+				endpoints := endpointsByID[id]
+				if len(endpoints) == 0 {
+					reference := UnknownReference{From: from, Field: path, Id: id}
+					if !seenUnresolved[reference] {
+						seenUnresolved[reference] = true
+						unresolved = append(unresolved, reference)
+					}
+					return
+				}
+				field := [2]string{content.Endpoint, referenceFieldPath(path)}
+				if targets[field] == nil {
+					targets[field] = make(map[string]bool)
+				}
+				for _, endpoint := range endpoints {
+					targets[field][endpoint] = true
+					edge := ReferenceEdge{From: from, Field: path, To: ContentNode{Endpoint: endpoint, Id: id}}
+					if !seenEdges[edge] {
+						seenEdges[edge] = true
+						graph.Edges = append(graph.Edges, edge)
+					}
+				}
+			})
+		}
+	}
+
+	// 参照先が見つからない参照は、参照先のエンドポイントがすべてバックアップされている場合のみ削除されたとみなす
+	for _, reference := range unresolved {
+		endpoints := targets[[2]string{reference.From.Endpoint, referenceFieldPath(reference.Field)}]
+		isComplete := len(endpoints) > 0
+		for endpoint := range endpoints {
+			isComplete = isComplete && complete[endpoint]
+		}
+		if isComplete {
+			graph.Dangling = append(graph.Dangling, DanglingReference(reference))
+		} else {
+			graph.Unknown = append(graph.Unknown, reference)
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return compareNodes(graph.Nodes[i], graph.Nodes[j]) < 0
+	})
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		return compareNodes(graph.Edges[i].From, graph.Edges[j].From) < 0
+	})
+	sort.SliceStable(graph.Dangling, func(i, j int) bool {
+		return compareNodes(graph.Dangling[i].From, graph.Dangling[j].From) < 0
+	})
+	sort.SliceStable(graph.Unknown, func(i, j int) bool {
+		return compareNodes(graph.Unknown[i].From, graph.Unknown[j].From) < 0
+	})
+	return graph, nil
+}
+
+// 配列の添字
+var arrayIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// referenceFieldPath は参照のフィールドのパスから配列の添字を除く
+// 複数コンテンツ参照や繰り返しフィールドの要素を、同じフィールドとして扱うために使う
+func referenceFieldPath(path string) string {
+	return arrayIndexPattern.ReplaceAllString(path, "")
+}
+
+// completeEndpoints は絞り込まずに、すべてのコンテンツをバックアップするエンドポイントを返す
+func (c Client) completeEndpoints() map[string]bool {
+	complete := make(map[string]bool)
+	for _, endpoint := range c.Config.Contents.Endpoints {
+		if endpoint.Filters == "" && endpoint.Q == "" {
+			complete[endpoint.Name] = true
+		}
+	}
+	return complete
+}
+
+func compareNodes(a, b ContentNode) int {
+	if c := strings.Compare(a.Endpoint, b.Endpoint); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Id, b.Id)
+}
+
+// walkContentReferences はJSONを再帰的に走査し、idを持つオブジェクトごとにfnを呼び出す
+func walkContentReferences(value gjson.Result, path string, fn func(path string, id string)) {
+	switch {
+	case value.IsArray():
+		for i, child := range value.Array() {
+			walkContentReferences(child, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case value.IsObject():
+		if id := value.Get("id"); id.Type == gjson.String {
+			fn(path, id.String())
+			// 参照先のコンテンツの中身は、参照先のコンテンツ自身の参照として扱うため走査しない
+			return
+		}
+		value.ForEach(func(key, child gjson.Result) bool {
+			walkContentReferences(child, path+"."+key.String(), fn)
+			return true
+		})
+	}
+}
+
+// writeReferenceGraph は参照関係をJSONとGraphVizのDOT形式でgraph/以下に保存する
+// completeは、すべてのコンテンツをバックアップしたエンドポイント
+func writeReferenceGraph(baseDir string, complete map[string]bool) error {
+	log.Println("コンテンツの参照関係を作成します")
+
+	graph, err := newReferenceGraph(baseDir, complete)
+	if err != nil {
+		return err
+	}
+	log.Printf("コンテンツ: %d件, 参照: %d件, 存在しないコンテンツへの参照: %d件, 判定できない参照: %d件\n", len(graph.Nodes), len(graph.Edges), len(graph.Dangling), len(graph.Unknown))
+
+	err = os.MkdirAll(baseDir+"graph", os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeStringAtomic(baseDir+"graph/references.json", string(b)+"\n")
+	if err != nil {
+		return err
+	}
+	return writeStringAtomic(baseDir+"graph/references.dot", graph.dot())
+}
+
+// dot はGraphVizのDOT形式の文字列を返す
+// エンドポイントごとにクラスタにまとめ、存在しないコンテンツへの参照は赤い破線、判定できない参照は灰色の点線で表す
+func (g *ReferenceGraph) dot() string {
+	var sb strings.Builder
+	sb.WriteString("digraph references {\n")
+	sb.WriteString("  node [shape=box];\n")
+
+	var endpoints []string
+	nodesByEndpoint := make(map[string][]ContentNode)
+	for _, node := range g.Nodes {
+		if _, ok := nodesByEndpoint[node.Endpoint]; !ok {
+			endpoints = append(endpoints, node.Endpoint)
+		}
+		nodesByEndpoint[node.Endpoint] = append(nodesByEndpoint[node.Endpoint], node)
+	}
+	for i, endpoint := range endpoints {
+		fmt.Fprintf(&sb, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&sb, "    label=%s;\n", dotQuote(endpoint))
+		for _, node := range nodesByEndpoint[endpoint] {
+			fmt.Fprintf(&sb, "    %s [label=%s];\n", dotQuote(node.Endpoint+"/"+node.Id), dotQuote(node.Id))
+		}
+		sb.WriteString("  }\n")
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&sb, "  %s -> %s [label=%s];\n",
+			dotQuote(edge.From.Endpoint+"/"+edge.From.Id), dotQuote(edge.To.Endpoint+"/"+edge.To.Id), dotQuote(edge.Field))
+	}
+	for _, dangling := range g.Dangling {
+		missing := "missing/" + dangling.Id
+		fmt.Fprintf(&sb, "  %s [label=%s, color=red, style=dashed];\n", dotQuote(missing), dotQuote(dangling.Id))
+		fmt.Fprintf(&sb, "  %s -> %s [label=%s, color=red, style=dashed];\n",
+			dotQuote(dangling.From.Endpoint+"/"+dangling.From.Id), dotQuote(missing), dotQuote(dangling.Field))
+	}
+
+	for _, unknown := range g.Unknown {
+		node := "unknown/" + unknown.Id
+		fmt.Fprintf(&sb, "  %s [label=%s, color=gray, style=dotted];\n", dotQuote(node), dotQuote(unknown.Id))
+		fmt.Fprintf(&sb, "  %s -> %s [label=%s, color=gray, style=dotted];\n",
+			dotQuote(unknown.From.Endpoint+"/"+unknown.From.Id), dotQuote(node), dotQuote(unknown.Field))
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotQuote はDOT形式の識別子として使えるように文字列を引用符で囲む
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sinhalite/microcms-backup-tool/mockcms"
+)
+
+func TestNewReferenceGraph(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	for _, dir := range []string{"contents/blogs/PUBLISH", "contents/blogs/DRAFT", "contents/categories/PUBLISH"} {
+		if err := os.MkdirAll(baseDir+dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		// 展開されたコンテンツ参照と、複数コンテンツ参照
+		// バックアップしていないエンドポイントへの参照(author)を含む
+		"contents/blogs/PUBLISH/1.json": `{"id":"a","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z","name":"カテゴリ"},"related":[{"id":"b","createdAt":"2024-01-01T00:00:00.000Z"},{"id":"deleted","createdAt":"2024-01-01T00:00:00.000Z"}],"author":{"id":"u1","createdAt":"2024-01-01T00:00:00.000Z"},"eyecatch":{"url":"https://images.microcms-assets.io/assets/xxx/abc/a.png"}}`,
+		// 下書きにも同じコンテンツが保存されている
+		"contents/blogs/DRAFT/1.json": `{"id":"a","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"}}`,
+		// 繰り返しフィールド内のIDのみの参照
+		"contents/blogs/PUBLISH/2.json":      `{"id":"b","repeater":[{"fieldId":"link","target":{"id":"cat1"}}]}`,
+		"contents/categories/PUBLISH/1.json": `{"id":"cat1","name":"カテゴリ"}`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	complete := map[string]bool{"blogs": true, "categories": true}
+	graph, err := newReferenceGraph(baseDir, complete)
+	if err != nil {
+		t.Fatalf("newReferenceGraph() error = %v", err)
+	}
+
+	wantNodes := []ContentNode{{"blogs", "a"}, {"blogs", "b"}, {"categories", "cat1"}}
+	if !reflect.DeepEqual(graph.Nodes, wantNodes) {
+		t.Errorf("Nodes = %v, want %v", graph.Nodes, wantNodes)
+	}
+	wantEdges := []ReferenceEdge{
+		{From: ContentNode{"blogs", "a"}, Field: "category", To: ContentNode{"categories", "cat1"}},
+		{From: ContentNode{"blogs", "a"}, Field: "related[0]", To: ContentNode{"blogs", "b"}},
+		{From: ContentNode{"blogs", "b"}, Field: "repeater[0].target", To: ContentNode{"categories", "cat1"}},
+	}
+	if !reflect.DeepEqual(graph.Edges, wantEdges) {
+		t.Errorf("Edges = %v, want %v", graph.Edges, wantEdges)
+	}
+	wantDangling := []DanglingReference{{From: ContentNode{"blogs", "a"}, Field: "related[1]", Id: "deleted"}}
+	if !reflect.DeepEqual(graph.Dangling, wantDangling) {
+		t.Errorf("Dangling = %v, want %v", graph.Dangling, wantDangling)
+	}
+	wantUnknown := []UnknownReference{{From: ContentNode{"blogs", "a"}, Field: "author", Id: "u1"}}
+	if !reflect.DeepEqual(graph.Unknown, wantUnknown) {
+		t.Errorf("Unknown = %v, want %v", graph.Unknown, wantUnknown)
+	}
+
+	// 参照先のエンドポイントを絞り込んでバックアップした場合は、削除されたとはみなさない
+	filtered, err := newReferenceGraph(baseDir, map[string]bool{"categories": true})
+	if err != nil {
+		t.Fatalf("newReferenceGraph() error = %v", err)
+	}
+	wantUnknown = []UnknownReference{{From: ContentNode{"blogs", "a"}, Field: "related[1]", Id: "deleted"}, {From: ContentNode{"blogs", "a"}, Field: "author", Id: "u1"}}
+	if len(filtered.Dangling) != 0 || !reflect.DeepEqual(filtered.Unknown, wantUnknown) {
+		t.Errorf("Dangling = %v, Unknown = %v, want [], %v", filtered.Dangling, filtered.Unknown, wantUnknown)
+	}
+
+	if err := writeReferenceGraph(baseDir, complete); err != nil {
+		t.Fatalf("writeReferenceGraph() error = %v", err)
+	}
+	dot, err := os.ReadFile(baseDir + "graph/references.dot")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, want := range []string{
+		`"blogs/a" -> "categories/cat1" [label="category"];`,
+		`"blogs/a" -> "missing/deleted" [label="related[1]", color=red, style=dashed];`,
+		`"blogs/a" -> "unknown/u1" [label="author", color=gray, style=dotted];`,
+	} {
+		if !strings.Contains(string(dot), want) {
+			t.Errorf("references.dot に %s が含まれていません:\n%s", want, dot)
+		}
+	}
+	if _, err := os.Stat(baseDir + "graph/references.json"); err != nil {
+		t.Errorf("references.json が保存されていません: %v", err)
+	}
+}
+
+// コンテンツ参照をIDで保存したバックアップでも、展開して保存した場合と同じ参照関係になる
+func TestNewReferenceGraphWithRelationIDs(t *testing.T) {
+	keys := testMockKeys()
+	wantEdges := []ReferenceEdge{
+		{From: ContentNode{"blogs", "a"}, Field: "category", To: ContentNode{"categories", "news"}},
+		{From: ContentNode{"blogs", "a"}, Field: "related[0]", To: ContentNode{"blogs", "b"}},
+		{From: ContentNode{"blogs", "b"}, Field: "repeater[0].target", To: ContentNode{"categories", "news"}},
+	}
+	wantDangling := []DanglingReference{{From: ContentNode{"blogs", "a"}, Field: "related[1]", Id: "deleted"}}
+
+	tests := []struct {
+		relations string
+		format    string
+	}{
+		{relations: "expanded", format: "json"},
+		{relations: "id", format: "json"},
+		{relations: "id", format: "csv"},
+		{relations: "id", format: "ndjson"},
+		{relations: "both", format: "json"},
+		{relations: "both", format: "csv"},
+		{relations: "both", format: "ndjson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relations+" "+tt.format, func(t *testing.T) {
+			fixture := testMockFixture()
+			fixture.Contents["blogs"] = []mockcms.Content{
+				{Status: "PUBLISH", Body: `{"id":"a","category":{"id":"news","createdAt":"2024-01-01T00:00:00.000Z","name":"ニュース"},"related":[{"id":"b","createdAt":"2024-01-01T00:00:00.000Z"},{"id":"deleted","createdAt":"2024-01-01T00:00:00.000Z"}]}`},
+				{Status: "PUBLISH", Body: `{"id":"b","repeater":[{"fieldId":"link","target":{"id":"news","createdAt":"2024-01-01T00:00:00.000Z"}}]}`},
+			}
+			fixture.Schemas["blogs"] = `[{"fieldId":"category","kind":"relation"},{"fieldId":"related","kind":"relationList"},{"fieldId":"repeater","kind":"repeater","customFieldCreatedAtList":["2024-01-01T00:00:00.000Z"]}]`
+			fixture.CustomFields = map[string]string{"blogs": `[{"fieldId":"link","createdAt":"2024-01-01T00:00:00.000Z","fields":[{"fieldId":"target","kind":"relation"}]}]`}
+			fixture.Schemas["categories"] = `[{"fieldId":"name","kind":"text"}]`
+			server := mockcms.NewServer(fixture)
+			defer server.Close()
+
+			baseDir := t.TempDir() + "/"
+			client := newMockClient(server, &Config{
+				Target: "contents",
+				Contents: ContentsConfig{
+					GetPublishContentsAPIKey:  keys.Publish,
+					GetContentsMetaDataAPIKey: keys.MetaData,
+					Endpoints:                 []Endpoint{{Name: "blogs"}, {Name: "categories"}},
+					RequestUnit:               10,
+					Format:                    tt.format,
+					Relations:                 tt.relations,
+				},
+			})
+			if err := client.BackupContents(context.Background(), baseDir); err != nil {
+				t.Fatalf("BackupContents() error = %v", err)
+			}
+
+			graph, err := newReferenceGraph(baseDir, client.completeEndpoints())
+			if err != nil {
+				t.Fatalf("newReferenceGraph() error = %v", err)
+			}
+			if !reflect.DeepEqual(graph.Edges, wantEdges) {
+				t.Errorf("Edges = %v, want %v", graph.Edges, wantEdges)
+			}
+			if !reflect.DeepEqual(graph.Dangling, wantDangling) {
+				t.Errorf("Dangling = %v, want %v", graph.Dangling, wantDangling)
+			}
+		})
+	}
+}
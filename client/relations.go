@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// storesRelationIDs はコンテンツ参照をIDの文字列で保存するかどうかを返す
+func (c Client) storesRelationIDs() bool {
+	return c.Config.Contents.Relations == "id" || c.Config.Contents.Relations == "both"
+}
+
+// keepsExpandedRelations はIDで保存する場合に、展開されたコンテンツ参照も別のファイルに残すかどうかを返す
+func (c Client) keepsExpandedRelations() bool {
+	return c.Config.Contents.Relations == "both"
+}
+
+// relationContents はコンテンツ参照の保存形式に応じて、コンテンツ参照をIDに置き換えたコンテンツを返す
+func (c Client) relationContents(endpoint string, contents []gjson.Result) []gjson.Result {
+	if !c.storesRelationIDs() {
+		return contents
+	}
+	paths := c.relationFields.schemaPaths(endpoint)
+	compacted := make([]gjson.Result, len(contents))
+	for i, item := range contents {
+		compacted[i] = gjson.Parse(compactRelations(item.Raw, paths, nil))
+	}
+	return compacted
+}
+
+// relationFieldsFileName はIDの文字列で保存したコンテンツ参照のフィールドのパスを記録するファイル
+// バックアップを読み込む際に、このパスのIDをコンテンツ参照として扱う
+const relationFieldsFileName = "contents.relations.json"
+
+// relationFieldsRecorder は保存先ディレクトリごとに、IDで保存したコンテンツ参照のフィールドのパスを記録する
+// パスはフィールドIDを"."でつないだもので、配列の添字は含まない(例: "repeater.target")
+type relationFieldsRecorder struct {
+	dirs map[string]map[string]bool
+	// エンドポイントごとの、APIスキーマから求めたコンテンツ参照のフィールドのパス
+	schemas map[string]map[string]bool
+}
+
+func newRelationFieldsRecorder() *relationFieldsRecorder {
+	return &relationFieldsRecorder{
+		dirs:    make(map[string]map[string]bool),
+		schemas: make(map[string]map[string]bool),
+	}
+}
+
+// loadRelationFields は設定されたエンドポイントのAPIスキーマから、コンテンツ参照のフィールドを読み込む
+// APIスキーマの取得にはgetContentsMetaDataAPIKeyを使用する
+func (c Client) loadRelationFields(ctx context.Context) (*relationFieldsRecorder, error) {
+	if c.Config.Contents.GetContentsMetaDataAPIKey == "" {
+		return nil, errors.New("コンテンツ参照をIDで保存する場合は、APIスキーマを取得するためにgetContentsMetaDataAPIKeyを指定してください")
+	}
+	r := newRelationFieldsRecorder()
+	for _, endpoint := range c.Config.Contents.Endpoints {
+		schema, err := c.getAPISchema(ctx, endpoint.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%sのAPIスキーマの取得でエラーが発生しました: %w", endpoint.Name, err)
+		}
+		r.schemas[endpoint.Name] = schema.relationPaths()
+	}
+	return r, nil
+}
+
+// schemaPaths はエンドポイントのコンテンツ参照のフィールドのパスを返す
+func (r *relationFieldsRecorder) schemaPaths(endpoint string) map[string]bool {
+	if r == nil {
+		return nil
+	}
+	return r.schemas[endpoint]
+}
+
+// compact はエンドポイントのコンテンツ参照をIDの文字列に置き換え、置き換えたフィールドのパスをdirに記録する
+// 中断から再開した場合も、記録済みのパスに追加する
+func (r *relationFieldsRecorder) compact(endpoint, dir, itemRaw string) (string, error) {
+	paths, ok := r.dirs[dir]
+	if !ok {
+		var err error
+		paths, err = readRelationFields(dir)
+		if err != nil {
+			return "", err
+		}
+		if paths == nil {
+			paths = make(map[string]bool)
+		}
+		r.dirs[dir] = paths
+	}
+
+	added := false
+	compacted := compactRelations(itemRaw, r.schemas[endpoint], func(path string) {
+		if !paths[path] {
+			paths[path] = true
+			added = true
+		}
+	})
+	if !added {
+		return compacted, nil
+	}
+	b, err := json.Marshal(slices.Sorted(maps.Keys(paths)))
+	if err != nil {
+		return "", err
+	}
+	return compacted, writeStringAtomic(dir+"/"+relationFieldsFileName, string(b)+"\n")
+}
+
+// compactRelationsIn はエンドポイントのコンテンツ参照をIDの文字列に置き換え、置き換えたフィールドのパスをdirに記録する
+func (c Client) compactRelationsIn(endpoint, dir, itemRaw string) (string, error) {
+	if c.relationFields == nil {
+		return "", errors.New("コンテンツ参照のフィールドが読み込まれていません")
+	}
+	return c.relationFields.compact(endpoint, dir, itemRaw)
+}
+
+// readRelationFields はdirに記録された、IDで保存したコンテンツ参照のフィールドのパスを返す
+// 記録がない場合はnilを返す
+func readRelationFields(dir string) (map[string]bool, error) {
+	b, err := os.ReadFile(dir + "/" + relationFieldsFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("%sを読み込めませんでした: %w", relationFieldsFileName, err)
+	}
+	paths := make(map[string]bool, len(list))
+	for _, path := range list {
+		paths[path] = true
+	}
+	return paths, nil
+}
+
+// compactRelations はコンテンツのJSON文字列について、pathsのフィールドのコンテンツ参照を
+// IDの文字列に置き換えたJSON文字列を返す
+// 複数コンテンツ参照はIDの配列となり、繰り返しフィールドやカスタムフィールドの中も置き換える
+// キーの順序はそのまま保持する
+// recordを指定した場合は、置き換えたフィールドのパスごとに呼び出す
+func compactRelations(itemRaw string, paths map[string]bool, record func(path string)) string {
+	item := gjson.Parse(itemRaw)
+	if len(paths) == 0 || !item.IsObject() {
+		return itemRaw
+	}
+	var sb strings.Builder
+	writeCompactedValue(&sb, item, "", paths, record)
+	return sb.String()
+}
+
+// compactRelationValue はフィールドの値のJSON文字列について、pathsのコンテンツ参照をIDの文字列に置き換える
+// pathsはフィールドの中のパス(カスタムフィールドのフィールドIDなど)とする
+func compactRelationValue(raw string, paths map[string]bool) string {
+	if len(paths) == 0 {
+		return raw
+	}
+	var sb strings.Builder
+	writeCompactedValue(&sb, gjson.Parse(raw), "", paths, nil)
+	return sb.String()
+}
+
+func writeCompactedValue(sb *strings.Builder, value gjson.Result, path string, paths map[string]bool, record func(path string)) {
+	switch {
+	case paths[path] && (value.IsObject() || value.IsArray()):
+		// コンテンツ参照はIDを元のJSON文字列のまま書き出し、複数コンテンツ参照は各要素をIDにする
+		compacted := false
+		writeRelationID := func(element gjson.Result) {
+			if id := element.Get("id"); element.IsObject() && id.Type == gjson.String {
+				sb.WriteString(id.Raw)
+				compacted = true
+				return
+			}
+			sb.WriteString(element.Raw)
+		}
+		if value.IsObject() {
+			writeRelationID(value)
+		} else {
+			sb.WriteString("[")
+			for i, element := range value.Array() {
+				if i > 0 {
+					sb.WriteString(",")
+				}
+				writeRelationID(element)
+			}
+			sb.WriteString("]")
+		}
+		if compacted && record != nil {
+			record(path)
+		}
+	case value.IsObject():
+		sb.WriteString("{")
+		first := true
+		value.ForEach(func(key, child gjson.Result) bool {
+			if !first {
+				sb.WriteString(",")
+			}
+			first = false
+			sb.WriteString(key.Raw)
+			sb.WriteString(":")
+			writeCompactedValue(sb, child, joinFieldPath(path, key.String()), paths, record)
+			return true
+		})
+		sb.WriteString("}")
+	case value.IsArray():
+		// 配列の要素は同じパスとする
+		sb.WriteString("[")
+		for i, child := range value.Array() {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			writeCompactedValue(sb, child, path, paths, record)
+		}
+		sb.WriteString("]")
+	default:
+		sb.WriteString(value.Raw)
+	}
+}
+
+// joinFieldPath はフィールドのパスにフィールドIDを追加する
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// subFieldPaths はpathsのうち、フィールドの中のパスをフィールドIDを除いて返す
+// 該当するパスがない場合はnilを返す
+func subFieldPaths(paths map[string]bool, key string) map[string]bool {
+	var sub map[string]bool
+	for path := range paths {
+		if rest, ok := strings.CutPrefix(path, key+"."); ok {
+			if sub == nil {
+				sub = make(map[string]bool)
+			}
+			sub[rest] = true
+		}
+	}
+	return sub
+}
+
+// expandRelationIDs はコンテンツのJSON文字列について、pathsに記録されたフィールドのIDの文字列を
+// IDのみのコンテンツ参照({"id":"..."})に置き換えたJSON文字列を返す
+// compactRelationsで保存したコンテンツを、展開して保存したものと同じように参照として扱うために使う
+func expandRelationIDs(itemRaw string, paths map[string]bool) string {
+	item := gjson.Parse(itemRaw)
+	if len(paths) == 0 || !item.IsObject() {
+		return itemRaw
+	}
+	var sb strings.Builder
+	writeExpandedValue(&sb, item, "", paths)
+	return sb.String()
+}
+
+// expandRelationField はCSVのセルの値について、pathsに記録されたフィールドのIDを
+// IDのみのコンテンツ参照に置き換えた値を返す
+func expandRelationField(key, cell string, paths map[string]bool) string {
+	if len(paths) == 0 || cell == "" {
+		return cell
+	}
+	value := gjson.Parse(cell)
+	if !json.Valid([]byte(cell)) || (!value.IsObject() && !value.IsArray()) {
+		// JSONとして解釈できないセルは、IDの文字列とする
+		if !paths[key] {
+			return cell
+		}
+		b, _ := json.Marshal(map[string]string{"id": cell})
+		return string(b)
+	}
+	var sb strings.Builder
+	writeExpandedValue(&sb, value, key, paths)
+	return sb.String()
+}
+
+func writeExpandedValue(sb *strings.Builder, value gjson.Result, path string, paths map[string]bool) {
+	switch {
+	case value.Type == gjson.String && paths[path]:
+		sb.WriteString(`{"id":`)
+		sb.WriteString(value.Raw)
+		sb.WriteString("}")
+	case value.IsObject():
+		sb.WriteString("{")
+		first := true
+		value.ForEach(func(key, child gjson.Result) bool {
+			if !first {
+				sb.WriteString(",")
+			}
+			first = false
+			sb.WriteString(key.Raw)
+			sb.WriteString(":")
+			writeExpandedValue(sb, child, joinFieldPath(path, key.String()), paths)
+			return true
+		})
+		sb.WriteString("}")
+	case value.IsArray():
+		sb.WriteString("[")
+		for i, child := range value.Array() {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			writeExpandedValue(sb, child, path, paths)
+		}
+		sb.WriteString("]")
+	default:
+		sb.WriteString(value.Raw)
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRelationFields はエンドポイントごとのコンテンツ参照のフィールドのパスを記録したrelationFieldsRecorderを返す
+func testRelationFields(schemas map[string][]string) *relationFieldsRecorder {
+	r := newRelationFieldsRecorder()
+	for endpoint, paths := range schemas {
+		r.schemas[endpoint] = make(map[string]bool)
+		for _, path := range paths {
+			r.schemas[endpoint][path] = true
+		}
+	}
+	return r
+}
+
+func TestRelationPaths(t *testing.T) {
+	schema := apiSchema{
+		APIFields: []APIField{
+			{FieldId: "title", Kind: "text"},
+			{FieldId: "category", Kind: "relation"},
+			{FieldId: "related", Kind: "relationList"},
+			{FieldId: "seo", Kind: "custom", CustomFieldCreatedAt: "c1"},
+			{FieldId: "repeater", Kind: "repeater", CustomFieldCreatedAtList: []string{"c1", "c2"}},
+		},
+		CustomFields: []APICustomField{
+			{FieldId: "link", CreatedAt: "c1", Fields: []APIField{{FieldId: "target", Kind: "relation"}, {FieldId: "image", Kind: "media"}}},
+			// 自身を含むカスタムフィールドは、1段階のみ辿る
+			{FieldId: "nested", CreatedAt: "c2", Fields: []APIField{{FieldId: "items", Kind: "relationList"}, {FieldId: "child", Kind: "custom", CustomFieldCreatedAt: "c2"}}},
+		},
+	}
+	want := map[string]bool{"category": true, "related": true, "seo.target": true, "repeater.target": true, "repeater.items": true}
+	if got := schema.relationPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("relationPaths() = %v, want %v", got, want)
+	}
+}
+
+func TestCompactRelations(t *testing.T) {
+	paths := map[string]bool{"category": true, "related": true, "repeater.target": true}
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "コンテンツ参照",
+			raw:  `{"id":"a","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z","name":"カテゴリ"},"title":"タイトル"}`,
+			want: `{"id":"a","category":"cat1","title":"タイトル"}`,
+		},
+		{
+			name: "複数コンテンツ参照",
+			raw:  `{"id":"a","related":[{"id":"b","createdAt":"2024-01-01T00:00:00.000Z"},{"id":"c"}]}`,
+			want: `{"id":"a","related":["b","c"]}`,
+		},
+		{
+			name: "繰り返しフィールド内の参照",
+			raw:  `{"id":"a","repeater":[{"fieldId":"link","target":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"},"label":"x"}]}`,
+			want: `{"id":"a","repeater":[{"fieldId":"link","target":"cat1","label":"x"}]}`,
+		},
+		{
+			name: "参照ではないオブジェクトはそのまま",
+			raw:  `{"id":"a","eyecatch":{"url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","width":100},"select":["x"],"empty":null}`,
+			want: `{"id":"a","eyecatch":{"url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","width":100},"select":["x"],"empty":null}`,
+		},
+		{
+			// APIスキーマでコンテンツ参照でないフィールドは、idを持つオブジェクトでも置き換えない
+			name: "スキーマにないidを持つオブジェクト",
+			raw:  `{"id":"a","custom":{"id":"x","fieldId":"seo"},"repeater":[{"fieldId":"link","other":{"id":"y"}}]}`,
+			want: `{"id":"a","custom":{"id":"x","fieldId":"seo"},"repeater":[{"fieldId":"link","other":{"id":"y"}}]}`,
+		},
+		{
+			name: "nullのコンテンツ参照",
+			raw:  `{"id":"a","category":null,"related":[]}`,
+			want: `{"id":"a","category":null,"related":[]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compactRelations(tt.raw, paths, nil); got != tt.want {
+				t.Errorf("compactRelations() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRawJSONWithRelations(t *testing.T) {
+	raw := `{"id":"a","category":{"id":"cat1","createdAt":"2024-01-01T00:00:00.000Z"}}`
+	tests := []struct {
+		relations    string
+		wantJSON     string
+		wantExpanded bool
+	}{
+		{relations: "", wantJSON: "\"category\": {", wantExpanded: false},
+		{relations: "id", wantJSON: "\"category\": \"cat1\"", wantExpanded: false},
+		{relations: "both", wantJSON: "\"category\": \"cat1\"", wantExpanded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.relations, func(t *testing.T) {
+			baseDir := t.TempDir() + "/"
+			c := Client{
+				Config:         &Config{Contents: ContentsConfig{Relations: tt.relations}},
+				relationFields: testRelationFields(map[string][]string{"blogs": {"category"}}),
+			}
+			if err := c.writeRawJSONWithStatus(raw, baseDir, "blogs", 1, "PUBLISH", ""); err != nil {
+				t.Fatalf("writeRawJSONWithStatus() error = %v", err)
+			}
+
+			b, err := os.ReadFile(baseDir + "contents/blogs/PUBLISH/1.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), tt.wantJSON) {
+				t.Errorf("1.json = %s, want to contain %s", b, tt.wantJSON)
+			}
+
+			_, err = os.Stat(baseDir + "contents/blogs/PUBLISH/1.expanded.json")
+			if gotExpanded := err == nil; gotExpanded != tt.wantExpanded {
+				t.Errorf("1.expanded.json exists = %v, want %v", gotExpanded, tt.wantExpanded)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mediaURLMappingPath はアップロード先のサービスごとの、メディアの旧URLから新URLへの対応表のパスを返す
+// 同じバックアップを別のサービスにリストア・移行した場合に、他のサービスのURLを使わないようにする
+func mediaURLMappingPath(backupDir, serviceID string) string {
+	return backupDir + "media/url_mapping_" + serviceID + ".json"
+}
+
+// ManagementAPIMediaUploadResponse はメディアのアップロードAPIのレスポンス
+type ManagementAPIMediaUploadResponse struct {
+	Url string `json:"url"`
+}
+
+// RestoreMedia はバックアップしたメディアをマネジメントAPIでアップロードし直す
+// アップロード後、旧URLから新URLへの対応表をmedia/url_mapping_<サービスID>.jsonに保存する
+// 対応表に記録済みのメディアはスキップするため、中断した場合も再実行できる
+func (c Client) RestoreMedia(ctx context.Context, backupDir string) error {
+	if c.Config.ServiceID == "" {
+		return errors.New("メディアのアップロード先のサービスIDを設定してください")
+	}
+	log.Println("メディアのリストアを開始します")
+
+	files, err := listBackupMediaFiles(backupDir)
+	if err != nil {
+		return fmt.Errorf("メディアファイルの一覧の取得でエラーが発生しました: %w", err)
+	}
+
+	// バックアップ時の一覧から、保存先のパスに対応する旧URLを引けるようにする
+	oldURLs, err := loadMediaURLsByLocalPath(backupDir)
+	if err != nil {
+		return fmt.Errorf("メディア一覧の読み込みでエラーが発生しました: %w", err)
+	}
+
+	mapping, err := LoadMediaURLMapping(backupDir, c.Config.ServiceID)
+	if err != nil {
+		return fmt.Errorf("URLの対応表の読み込みでエラーが発生しました: %w", err)
+	}
+
+	uploaded := 0
+	for i, localPath := range files {
+		// 一覧にないメディアは、保存先のパスを旧URLの代わりに使う
+		oldURL, ok := oldURLs[localPath]
+		if !ok {
+			oldURL = localPath
+		}
+
+		// 進捗状況の表示
+		fmt.Printf("[%d / %d] %s\n", i+1, len(files), localPath)
+
+		if _, ok := mapping[oldURL]; ok {
+			continue
+		}
+
+		if uploaded > 0 {
+			if err := sleep(ctx, 1*time.Second); err != nil {
+				return err
+			}
+		}
+
+		newURL, err := c.uploadMedia(ctx, backupDir+localPath)
+		if err != nil {
+			return fmt.Errorf("%sのアップロードでエラーが発生しました: %w", localPath, err)
+		}
+		mapping[oldURL] = newURL
+		uploaded++
+
+		// 中断した場合に同じメディアを重複してアップロードしないよう、1件ごとに保存する
+		err = writeMediaURLMapping(backupDir, c.Config.ServiceID, mapping)
+		if err != nil {
+			return fmt.Errorf("URLの対応表の保存でエラーが発生しました: %w", err)
+		}
+	}
+
+	log.Println("正常にメディアのリストアが終了しました")
+	return nil
+}
+
+func (c Client) uploadMedia(ctx context.Context, filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/v1/media", c.managementAPIURL())
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, &body)
+	req.Header.Set("X-MICROCMS-API-KEY", c.Config.Media.UploadAPIKey)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := new(http.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	response := &ManagementAPIMediaUploadResponse{}
+	err = json.Unmarshal(respBody, response)
+	if err != nil {
+		return "", err
+	}
+	if response.Url == "" {
+		return "", fmt.Errorf("アップロード後のURLを取得できませんでした")
+	}
+	return response.Url, nil
+}
+
+// listBackupMediaFiles はバックアップのmedia/<ディレクトリ>/<ファイル名>を
+// バックアップディレクトリからの相対パスで返す
+func listBackupMediaFiles(backupDir string) ([]string, error) {
+	dirs, err := os.ReadDir(backupDir + "media")
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(backupDir + "media/" + dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// 書き込み途中で残った一時ファイルは対象外とする
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), tempFilePrefix) {
+				continue
+			}
+			files = append(files, "media/"+dir.Name()+"/"+entry.Name())
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadMediaURLsByLocalPath はmedia/index.jsonから、保存先のパスと旧URLの対応を返す
+// 一覧が存在しない場合は空の対応を返す
+func loadMediaURLsByLocalPath(backupDir string) (map[string]string, error) {
+	urls := make(map[string]string)
+
+	b, err := os.ReadFile(backupDir + "media/index.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return urls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []MediaIndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		urls[entry.LocalPath] = entry.Url
+	}
+	return urls, nil
+}
+
+// LoadMediaURLMapping はアップロード先のサービスの対応表から、旧URLと新URLの対応を読み込む
+// 対応表が存在しない場合は空の対応表を返す
+func LoadMediaURLMapping(backupDir, serviceID string) (map[string]string, error) {
+	mapping := make(map[string]string)
+
+	b, err := os.ReadFile(mediaURLMappingPath(backupDir, serviceID))
+	if errors.Is(err, os.ErrNotExist) {
+		return mapping, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &mapping); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+func writeMediaURLMapping(backupDir, serviceID string, mapping map[string]string) error {
+	b, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStringAtomic(mediaURLMappingPath(backupDir, serviceID), string(b)+"\n")
+}
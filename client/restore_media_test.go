@@ -0,0 +1,93 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListBackupMediaFiles(t *testing.T) {
+	backupDir := t.TempDir() + "/"
+	files := []string{
+		"media/b/file.pdf",
+		"media/a/image.png",
+		"media/a/" + tempFilePrefix + "image.png-123",
+		"media/index.json",
+	}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Dir(backupDir+file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(backupDir+file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := listBackupMediaFiles(backupDir)
+	if err != nil {
+		t.Fatalf("listBackupMediaFiles() error = %v", err)
+	}
+	want := []string{"media/a/image.png", "media/b/file.pdf"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listBackupMediaFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestMediaURLMapping(t *testing.T) {
+	backupDir := t.TempDir() + "/"
+	if err := os.MkdirAll(backupDir+"media", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// 対応表が存在しない場合は空の対応表になる
+	mapping, err := LoadMediaURLMapping(backupDir, "service-a")
+	if err != nil {
+		t.Fatalf("LoadMediaURLMapping() error = %v", err)
+	}
+	if len(mapping) != 0 {
+		t.Errorf("LoadMediaURLMapping() = %v, want empty", mapping)
+	}
+
+	mapping["https://example.com/old/image.png"] = "https://example.com/new/image.png"
+	if err := writeMediaURLMapping(backupDir, "service-a", mapping); err != nil {
+		t.Fatalf("writeMediaURLMapping() error = %v", err)
+	}
+	got, err := LoadMediaURLMapping(backupDir, "service-a")
+	if err != nil {
+		t.Fatalf("LoadMediaURLMapping() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, mapping) {
+		t.Errorf("LoadMediaURLMapping() = %v, want %v", got, mapping)
+	}
+
+	// 別のサービスの対応表は使わない
+	got, err = LoadMediaURLMapping(backupDir, "service-b")
+	if err != nil {
+		t.Fatalf("LoadMediaURLMapping() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("別のサービスの LoadMediaURLMapping() = %v, want empty", got)
+	}
+}
+
+func TestLoadMediaURLsByLocalPath(t *testing.T) {
+	backupDir := t.TempDir() + "/"
+	if err := os.MkdirAll(backupDir+"media", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []MediaIndexEntry{{Id: "a", Url: "https://example.com/a/image.png", LocalPath: "media/a/image.png"}}
+	if err := writeMediaIndex(backupDir, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadMediaURLsByLocalPath(backupDir)
+	if err != nil {
+		t.Fatalf("loadMediaURLsByLocalPath() error = %v", err)
+	}
+	want := map[string]string{"media/a/image.png": "https://example.com/a/image.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadMediaURLsByLocalPath() = %v, want %v", got, want)
+	}
+}
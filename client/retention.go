@@ -0,0 +1,64 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// applyRetention はrootDir以下の完了したバックアップのうち、保持の設定を超えたものを削除し、削除したディレクトリを返す
+// 最新の完了したバックアップは常に残し、中断・失敗したバックアップ(再開に使うため)や日時の形式でないディレクトリは削除しない
+func applyRetention(rootDir string, retention RetentionConfig, now time.Time) ([]string, error) {
+	if retention.Keep <= 0 && retention.MaxAgeDays <= 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(rootDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		dir       string
+		createdAt time.Time
+	}
+	var completed []backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(backupDirTimeFormat, entry.Name(), now.Location())
+		if err != nil {
+			continue
+		}
+		dir := rootDir + entry.Name() + "/"
+		if IsCompleteBackup(dir) {
+			completed = append(completed, backup{dir: dir, createdAt: createdAt})
+		}
+	}
+	// 新しい順に並べる
+	slices.SortFunc(completed, func(a, b backup) int {
+		return b.createdAt.Compare(a.createdAt)
+	})
+
+	var removed []string
+	for i, b := range completed {
+		if i == 0 {
+			continue
+		}
+		expired := retention.MaxAgeDays > 0 && now.Sub(b.createdAt) > time.Duration(retention.MaxAgeDays)*24*time.Hour
+		if (retention.Keep > 0 && i >= retention.Keep) || expired {
+			if err := os.RemoveAll(b.dir); err != nil {
+				return removed, err
+			}
+			log.Printf("保持期間を過ぎたバックアップを削除しました: %s\n", b.dir)
+			removed = append(removed, b.dir)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	// バックアップディレクトリ名と、完了したバックアップかどうか
+	backups := []struct {
+		name     string
+		complete bool
+	}{
+		{name: "2024_01_10_03_00_00", complete: true},
+		{name: "2024_01_09_03_00_00", complete: false},
+		{name: "2024_01_08_03_00_00", complete: true},
+		{name: "2024_01_05_03_00_00", complete: true},
+		{name: "2024_01_01_03_00_00", complete: true},
+		{name: "manual", complete: true},
+	}
+	tests := []struct {
+		name      string
+		retention RetentionConfig
+		want      []string
+	}{
+		{name: "指定なし", retention: RetentionConfig{}, want: nil},
+		{name: "数", retention: RetentionConfig{Keep: 2}, want: []string{"2024_01_05_03_00_00", "2024_01_01_03_00_00"}},
+		{name: "日数", retention: RetentionConfig{MaxAgeDays: 7}, want: []string{"2024_01_01_03_00_00"}},
+		{name: "数と日数", retention: RetentionConfig{Keep: 3, MaxAgeDays: 3}, want: []string{"2024_01_05_03_00_00", "2024_01_01_03_00_00"}},
+		// 最新の完了したバックアップは残す
+		{name: "すべて期限切れ", retention: RetentionConfig{MaxAgeDays: 1}, want: []string{"2024_01_08_03_00_00", "2024_01_05_03_00_00", "2024_01_01_03_00_00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := t.TempDir() + "/"
+			for _, b := range backups {
+				dir := rootDir + b.name + "/"
+				if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if b.complete {
+					if err := writeCompleteMarker(dir); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			removed, err := applyRetention(rootDir, tt.retention, now)
+			if err != nil {
+				t.Fatalf("applyRetention() error = %v", err)
+			}
+			var want []string
+			for _, name := range tt.want {
+				want = append(want, rootDir+name+"/")
+			}
+			if !slices.Equal(removed, want) {
+				t.Errorf("applyRetention() = %v, want %v", removed, want)
+			}
+			for _, b := range backups {
+				_, err := os.Stat(rootDir + b.name)
+				if exists := err == nil; exists == slices.Contains(tt.want, b.name) {
+					t.Errorf("%s: 存在する = %v", b.name, exists)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule はcron形式(分 時 日 月 曜日)で指定された実行日時
+type schedule struct {
+	minute, hour, day, month, weekday uint64
+	// 日と曜日の両方を指定した場合は、いずれかに一致すれば実行する(cronと同じ)
+	dayRestricted, weekdayRestricted bool
+}
+
+// 次の実行日時を探す期間の上限
+const scheduleSearchYears = 5
+
+// parseSchedule はcron形式の文字列を解析する
+// 各フィールドには"*"、"5"、"1-5"、"*/15"、"1-5/2"、"1,3,5"の形式が使える
+// "@hourly"・"@daily"・"@weekly"・"@monthly"も指定できる
+func parseSchedule(spec string) (schedule, error) {
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return schedule{}, fmt.Errorf("スケジュールは「分 時 日 月 曜日」の5つのフィールドで指定してください: %q", spec)
+	}
+
+	var s schedule
+	var err error
+	if s.minute, err = parseScheduleField(fields[0], 0, 59); err != nil {
+		return schedule{}, fmt.Errorf("分の指定が正しくありません: %w", err)
+	}
+	if s.hour, err = parseScheduleField(fields[1], 0, 23); err != nil {
+		return schedule{}, fmt.Errorf("時の指定が正しくありません: %w", err)
+	}
+	if s.day, err = parseScheduleField(fields[2], 1, 31); err != nil {
+		return schedule{}, fmt.Errorf("日の指定が正しくありません: %w", err)
+	}
+	if s.month, err = parseScheduleField(fields[3], 1, 12); err != nil {
+		return schedule{}, fmt.Errorf("月の指定が正しくありません: %w", err)
+	}
+	// 曜日は0(日曜日)から6(土曜日)で、7も日曜日として扱う
+	if s.weekday, err = parseScheduleField(fields[4], 0, 7); err != nil {
+		return schedule{}, fmt.Errorf("曜日の指定が正しくありません: %w", err)
+	}
+	if s.weekday&(1<<7) != 0 {
+		s.weekday |= 1
+	}
+	s.dayRestricted = fields[2] != "*"
+	s.weekdayRestricted = fields[4] != "*"
+	return s, nil
+}
+
+// parseScheduleField はフィールドを解析し、一致する値のビットを立てた値を返す
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("間隔は1以上の数値で指定してください: %q", part)
+			}
+		}
+
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			start, err1 = strconv.Atoi(from)
+			end, err2 = strconv.Atoi(to)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("範囲は数値で指定してください: %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("数値で指定してください: %q", part)
+			}
+			start = n
+			// "5/10"は5から最大値までの間隔とみなす
+			if !hasStep {
+				end = n
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%dから%dの範囲で指定してください: %q", min, max, part)
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+	return bits, nil
+}
+
+// next はtより後で、スケジュールに一致する最初の日時を返す
+// 一致する日時がない場合(2月30日など)は、ゼロ値を返す
+func (s schedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(scheduleSearchYears, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchesDay は日付が日・曜日の指定に一致するかどうかを返す
+func (s schedule) matchesDay(t time.Time) bool {
+	day := s.day&(1<<t.Day()) != 0
+	weekday := s.weekday&(1<<int(t.Weekday())) != 0
+	if s.dayRestricted && s.weekdayRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2024-01-01は月曜日
+	from := time.Date(2024, 1, 1, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{spec: "* * * * *", want: time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{spec: "0 3 * * *", want: time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 9-17/4 * * *", want: time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 0", want: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1,15 * *", want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		// 日と曜日の両方を指定した場合は、いずれかに一致した日
+		{spec: "0 0 15 * 3", want: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{spec: "@monthly", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// 一致する日時がない
+		{spec: "0 0 30 2 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("parseSchedule() error = %v", err)
+			}
+			if got := s.next(from); !got.Equal(tt.want) {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleError(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := parseSchedule(spec); err == nil {
+				t.Errorf("parseSchedule(%q) error = nil", spec)
+			}
+		})
+	}
+}
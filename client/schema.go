@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// APIField はAPIスキーマのフィールド
+type APIField struct {
+	FieldId  string `json:"fieldId"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Required bool   `json:"required"`
+	// カスタムフィールドの場合に、使用するカスタムフィールドの作成日時
+	CustomFieldCreatedAt string `json:"customFieldCreatedAt,omitempty"`
+	// 繰り返しフィールドの場合に、使用できるカスタムフィールドの作成日時
+	CustomFieldCreatedAtList []string `json:"customFieldCreatedAtList,omitempty"`
+}
+
+// APICustomField はAPIスキーマのカスタムフィールド
+// カスタムフィールド・繰り返しフィールドからは、作成日時で参照される
+type APICustomField struct {
+	FieldId   string     `json:"fieldId"`
+	CreatedAt string     `json:"createdAt"`
+	Fields    []APIField `json:"fields"`
+}
+
+// apiSchema はエンドポイントのAPIスキーマ
+type apiSchema struct {
+	APIFields    []APIField       `json:"apiFields"`
+	CustomFields []APICustomField `json:"customFields"`
+}
+
+// relationPaths はコンテンツ参照・複数コンテンツ参照のフィールドのパスを返す
+// パスはフィールドIDを"."でつないだもので、配列の添字は含まない(例: "repeater.target")
+// カスタムフィールド・繰り返しフィールドの中のフィールドも含める
+func (s apiSchema) relationPaths() map[string]bool {
+	customFields := make(map[string]APICustomField, len(s.CustomFields))
+	for _, customField := range s.CustomFields {
+		customFields[customField.CreatedAt] = customField
+	}
+
+	paths := make(map[string]bool)
+	var walk func(fields []APIField, prefix string, visiting map[string]bool)
+	walk = func(fields []APIField, prefix string, visiting map[string]bool) {
+		for _, field := range fields {
+			path := prefix + field.FieldId
+			switch field.Kind {
+			case "relation", "relationList":
+				paths[path] = true
+			case "custom", "repeater":
+				createdAts := append([]string{field.CustomFieldCreatedAt}, field.CustomFieldCreatedAtList...)
+				for _, createdAt := range createdAts {
+					customField, ok := customFields[createdAt]
+					// カスタムフィールドが自身を含む場合に、無限に辿らないようにする
+					if !ok || visiting[createdAt] {
+						continue
+					}
+					visiting[createdAt] = true
+					walk(customField.Fields, path+".", visiting)
+					delete(visiting, createdAt)
+				}
+			}
+		}
+	}
+	walk(s.APIFields, "", make(map[string]bool))
+	return paths
+}
+
+// getAPIFields はマネジメントAPIからエンドポイントのAPIスキーマを取得し、フィールドの一覧を返す
+// APIスキーマの取得にはgetContentsMetaDataAPIKeyを使用する
+func (c Client) getAPIFields(ctx context.Context, endpoint string) ([]APIField, error) {
+	schema, err := c.getAPISchema(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return schema.APIFields, nil
+}
+
+// getAPISchema はマネジメントAPIからエンドポイントのAPIスキーマを取得する
+// APIスキーマの取得にはgetContentsMetaDataAPIKeyを使用する
+func (c Client) getAPISchema(ctx context.Context, endpoint string) (apiSchema, error) {
+	url := fmt.Sprintf("%s/v1/apis/%s", c.managementAPIURL(), endpoint)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req.Header.Set("X-MICROCMS-API-KEY", c.Config.Contents.GetContentsMetaDataAPIKey)
+
+	client := new(http.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return apiSchema{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiSchema{}, fmt.Errorf("ステータスコード:%d 正常にレスポンスを取得できませんでした", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return apiSchema{}, err
+	}
+
+	var schema apiSchema
+	if err := json.Unmarshal(body, &schema); err != nil {
+		return apiSchema{}, err
+	}
+	return schema, nil
+}
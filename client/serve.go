@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 一覧取得で返す件数の既定値と上限(コンテンツAPIと同じ)
+const (
+	serveDefaultLimit = 10
+	serveMaxLimit     = 100
+)
+
+// backupServer はバックアップしたコンテンツを、コンテンツAPIと同じ形式で返す読み取り専用のサーバー
+// 公開中のコンテンツ(PUBLISH)のみを返す
+type backupServer struct {
+	// エンドポイントごとのコンテンツ(バックアップした順)
+	contents map[string][]gjson.Result
+	mediaDir string
+}
+
+// Serve はバックアップディレクトリを読み込み、addrでコンテンツAPIと互換のAPIを提供する
+// ctxがキャンセルされると、処理中のリクエストを待ってから終了する
+func (c Client) Serve(ctx context.Context, baseDir, addr string) error {
+	server, err := newBackupServer(baseDir)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{Addr: addr, Handler: server}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("http://%s/api/v1/ でバックアップを提供します\n", addr)
+	err = srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func newBackupServer(baseDir string) (*backupServer, error) {
+	server := &backupServer{
+		contents: make(map[string][]gjson.Result),
+		mediaDir: baseDir + "media",
+	}
+	err := readBackupContents(baseDir, func(content backupContent) error {
+		// CSV形式のバックアップは数値や真偽値が文字列となり、展開したカラムも元の形に戻せないため、
+		// コンテンツAPIと同じ形式で返すことができない
+		if content.FromCSV {
+			return fmt.Errorf("CSV形式のバックアップには対応していません（JSON・NDJSON形式のバックアップを使用してください）: %s", content.Endpoint)
+		}
+		if content.Status != "PUBLISH" {
+			return nil
+		}
+		server.contents[content.Endpoint] = append(server.contents[content.Endpoint], gjson.Parse(content.Raw))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("コンテンツの読み込みでエラーが発生しました: %w", err)
+	}
+	for endpoint, contents := range server.contents {
+		log.Printf("%s: %d件\n", endpoint, len(contents))
+	}
+	return server, nil
+}
+
+func (s *backupServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeServeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/media/") {
+		http.StripPrefix("/media/", http.FileServer(http.Dir(s.mediaDir))).ServeHTTP(w, r)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/api/v1/")
+	if !ok {
+		writeServeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	endpoint, id, _ := strings.Cut(strings.Trim(path, "/"), "/")
+	contents, ok := s.contents[endpoint]
+	if !ok {
+		writeServeError(w, http.StatusNotFound, "API not found.")
+		return
+	}
+
+	query := r.URL.Query()
+	fields := splitQueryList(query.Get("fields"))
+
+	if id != "" {
+		i := slices.IndexFunc(contents, func(item gjson.Result) bool { return item.Get("id").String() == id })
+		if i < 0 {
+			writeServeError(w, http.StatusNotFound, "Content is not found.")
+			return
+		}
+		writeServeJSON(w, selectFields(contents[i], fields))
+		return
+	}
+
+	limit, offset := serveDefaultLimit, 0
+	var err error
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 || limit > serveMaxLimit {
+			writeServeError(w, http.StatusBadRequest, "Invalid limit.")
+			return
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			writeServeError(w, http.StatusBadRequest, "Invalid offset.")
+			return
+		}
+	}
+	filter, err := parseServeFilters(query.Get("filters"))
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ids := splitQueryList(query.Get("ids"))
+
+	var matched []json.RawMessage
+	for _, item := range contents {
+		if len(ids) > 0 && !slices.Contains(ids, item.Get("id").String()) {
+			continue
+		}
+		if !filter(item) {
+			continue
+		}
+		matched = append(matched, selectFields(item, fields))
+	}
+
+	page := []json.RawMessage{}
+	if offset < len(matched) {
+		page = matched[offset:min(offset+limit, len(matched))]
+	}
+	b, err := json.Marshal(page)
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := ContentsAPIResponse{Contents: b, TotalCount: len(matched), Offset: offset, Limit: limit}
+	b, err = json.Marshal(response)
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeServeJSON(w, b)
+}
+
+// selectFields はfieldsで指定したフィールドのみを、保存されていた順に含むJSONを返す
+// fieldsが空の場合はすべてのフィールドを返す
+func selectFields(item gjson.Result, fields []string) json.RawMessage {
+	if len(fields) == 0 {
+		return json.RawMessage(item.Raw)
+	}
+	var sb strings.Builder
+	sb.WriteString("{")
+	first := true
+	item.ForEach(func(key, value gjson.Result) bool {
+		if !slices.Contains(fields, key.String()) {
+			return true
+		}
+		if !first {
+			sb.WriteString(",")
+		}
+		first = false
+		sb.WriteString(key.Raw)
+		sb.WriteString(":")
+		sb.WriteString(value.Raw)
+		return true
+	})
+	sb.WriteString("}")
+	return json.RawMessage(sb.String())
+}
+
+// 絞り込みの条件の形式: フィールドID[演算子]値
+var serveFilterPattern = regexp.MustCompile(`^([^\[\]]+)\[(equals|not_equals|contains|not_contains|less_than|greater_than|exists|not_exists|begins_with)\](.*)$`)
+
+// parseServeFilters はfiltersクエリを解釈し、コンテンツが条件に一致するかを返す関数を作成する
+// [and]と[or]で条件を組み合わせられる([and]が優先され、括弧には対応しない)
+func parseServeFilters(filters string) (func(item gjson.Result) bool, error) {
+	if filters == "" {
+		return func(gjson.Result) bool { return true }, nil
+	}
+
+	var groups [][]func(gjson.Result) bool
+	for _, group := range strings.Split(filters, "[or]") {
+		var conditions []func(gjson.Result) bool
+		for _, condition := range strings.Split(group, "[and]") {
+			m := serveFilterPattern.FindStringSubmatch(condition)
+			if m == nil {
+				return nil, fmt.Errorf("Invalid filters: %s", condition)
+			}
+			field, op, value := m[1], m[2], m[3]
+			conditions = append(conditions, func(item gjson.Result) bool {
+				return matchServeFilter(item.Get(field), op, value)
+			})
+		}
+		groups = append(groups, conditions)
+	}
+
+	return func(item gjson.Result) bool {
+		for _, conditions := range groups {
+			if !slices.ContainsFunc(conditions, func(match func(gjson.Result) bool) bool { return !match(item) }) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// filterComparable はフィルタで比較する値を返す
+// microCMSのフィルタと同じく、オブジェクト(コンテンツ参照)はIDで比較する
+func filterComparable(value gjson.Result) gjson.Result {
+	if id := value.Get("id"); value.IsObject() && id.Type == gjson.String {
+		return id
+	}
+	return value
+}
+
+// matchServeFilter はフィールドの値が条件に一致するかどうかを返す
+func matchServeFilter(field gjson.Result, op, value string) bool {
+	field = filterComparable(field)
+	exists := field.Exists() && field.Type != gjson.Null && field.String() != ""
+
+	switch op {
+	case "exists":
+		return exists
+	case "not_exists":
+		return !exists
+	case "equals":
+		return filterValueEqual(field, value)
+	case "not_equals":
+		return !filterValueEqual(field, value)
+	case "contains", "not_contains":
+		contains := strings.Contains(field.String(), value)
+		if field.IsArray() {
+			contains = slices.ContainsFunc(field.Array(), func(element gjson.Result) bool {
+				return filterComparable(element).String() == value
+			})
+		}
+		return contains == (op == "contains")
+	case "begins_with":
+		return strings.HasPrefix(field.String(), value)
+	case "less_than", "greater_than":
+		if !exists {
+			return false
+		}
+		cmp := compareFilterValue(field, value)
+		if op == "less_than" {
+			return cmp < 0
+		}
+		return cmp > 0
+	}
+	return false
+}
+
+func filterValueEqual(field gjson.Result, value string) bool {
+	if field.Type == gjson.Number {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return field.Num == f
+		}
+	}
+	return field.String() == value
+}
+
+// compareFilterValue は数値の場合は数値として、それ以外(日時など)は文字列として比較する
+func compareFilterValue(field gjson.Result, value string) int {
+	if field.Type == gjson.Number {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			switch {
+			case field.Num < f:
+				return -1
+			case field.Num > f:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(field.String(), value)
+}
+
+func splitQueryList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func writeServeJSON(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(b)
+}
+
+func writeServeError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.Marshal(map[string]string{"message": message})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func newTestBackupServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	baseDir := t.TempDir() + "/"
+	for _, dir := range []string{"contents/blogs/PUBLISH", "contents/blogs/DRAFT", "media/abc"} {
+		if err := os.MkdirAll(baseDir+dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"contents/blogs/PUBLISH/1.json": `{"id":"a","title":"ニュース1","count":3,"category":{"id":"news","createdAt":"2024-01-01T00:00:00.000Z"},"tags":["x","y"],"publishedAt":"2024-03-01T00:00:00.000Z"}`,
+		"contents/blogs/PUBLISH/2.json": `{"id":"b","title":"お知らせ","count":10,"category":{"id":"info","createdAt":"2024-01-01T00:00:00.000Z"},"tags":["y"],"publishedAt":"2024-02-01T00:00:00.000Z"}`,
+		"contents/blogs/PUBLISH/3.json": `{"id":"c","title":"ニュース2","count":5,"category":{"id":"news","createdAt":"2024-01-01T00:00:00.000Z"},"publishedAt":"2024-01-01T00:00:00.000Z"}`,
+		"contents/blogs/DRAFT/1.json":   `{"id":"d","title":"下書き"}`,
+		"media/abc/a.png":               "png",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, err := newBackupServer(baseDir)
+	if err != nil {
+		t.Fatalf("newBackupServer() error = %v", err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestBackupServerList(t *testing.T) {
+	ts := newTestBackupServer(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantIds    []string
+		wantTotal  int
+		wantOffset int
+		wantLimit  int
+	}{
+		{name: "省略時", query: "", wantIds: []string{"a", "b", "c"}, wantTotal: 3, wantLimit: 10},
+		{name: "limitとoffset", query: "?limit=1&offset=1", wantIds: []string{"b"}, wantTotal: 3, wantOffset: 1, wantLimit: 1},
+		{name: "ids", query: "?ids=c,a", wantIds: []string{"a", "c"}, wantTotal: 2, wantLimit: 10},
+		{name: "コンテンツ参照のequals", query: "?filters=category[equals]news", wantIds: []string{"a", "c"}, wantTotal: 2, wantLimit: 10},
+		{name: "and", query: "?filters=category[equals]news[and]count[greater_than]4", wantIds: []string{"c"}, wantTotal: 1, wantLimit: 10},
+		{name: "or", query: "?filters=count[less_than]4[or]title[begins_with]お", wantIds: []string{"a", "b"}, wantTotal: 2, wantLimit: 10},
+		{name: "配列のcontains", query: "?filters=tags[contains]y", wantIds: []string{"a", "b"}, wantTotal: 2, wantLimit: 10},
+		{name: "not_exists", query: "?filters=tags[not_exists]", wantIds: []string{"c"}, wantTotal: 1, wantLimit: 10},
+		{name: "日時の比較", query: "?filters=publishedAt[greater_than]2024-01-15T00:00:00.000Z", wantIds: []string{"a", "b"}, wantTotal: 2, wantLimit: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/api/v1/blogs" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+
+			var response struct {
+				Contents []struct {
+					Id string `json:"id"`
+				} `json:"contents"`
+				TotalCount int `json:"totalCount"`
+				Offset     int `json:"offset"`
+				Limit      int `json:"limit"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, content := range response.Contents {
+				ids = append(ids, content.Id)
+			}
+			if len(ids) != len(tt.wantIds) || (len(ids) > 0 && !equalStrings(ids, tt.wantIds)) {
+				t.Errorf("ids = %v, want %v", ids, tt.wantIds)
+			}
+			if response.TotalCount != tt.wantTotal || response.Offset != tt.wantOffset || response.Limit != tt.wantLimit {
+				t.Errorf("totalCount, offset, limit = %d, %d, %d, want %d, %d, %d", response.TotalCount, response.Offset, response.Limit, tt.wantTotal, tt.wantOffset, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestBackupServerGet(t *testing.T) {
+	ts := newTestBackupServer(t)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/api/v1/blogs/a?fields=title,id", wantStatus: http.StatusOK, wantBody: `{"id":"a","title":"ニュース1"}`},
+		{path: "/api/v1/blogs/d", wantStatus: http.StatusNotFound, wantBody: `{"message":"Content is not found."}`},
+		{path: "/api/v1/unknown", wantStatus: http.StatusNotFound, wantBody: `{"message":"API not found."}`},
+		{path: "/api/v1/blogs?limit=101", wantStatus: http.StatusBadRequest, wantBody: `{"message":"Invalid limit."}`},
+		{path: "/media/abc/a.png", wantStatus: http.StatusOK, wantBody: "png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(b) != tt.wantBody {
+				t.Errorf("GET %s = %d %s, want %d %s", tt.path, resp.StatusCode, b, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	resp, err := http.Post(ts.URL+"/api/v1/blogs", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 10件以上のJSON形式のバックアップも、ファイル名の順ではなく保存した順に返す
+func TestBackupServerOrder(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"contents/blogs/PUBLISH", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	var wantIds []string
+	for i := 1; i <= 12; i++ {
+		id := fmt.Sprintf("c%d", i)
+		wantIds = append(wantIds, id)
+		path := fmt.Sprintf("%scontents/blogs/PUBLISH/%d.json", baseDir, i)
+		if err := os.WriteFile(path, []byte(`{"id":"`+id+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server, err := newBackupServer(baseDir)
+	if err != nil {
+		t.Fatalf("newBackupServer() error = %v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/blogs?limit=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Contents []struct {
+			Id string `json:"id"`
+		} `json:"contents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, content := range response.Contents {
+		ids = append(ids, content.Id)
+	}
+	if !equalStrings(ids, wantIds) {
+		t.Errorf("ids = %v, want %v", ids, wantIds)
+	}
+}
+
+func TestNewBackupServerCSV(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"contents/blogs/PUBLISH", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(baseDir+"contents/blogs/PUBLISH/contents.csv", []byte("id,count\na,3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newBackupServer(baseDir); err == nil {
+		t.Error("newBackupServer() error = nil")
+	}
+}
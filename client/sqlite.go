@@ -0,0 +1,316 @@
+package client
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteのデータベースのファイル名
+const sqliteFileName = "backup.sqlite"
+
+// メディアのテーブル名
+const sqliteMediaTable = "media"
+
+// コンテンツのステータスを保存するカラム名
+// フィールドIDと重複しないよう、接頭辞を付ける
+const sqliteStatusColumn = "_status"
+
+// sqliteBoolean は真偽値のみのカラムの型
+// SQLiteには真偽値の型がないため、INTEGERのカラムに1・0として保存する
+const sqliteBoolean = "BOOLEAN"
+
+// mergeSQLiteType はカラムのこれまでの型と値のJSONの型から、カラムの型を返す
+// 数値のみのカラムはINTEGER(小数を含む場合はREAL)とし、型が混在する場合はTEXTとする
+// nullの値は型の判定に使わない
+func mergeSQLiteType(current string, value gjson.Result) string {
+	var t string
+	switch value.Type {
+	case gjson.Null:
+		return current
+	case gjson.Number:
+		t = "INTEGER"
+		if strings.ContainsAny(value.Raw, ".eE") {
+			t = "REAL"
+		}
+	case gjson.True, gjson.False:
+		t = sqliteBoolean
+	default:
+		t = "TEXT"
+	}
+	switch {
+	case current == "" || current == t:
+		return t
+	case (current == "INTEGER" && t == "REAL") || (current == "REAL" && t == "INTEGER"):
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteValue はカラムの型に合わせて、書き込む値を返す
+// cellはCSVのセルと同じ形式の値で、TEXTのカラムに使う
+func sqliteValue(columnType string, value gjson.Result, cell string) any {
+	switch {
+	case columnType == "TEXT":
+		return cell
+	case value.Type == gjson.Null:
+		return nil
+	case columnType == "INTEGER":
+		return value.Int()
+	case columnType == "REAL":
+		return value.Float()
+	default:
+		if value.Bool() {
+			return 1
+		}
+		return 0
+	}
+}
+
+// sqliteNames はSQLiteのテーブル名やカラム名を、大文字・小文字を区別せずに重複しないよう割り当てる
+type sqliteNames map[string]bool
+
+// assign はnameが使用済みの場合、"_2"のような連番を付けた名前を返す
+func (n sqliteNames) assign(name string) string {
+	assigned := name
+	for i := 2; n[strings.ToLower(assigned)]; i++ {
+		assigned = fmt.Sprintf("%s_%d", name, i)
+	}
+	n[strings.ToLower(assigned)] = true
+	return assigned
+}
+
+// ExportSQLite はバックアップディレクトリの内容を1つのSQLiteのデータベースに変換する
+// outputPathを省略した場合は、バックアップディレクトリのbackup.sqliteに保存する
+func (c Client) ExportSQLite(baseDir, outputPath string) error {
+	if outputPath == "" {
+		outputPath = baseDir + sqliteFileName
+	}
+	return exportSQLite(baseDir, outputPath)
+}
+
+// exportSQLite はエンドポイントごとのテーブルと、メディアのテーブルを持つデータベースを作成する
+// エンドポイントのテーブルのカラムは、すべてのコンテンツのキーを出現順に並べたものに、ステータスのカラムを加えたもの
+// SQLiteの識別子は大文字・小文字を区別しないため、重複するテーブル名やカラム名には連番を付ける
+// カラムの型は値のJSONの型から決め(数値はINTEGER・REAL、真偽値は1・0のINTEGER)、それ以外はTEXTとする
+// オブジェクトや配列の値はJSON文字列として保存するため、json_extractなどで参照できる
+func exportSQLite(baseDir, outputPath string) error {
+	log.Println("SQLiteへの書き出しを開始します")
+
+	// 書きかけのデータベースを残さないよう、一時ファイルに書き込んだ後にリネームする
+	tmp, err := os.CreateTemp(filepath.Dir(outputPath), tempFilePrefix+filepath.Base(outputPath)+"-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	db, err := sql.Open("sqlite", tmp.Name())
+	if err != nil {
+		return err
+	}
+	err = writeSQLite(db, baseDir)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), outputPath)
+}
+
+func writeSQLite(db *sql.DB, baseDir string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = writeSQLiteContents(tx, baseDir)
+	if err != nil {
+		return fmt.Errorf("コンテンツの書き出しでエラーが発生しました: %w", err)
+	}
+	err = writeSQLiteMedia(tx, baseDir)
+	if err != nil {
+		return fmt.Errorf("メディアの書き出しでエラーが発生しました: %w", err)
+	}
+	return tx.Commit()
+}
+
+func writeSQLiteContents(tx *sql.Tx, baseDir string) error {
+	// 1回目の読み込みで、エンドポイントごとのカラムとその型を収集する
+	// CSV形式のバックアップは値が文字列となるため、TEXTとなる
+	var endpoints []string
+	columns := make(map[string][]string)
+	types := make(map[string]map[string]string)
+	err := readBackupContents(baseDir, func(content backupContent) error {
+		if _, ok := types[content.Endpoint]; !ok {
+			endpoints = append(endpoints, content.Endpoint)
+			types[content.Endpoint] = make(map[string]string)
+		}
+		values := backupContentValues(content)
+		for _, field := range content.Fields {
+			current, ok := types[content.Endpoint][field.Key]
+			if !ok {
+				columns[content.Endpoint] = append(columns[content.Endpoint], field.Key)
+			}
+			types[content.Endpoint][field.Key] = mergeSQLiteType(current, values[field.Key])
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		// メディアのみのバックアップの場合
+		log.Println("コンテンツのバックアップが存在しないため、コンテンツの書き出しをスキップします")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	inserts := make(map[string]*sql.Stmt, len(endpoints))
+	tables := sqliteNames{sqliteMediaTable: true}
+	for _, endpoint := range endpoints {
+		table := tables.assign(endpoint)
+		if table != endpoint {
+			log.Printf("%sはテーブル名が重複するため、%sとして書き出します\n", endpoint, table)
+		}
+		names := sqliteNames{}
+		cols := []string{names.assign(sqliteStatusColumn)}
+		defs := []string{sqliteQuote(cols[0]) + " TEXT"}
+		for _, key := range columns[endpoint] {
+			col := names.assign(key)
+			if col != key {
+				log.Printf("%sの%sはカラム名が重複するため、%sとして書き出します\n", endpoint, key, col)
+			}
+			cols = append(cols, col)
+			columnType := types[endpoint][key]
+			switch columnType {
+			case sqliteBoolean:
+				columnType = "INTEGER"
+			case "":
+				// 値がすべてnullのカラム
+				columnType = "TEXT"
+				types[endpoint][key] = columnType
+			}
+			defs = append(defs, sqliteQuote(col)+" "+columnType)
+		}
+		placeholders := make([]string, len(cols))
+		for i := range cols {
+			placeholders[i] = "?"
+		}
+		_, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", sqliteQuote(table), strings.Join(defs, ", ")))
+		if err != nil {
+			return err
+		}
+
+		quoted := make([]string, len(cols))
+		for i, col := range cols {
+			quoted[i] = sqliteQuote(col)
+		}
+		stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sqliteQuote(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", ")))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		inserts[endpoint] = stmt
+	}
+
+	// 2回目の読み込みで、コンテンツを書き込む
+	return readBackupContents(baseDir, func(content backupContent) error {
+		cells := make(map[string]string, len(content.Fields))
+		for _, field := range content.Fields {
+			cells[field.Key] = field.Value
+		}
+		values := backupContentValues(content)
+		args := []any{content.Status}
+		for _, col := range columns[content.Endpoint] {
+			cell, ok := cells[col]
+			if !ok {
+				// キーが存在しないコンテンツはNULLとする
+				args = append(args, nil)
+				continue
+			}
+			args = append(args, sqliteValue(types[content.Endpoint][col], values[col], cell))
+		}
+		_, err := inserts[content.Endpoint].Exec(args...)
+		return err
+	})
+}
+
+func writeSQLiteMedia(tx *sql.Tx, baseDir string) error {
+	b, err := os.ReadFile(baseDir + "media/index.json")
+	if errors.Is(err, os.ErrNotExist) {
+		log.Println("メディア一覧が存在しないため、メディアの書き出しをスキップします")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var entries []MediaIndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE media (
+	id TEXT,
+	url TEXT,
+	localPath TEXT,
+	width INTEGER,
+	height INTEGER,
+	size INTEGER,
+	contentType TEXT,
+	attributes TEXT
+)`)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO media (id, url, localPath, width, height, size, contentType, attributes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		// APIが返したその他の属性は、JSON文字列として保存する
+		var attributes any
+		if len(entry.Attributes) > 0 {
+			b, err := json.Marshal(entry.Attributes)
+			if err != nil {
+				return err
+			}
+			attributes = string(b)
+		}
+		_, err := stmt.Exec(entry.Id, entry.Url, entry.LocalPath, entry.Width, entry.Height, entry.Size, entry.ContentType, attributes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupContentValues はコンテンツのJSON文字列から、フィールドIDごとの値を返す
+func backupContentValues(content backupContent) map[string]gjson.Result {
+	values := make(map[string]gjson.Result, len(content.Fields))
+	gjson.Parse(content.Raw).ForEach(func(key, value gjson.Result) bool {
+		values[key.String()] = value
+		return true
+	})
+	return values
+}
+
+// sqliteQuote はテーブル名やカラム名を識別子としてクォートする
+func sqliteQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
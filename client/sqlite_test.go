@@ -0,0 +1,138 @@
+package client
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExportSQLite(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	for _, dir := range []string{"contents/blogs/PUBLISH", "contents/blogs/DRAFT", "contents/categories/PUBLISH", "contents/Media/PUBLISH", "media"} {
+		if err := os.MkdirAll(baseDir+dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"contents/blogs/PUBLISH/1.json":      `{"id":"a","title":"公開","tags":["x","y"],"views":10,"rating":4.5,"featured":true,"code":"1"}`,
+		"contents/blogs/PUBLISH/1.meta.json": `{"id":"a","status":["PUBLISH"]}`,
+		"contents/blogs/DRAFT/1.json":        `{"id":"b","title":"下書き","category":{"id":"cat1"},"_status":"独自","Title":"大文字","views":null,"rating":4,"featured":false,"code":2}`,
+		// メディアのテーブル名と大文字・小文字のみ異なるエンドポイント
+		"contents/Media/PUBLISH/1.json": `{"id":"x"}`,
+		"contents/categories/PUBLISH/contents.csv": "id,name,_meta.status\n" +
+			"cat1,カテゴリ,\"[\"\"PUBLISH\"\"]\"\n",
+		"media/index.json": `[{"id":"m1","url":"https://images.microcms-assets.io/assets/xxx/abc/a.png","localPath":"media/abc/a.png","width":100,"height":50,"size":1234,"contentType":"image/png","attributes":{"alt":"代替テキスト"}}]`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(baseDir+path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := Client{Config: &Config{}}
+	if err := c.ExportSQLite(baseDir, ""); err != nil {
+		t.Fatalf("ExportSQLite() error = %v", err)
+	}
+
+	db, err := sql.Open("sqlite", baseDir+sqliteFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	query := func(q string) [][]any {
+		t.Helper()
+		rows, err := db.Query(q)
+		if err != nil {
+			t.Fatalf("Query(%s) error = %v", q, err)
+		}
+		defer rows.Close()
+		cols, _ := rows.Columns()
+		var result [][]any
+		for rows.Next() {
+			row := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range row {
+				ptrs[i] = &row[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, row)
+		}
+		return result
+	}
+
+	tests := []struct {
+		query string
+		want  [][]any
+	}{
+		{
+			// キーの和集合がカラムとなり、存在しないキーはNULLとなる
+			query: `SELECT "_status", id, title, tags, category FROM blogs ORDER BY id`,
+			want: [][]any{
+				{"PUBLISH", "a", "公開", `["x","y"]`, nil},
+				{"DRAFT", "b", "下書き", nil, `{"id":"cat1"}`},
+			},
+		},
+		{
+			// 数値・真偽値は数値として保存し、型が混在するカラムは文字列とする
+			query: `SELECT views, typeof(views), rating, typeof(rating), featured, code, typeof(code) FROM blogs ORDER BY id`,
+			want: [][]any{
+				{int64(10), "integer", 4.5, "real", int64(1), "1", "text"},
+				{nil, "null", 4.0, "real", int64(0), "2", "text"},
+			},
+		},
+		{
+			query: `SELECT name, type FROM pragma_table_info('blogs') WHERE name IN ('title', 'views', 'rating', 'featured', 'code')`,
+			want:  [][]any{{"title", "TEXT"}, {"views", "INTEGER"}, {"rating", "REAL"}, {"featured", "INTEGER"}, {"code", "TEXT"}},
+		},
+		{
+			// オブジェクトや配列はJSONとして参照できる
+			query: `SELECT json_extract(tags, '$[1]') FROM blogs WHERE id = 'a'`,
+			want:  [][]any{{"y"}},
+		},
+		{
+			// ステータスのカラムや、大文字・小文字のみ異なるカラムと重複するフィールドは連番を付ける
+			query: `SELECT "_status", "_status_2", "Title_2" FROM blogs WHERE id = 'b'`,
+			want:  [][]any{{"DRAFT", "独自", "大文字"}},
+		},
+		{
+			query: `SELECT id FROM "Media_2"`,
+			want:  [][]any{{"x"}},
+		},
+		{
+			// CSVのメタデータのカラムは含まれない
+			query: `SELECT * FROM categories`,
+			want:  [][]any{{"PUBLISH", "cat1", "カテゴリ"}},
+		},
+		{
+			query: `SELECT id, localPath, width, size, json_extract(attributes, '$.alt') FROM media`,
+			want:  [][]any{{"m1", "media/abc/a.png", int64(100), int64(1234), "代替テキスト"}},
+		},
+	}
+	for _, tt := range tests {
+		if got := query(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestExportSQLiteMediaOnly(t *testing.T) {
+	baseDir := t.TempDir() + "/"
+	if err := os.MkdirAll(baseDir+"media", os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(baseDir+"media/index.json", []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := t.TempDir() + "/out.sqlite"
+	if err := exportSQLite(baseDir, output); err != nil {
+		t.Fatalf("exportSQLite() error = %v", err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("database not created: %v", err)
+	}
+}
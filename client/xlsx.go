@@ -0,0 +1,382 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSX形式で保存する場合のファイル名
+const xlsxFileName = "contents.xlsx"
+
+// 件数をまとめたシートの名前
+// エンドポイント名と重複しないよう、接頭辞を付ける
+const xlsxSummarySheet = "_summary"
+
+// シート名の最大文字数
+const xlsxMaxSheetNameLength = 31
+
+// 日時のセルの表示形式
+const xlsxDateFormat = "yyyy-mm-dd hh:mm:ss"
+
+// 件数をまとめたシートで、日時のタイムゾーンを書き込む行の見出し
+const xlsxTimeZoneLabel = "タイムゾーン"
+
+// location は日時を書き込む際のタイムゾーンを返す
+func (cfg XLSXConfig) location() (*time.Location, error) {
+	if cfg.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("不明なタイムゾーンが指定されました: %s", cfg.TimeZone)
+	}
+	return loc, nil
+}
+
+// xlsxSheet は件数をまとめたシートの1行分
+type xlsxSheet struct {
+	Sheet    string
+	Endpoint string
+	Status   string
+	Count    int
+}
+
+// contentsWorkbook は1回のバックアップのすべてのコンテンツを保存するワークブック
+// エンドポイントごと(ステータス別分類ありの場合はエンドポイントとステータスごと)にシートを作成する
+type contentsWorkbook struct {
+	path   string
+	file   *excelize.File
+	sheets []xlsxSheet
+	// 日時のセルのスタイル
+	dateStyle int
+	// 日時を書き込む際のタイムゾーン
+	location *time.Location
+}
+
+// openContentsWorkbook はワークブックを開く
+// 中断されたバックアップの場合は、保存済みのワークブックに追加する
+// 保存済みのワークブックと日時のタイムゾーンが異なる場合は、シートごとに異なるタイムゾーンとならないようエラーとする
+func openContentsWorkbook(path string, location *time.Location) (*contentsWorkbook, error) {
+	wb := &contentsWorkbook{path: path, location: location}
+
+	f, err := excelize.OpenFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		f = excelize.NewFile()
+		if err := f.SetSheetName(f.GetSheetName(0), xlsxSummarySheet); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		wb.sheets, err = readXLSXSummary(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if saved := readXLSXTimeZone(f); saved != "" && saved != location.String() {
+			f.Close()
+			return nil, fmt.Errorf("保存済みのワークブックのタイムゾーン(%s)と、指定されたタイムゾーン(%s)が異なります", saved, location)
+		}
+	}
+	wb.file = f
+
+	format := xlsxDateFormat
+	wb.dateStyle, err = f.NewStyle(&excelize.Style{CustomNumFmt: &format})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return wb, nil
+}
+
+// readXLSXSummary は件数をまとめたシートから、保存済みのシートを読み込む
+func readXLSXSummary(f *excelize.File) ([]xlsxSheet, error) {
+	rows, err := f.GetRows(xlsxSummarySheet)
+	if err != nil {
+		return nil, err
+	}
+	var sheets []xlsxSheet
+	for _, row := range rows[min(1, len(rows)):] {
+		if len(row) < 4 {
+			continue
+		}
+		count, _ := strconv.Atoi(row[3])
+		sheets = append(sheets, xlsxSheet{Sheet: row[0], Endpoint: row[1], Status: row[2], Count: count})
+	}
+	return sheets, nil
+}
+
+// readXLSXTimeZone は件数をまとめたシートから、日時のタイムゾーンを読み込む
+// 記録されていない場合は空文字列を返す
+func readXLSXTimeZone(f *excelize.File) string {
+	rows, err := f.GetRows(xlsxSummarySheet)
+	if err != nil {
+		return ""
+	}
+	for _, row := range rows {
+		if len(row) == 2 && row[0] == xlsxTimeZoneLabel {
+			return row[1]
+		}
+	}
+	return ""
+}
+
+// readXLSXContentIDs はワークブックに保存されたシートごとに、コンテンツのIDを読み込む
+// IDのカラムがないシートの場合は、IDを空としてfnに渡す
+func readXLSXContentIDs(path string, fn func(sheet xlsxSheet, ids []string)) error {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sheets, err := readXLSXSummary(f)
+	if err != nil {
+		return err
+	}
+	for _, sheet := range sheets {
+		rows, err := f.GetRows(sheet.Sheet)
+		if err != nil {
+			return err
+		}
+		var ids []string
+		if len(rows) > 0 {
+			if column := slices.Index(rows[0], "id"); column >= 0 {
+				for _, row := range rows[1:] {
+					if column < len(row) && row[column] != "" {
+						ids = append(ids, row[column])
+					}
+				}
+			}
+		}
+		fn(sheet, ids)
+	}
+	return nil
+}
+
+// close はワークブックを閉じる
+// 保存されていない変更は破棄される
+func (wb *contentsWorkbook) close() error {
+	if wb == nil {
+		return nil
+	}
+	return wb.file.Close()
+}
+
+// addSheet はコンテンツを1つのシートとして追加する
+// 同じエンドポイントとステータスのシートが存在する場合(中断されたバックアップの再開時)は、置き換える
+// statusが空の場合は、ステータス別分類なしのシートとする
+func (wb *contentsWorkbook) addSheet(endpoint, status string, layout csvLayout, orderedKeys []string, contents []gjson.Result, orderedMetaKeys []string, metaData []gjson.Result) error {
+	name, exists := wb.sheetName(endpoint, status)
+	if exists {
+		if err := wb.file.DeleteSheet(name); err != nil {
+			return err
+		}
+	}
+	if _, err := wb.file.NewSheet(name); err != nil {
+		return err
+	}
+
+	// カラムの決め方はCSVと共通
+	columns, rows, truncated := layout.table(orderedKeys, contents, orderedMetaKeys, metaData)
+	if truncated > 0 {
+		log.Printf("%d件のコンテンツで配列の要素数がmaxArrayWidthを超えたため、超えた要素は書き出しませんでした: %s\n", truncated, name)
+	}
+
+	// ヘッダー行を書き込み、スクロールしても表示されるよう固定する
+	header := make([]any, len(columns))
+	for i, column := range columns {
+		header[i] = layout.headerLabel(column)
+	}
+	if err := wb.file.SetSheetRow(name, "A1", &header); err != nil {
+		return err
+	}
+	err := wb.file.SetPanes(name, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return err
+	}
+
+	// 各コンテンツのデータを、値の型に合わせたセルとして書き込む
+	overflowed := 0
+	for i, cells := range rows {
+		values := make([]any, len(columns))
+		var dateColumns []int
+		for j, column := range columns {
+			value, isDate, isOverflowed := xlsxCellValue(cells[column], wb.location)
+			values[j] = value
+			if isDate {
+				dateColumns = append(dateColumns, j)
+			}
+			if isOverflowed {
+				overflowed++
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := wb.file.SetSheetRow(name, cell, &values); err != nil {
+			return err
+		}
+		for _, j := range dateColumns {
+			cell, err := excelize.CoordinatesToCellName(j+1, i+2)
+			if err != nil {
+				return err
+			}
+			if err := wb.file.SetCellStyle(name, cell, cell, wb.dateStyle); err != nil {
+				return err
+			}
+		}
+	}
+	if overflowed > 0 {
+		log.Printf("%d個のセルで文字数が%d文字を超えたため、超えた部分は書き出しませんでした: %s\n", overflowed, excelize.TotalCellChars, name)
+	}
+
+	// 件数をまとめたシートの行を更新する
+	sheet := xlsxSheet{Sheet: name, Endpoint: endpoint, Status: status, Count: len(contents)}
+	for i := range wb.sheets {
+		if wb.sheets[i].Sheet == name {
+			wb.sheets[i] = sheet
+			return nil
+		}
+	}
+	wb.sheets = append(wb.sheets, sheet)
+	return nil
+}
+
+// save は件数をまとめたシートを更新して、ワークブックを保存する
+func (wb *contentsWorkbook) save() error {
+	if err := wb.file.DeleteSheet(xlsxSummarySheet); err != nil {
+		return err
+	}
+	if _, err := wb.file.NewSheet(xlsxSummarySheet); err != nil {
+		return err
+	}
+	rows := [][]any{{"シート", "エンドポイント", "ステータス", "件数"}}
+	for _, sheet := range wb.sheets {
+		rows = append(rows, []any{sheet.Sheet, sheet.Endpoint, sheet.Status, sheet.Count})
+	}
+	// シートの一覧と区別するため、空行を挟んで日時のタイムゾーンを書き込む
+	rows = append(rows, []any{}, []any{xlsxTimeZoneLabel, wb.location.String()})
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		if err := wb.file.SetSheetRow(xlsxSummarySheet, cell, &row); err != nil {
+			return err
+		}
+	}
+	err := wb.file.SetPanes(xlsxSummarySheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	if err != nil {
+		return err
+	}
+
+	// 件数をまとめたシートを先頭にして、開いたときに表示する
+	if first := wb.file.GetSheetName(0); first != xlsxSummarySheet {
+		if err := wb.file.MoveSheet(xlsxSummarySheet, first); err != nil {
+			return err
+		}
+	}
+	wb.file.SetActiveSheet(0)
+
+	return writeFileAtomic(wb.path, func(w io.Writer) error {
+		return wb.file.Write(w)
+	})
+}
+
+// sheetName はエンドポイントとステータスのシート名と、そのシートが既に存在するかどうかを返す
+// 件数をまとめたシートに同じエンドポイントとステータスのシートがあれば、その名前とする
+// なければ、既存のシートと(大文字・小文字を区別せずに)重複しないよう連番を付ける
+func (wb *contentsWorkbook) sheetName(endpoint, status string) (string, bool) {
+	for _, sheet := range wb.sheets {
+		if sheet.Endpoint == endpoint && sheet.Status == status {
+			if index, _ := wb.file.GetSheetIndex(sheet.Sheet); index >= 0 {
+				return sheet.Sheet, true
+			}
+			return sheet.Sheet, false
+		}
+	}
+	existing := wb.file.GetSheetList()
+	for n := 1; ; n++ {
+		name := xlsxSheetName(endpoint, status, n)
+		if !slices.ContainsFunc(existing, func(sheet string) bool { return strings.EqualFold(sheet, name) }) {
+			return name, false
+		}
+	}
+}
+
+// xlsxSheetName はエンドポイントとステータスからシート名を作成する
+// nが2以上の場合は、重複を避けるために"_2"のような連番を付ける
+// シート名に使えない文字は"_"に置き換え、ステータスと連番が残るようエンドポイント名を最大文字数に切り詰める
+func xlsxSheetName(endpoint, status string, n int) string {
+	suffix := ""
+	if status != "" {
+		suffix += "_" + status
+	}
+	if n > 1 {
+		suffix += fmt.Sprintf("_%d", n)
+	}
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, endpoint)
+	if limit := xlsxMaxSheetNameLength - utf8.RuneCountInString(suffix); utf8.RuneCountInString(name) > limit {
+		name = string([]rune(name)[:limit])
+	}
+	return name + suffix
+}
+
+// xlsxCellValue はJSONの値をセルの値に変換する
+// 数値・真偽値はそのままの型で、日時の文字列はlocationのタイムゾーンの日時として書き込む
+// オブジェクトや配列はJSON文字列とする
+// 日時かどうかと、セルの最大文字数を超えて切り詰めたかどうかも返す
+func xlsxCellValue(value gjson.Result, location *time.Location) (any, bool, bool) {
+	switch value.Type {
+	case gjson.Null:
+		return nil, false, false
+	case gjson.Number:
+		if i := value.Int(); float64(i) == value.Num {
+			return i, false, false
+		}
+		return value.Num, false, false
+	case gjson.True, gjson.False:
+		return value.Bool(), false, false
+	case gjson.String:
+		if t, err := time.Parse(time.RFC3339Nano, value.Str); err == nil {
+			return t.In(location), true, false
+		}
+	}
+
+	s := csvCellValue(value)
+	if utf8.RuneCountInString(s) > excelize.TotalCellChars {
+		return string([]rune(s)[:excelize.TotalCellChars]), false, true
+	}
+	return s, false, false
+}
+
+// saveContentsWorkbook はワークブックを保存する
+// XLSX形式以外の場合は何もしない
+func (c Client) saveContentsWorkbook() error {
+	if c.workbook == nil {
+		return nil
+	}
+	if err := c.workbook.save(); err != nil {
+		return fmt.Errorf("ワークブックの保存でエラーが発生しました: %w", err)
+	}
+	return nil
+}
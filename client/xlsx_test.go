@@ -0,0 +1,186 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestContentsWorkbook(t *testing.T) {
+	path := t.TempDir() + "/" + xlsxFileName
+	jst := time.FixedZone("JST", 9*60*60)
+	wb, err := openContentsWorkbook(path, jst)
+	if err != nil {
+		t.Fatalf("openContentsWorkbook() error = %v", err)
+	}
+	defer wb.close()
+
+	contents := []gjson.Result{
+		gjson.Parse(`{"id":"a","count":3,"rate":1.5,"visible":true,"publishedAt":"2024-01-02T03:04:05.000Z","tags":["x"]}`),
+		gjson.Parse(`{"id":"b","count":10}`),
+	}
+	orderedKeys := []string{"id", "count", "rate", "visible", "publishedAt", "tags"}
+	if err := wb.addSheet("blogs", "PUBLISH", csvLayout{}, orderedKeys, contents, nil, nil); err != nil {
+		t.Fatalf("addSheet() error = %v", err)
+	}
+	if err := wb.addSheet("news", "", csvLayout{}, []string{"id"}, contents[:1], nil, nil); err != nil {
+		t.Fatalf("addSheet() error = %v", err)
+	}
+	if err := wb.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	// 保存済みのワークブックと異なるタイムゾーンでは開けない
+	if _, err := openContentsWorkbook(path, time.UTC); err == nil {
+		t.Error("openContentsWorkbook() with another time zone error = nil")
+	}
+
+	// 中断後の再開を想定して開き直し、同じシートを置き換える
+	wb2, err := openContentsWorkbook(path, jst)
+	if err != nil {
+		t.Fatalf("openContentsWorkbook() error = %v", err)
+	}
+	defer wb2.close()
+	if err := wb2.addSheet("news", "", csvLayout{}, []string{"id"}, contents, nil, nil); err != nil {
+		t.Fatalf("addSheet() error = %v", err)
+	}
+	if err := wb2.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if got, want := f.GetSheetList(), []string{xlsxSummarySheet, "blogs_PUBLISH", "news"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSheetList() = %v, want %v", got, want)
+	}
+	summary, err := f.GetRows(xlsxSummarySheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSummary := [][]string{
+		{"シート", "エンドポイント", "ステータス", "件数"},
+		{"blogs_PUBLISH", "blogs", "PUBLISH", "2"},
+		{"news", "news", "", "2"},
+		nil,
+		{"タイムゾーン", "JST"},
+	}
+	if !reflect.DeepEqual(summary, wantSummary) {
+		t.Errorf("summary = %v, want %v", summary, wantSummary)
+	}
+
+	// 値の型に合わせたセルとなる
+	cellTypes := map[string]excelize.CellType{
+		"A2": excelize.CellTypeSharedString,
+		"B2": excelize.CellTypeUnset,
+		"D2": excelize.CellTypeBool,
+	}
+	for cell, want := range cellTypes {
+		got, err := f.GetCellType("blogs_PUBLISH", cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("GetCellType(%s) = %v, want %v", cell, got, want)
+		}
+	}
+	rows, err := f.GetRows("blogs_PUBLISH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 日時は指定したタイムゾーンで書き込む
+	wantDate := "2024-01-02 12:04:05"
+	wantRows := [][]string{
+		{"id", "count", "rate", "visible", "publishedAt", "tags"},
+		{"a", "3", "1.5", "TRUE", wantDate, `["x"]`},
+		{"b", "10"},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("rows = %v, want %v", rows, wantRows)
+	}
+
+	panes, err := f.GetPanes("blogs_PUBLISH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !panes.Freeze || panes.YSplit != 1 {
+		t.Errorf("header row is not frozen: %+v", panes)
+	}
+}
+
+func TestXLSXConfigLocation(t *testing.T) {
+	tests := []struct {
+		timeZone string
+		want     string
+		wantErr  bool
+	}{
+		{timeZone: "", want: "UTC"},
+		{timeZone: "UTC", want: "UTC"},
+		{timeZone: "unknown/zone", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := XLSXConfig{TimeZone: tt.timeZone}.location()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("location(%q) error = %v, wantErr %v", tt.timeZone, err, tt.wantErr)
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("location(%q) = %v, want %v", tt.timeZone, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		status   string
+		n        int
+		want     string
+	}{
+		{endpoint: "blogs", status: "", n: 1, want: "blogs"},
+		{endpoint: "blogs", status: "DRAFT", n: 1, want: "blogs_DRAFT"},
+		{endpoint: "a/b", status: "", n: 1, want: "a_b"},
+		// ステータスが残るよう、エンドポイント名を切り詰める
+		{endpoint: "very-long-endpoint-name-for-test", status: "PUBLISH", n: 1, want: "very-long-endpoint-name_PUBLISH"},
+		{endpoint: "very-long-endpoint-name-for-test", status: "DRAFT", n: 1, want: "very-long-endpoint-name-f_DRAFT"},
+		{endpoint: "very-long-endpoint-name-for-test", status: "PUBLISH", n: 2, want: "very-long-endpoint-na_PUBLISH_2"},
+	}
+	for _, tt := range tests {
+		if got := xlsxSheetName(tt.endpoint, tt.status, tt.n); got != tt.want {
+			t.Errorf("xlsxSheetName(%q, %q, %d) = %q, want %q", tt.endpoint, tt.status, tt.n, got, tt.want)
+		}
+	}
+}
+
+// 切り詰めると同じ名前になるエンドポイントも、別のシートとして保存する
+func TestContentsWorkbookSheetNameCollision(t *testing.T) {
+	path := t.TempDir() + "/" + xlsxFileName
+	wb, err := openContentsWorkbook(path, time.UTC)
+	if err != nil {
+		t.Fatalf("openContentsWorkbook() error = %v", err)
+	}
+	defer wb.close()
+
+	contents := []gjson.Result{gjson.Parse(`{"id":"a"}`)}
+	for _, endpoint := range []string{"very-long-endpoint-name-for-test-1", "very-long-endpoint-name-for-test-2", "_SUMMARY"} {
+		if err := wb.addSheet(endpoint, "PUBLISH", csvLayout{}, []string{"id"}, contents, nil, nil); err != nil {
+			t.Fatalf("addSheet() error = %v", err)
+		}
+	}
+	if err := wb.addSheet("_summary", "", csvLayout{}, []string{"id"}, contents, nil, nil); err != nil {
+		t.Fatalf("addSheet() error = %v", err)
+	}
+	if err := wb.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	want := []string{xlsxSummarySheet, "very-long-endpoint-name_PUBLISH", "very-long-endpoint-na_PUBLISH_2", "_SUMMARY_PUBLISH", "_summary_2"}
+	if got := wb.file.GetSheetList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSheetList() = %v, want %v", got, want)
+	}
+}
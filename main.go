@@ -1,26 +1,184 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/Sinhalite/microcms-backup-tool/client"
 )
 
 func main() {
+	resumeDir := flag.String("resume", "", "中断されたバックアップのディレクトリを指定して再開します")
+	addr := flag.String("addr", "localhost:8080", "serve・daemon・listenで待ち受けるアドレス")
+	apply := flag.Bool("apply", false, "import-csv・migrateでサービスに書き込みます（指定しない場合は差分や計画の表示のみ）")
+	flag.Parse()
+
+	// Ctrl-CやSIGTERMを受け取った場合は、処理中のリクエストを中断して終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	client := &client.Client{Config: &client.Config{}}
 	err := client.LoadConfig("config.json")
 	if err != nil {
 		log.Fatal("正常にオプションをセットできませんでした")
 	}
 
-	baseDir, err := client.MakeBackupDir()
+	switch flag.Arg(0) {
+	case "":
+		err = backup(ctx, client, *resumeDir)
+	case "restore-media":
+		err = restoreMedia(ctx, client, flag.Arg(1))
+	case "export-sqlite":
+		err = exportSQLite(client, flag.Arg(1), flag.Arg(2))
+	case "import-csv":
+		err = importCSV(ctx, client, flag.Arg(1), flag.Arg(2), *apply)
+	case "serve":
+		err = serve(ctx, client, flag.Arg(1), *addr)
+	case "migrate":
+		err = migrate(ctx, client, flag.Arg(1), *apply)
+	case "daemon":
+		err = daemon(ctx, client, *addr)
+	case "listen":
+		err = listen(ctx, client, *addr)
+	default:
+		err = errors.New("不明なコマンドです: " + flag.Arg(0))
+	}
 	if err != nil {
-		log.Fatal("正常にバックアップディレクトリを作成できませんでした")
+		stop()
+		log.Fatal(err)
+	}
+}
+
+func backup(ctx context.Context, c *client.Client, resumeDir string) error {
+	var baseDir string
+	if resumeDir != "" {
+		baseDir = dirPath(resumeDir)
+		if !c.CanResume(baseDir) {
+			return errors.New("再開できるバックアップが見つかりませんでした")
+		}
+		log.Printf("%sのバックアップを再開します", baseDir)
+	} else {
+		var err error
+		baseDir, err = c.MakeBackupDir()
+		if err != nil {
+			return errors.New("正常にバックアップディレクトリを作成できませんでした")
+		}
 	}
 
-	err = client.StartBackup(baseDir)
+	err := c.StartBackup(ctx, baseDir)
 	if err != nil {
 		log.Printf("バックアップに失敗しました: %v", err)
-		log.Fatal("正常にバックアップを処理できませんでした")
+		return errors.New("正常にバックアップを処理できませんでした")
+	}
+	return nil
+}
+
+func restoreMedia(ctx context.Context, c *client.Client, backupDir string) error {
+	if backupDir == "" {
+		return errors.New("リストアするバックアップのディレクトリを指定してください")
+	}
+
+	err := c.RestoreMedia(ctx, dirPath(backupDir))
+	if err != nil {
+		log.Printf("メディアのリストアに失敗しました: %v", err)
+		return errors.New("正常にメディアのリストアを処理できませんでした")
+	}
+	return nil
+}
+
+func exportSQLite(c *client.Client, backupDir, outputPath string) error {
+	if backupDir == "" {
+		return errors.New("書き出すバックアップのディレクトリを指定してください")
+	}
+
+	err := c.ExportSQLite(dirPath(backupDir), outputPath)
+	if err != nil {
+		log.Printf("SQLiteへの書き出しに失敗しました: %v", err)
+		return errors.New("正常にSQLiteへの書き出しを処理できませんでした")
+	}
+	return nil
+}
+
+func importCSV(ctx context.Context, c *client.Client, endpoint, csvPath string, apply bool) error {
+	if endpoint == "" || csvPath == "" {
+		return errors.New("取り込むエンドポイントとCSVファイルを指定してください")
+	}
+
+	err := c.ImportCSV(ctx, endpoint, csvPath, apply)
+	if err != nil {
+		log.Printf("CSVの取り込みに失敗しました: %v", err)
+		return errors.New("正常にCSVの取り込みを処理できませんでした")
+	}
+	return nil
+}
+
+func serve(ctx context.Context, c *client.Client, backupDir, addr string) error {
+	if backupDir == "" {
+		return errors.New("提供するバックアップのディレクトリを指定してください")
+	}
+
+	err := c.Serve(ctx, dirPath(backupDir), addr)
+	if err != nil {
+		log.Printf("バックアップの提供に失敗しました: %v", err)
+		return errors.New("正常にバックアップを提供できませんでした")
+	}
+	return nil
+}
+
+func migrate(ctx context.Context, c *client.Client, backupDir string, apply bool) error {
+	// バックアップディレクトリを指定しない場合は、移行元のバックアップから行う
+	var baseDir string
+	if backupDir != "" {
+		baseDir = dirPath(backupDir)
+	} else {
+		var err error
+		baseDir, err = c.MakeBackupDir()
+		if err != nil {
+			return errors.New("正常にバックアップディレクトリを作成できませんでした")
+		}
+		err = c.StartBackup(ctx, baseDir)
+		if err != nil {
+			log.Printf("バックアップに失敗しました: %v", err)
+			return errors.New("正常にバックアップを処理できませんでした")
+		}
+	}
+
+	err := c.Migrate(ctx, c.MigrationTarget(), baseDir, apply)
+	if err != nil {
+		log.Printf("移行に失敗しました: %v", err)
+		return errors.New("正常に移行を処理できませんでした")
+	}
+	return nil
+}
+
+func daemon(ctx context.Context, c *client.Client, addr string) error {
+	err := c.RunDaemon(ctx, addr)
+	if err != nil {
+		log.Printf("daemonの実行に失敗しました: %v", err)
+		return errors.New("正常にdaemonを実行できませんでした")
+	}
+	return nil
+}
+
+func listen(ctx context.Context, c *client.Client, addr string) error {
+	err := c.Listen(ctx, addr)
+	if err != nil {
+		log.Printf("Webhookの受信に失敗しました: %v", err)
+		return errors.New("正常にWebhookを受信できませんでした")
+	}
+	return nil
+}
+
+// dirPath はディレクトリのパスを末尾に"/"が付いた形にそろえる
+func dirPath(dir string) string {
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
 	}
+	return dir
 }
@@ -0,0 +1,547 @@
+// Package mockcms はテスト用に、microCMSのコンテンツAPI・マネジメントAPI・メディアの配信を
+// フィクスチャのデータから返すローカルのサーバーを提供する
+package mockcms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+)
+
+// 一覧取得で返す件数の既定値
+const defaultLimit = 10
+
+// Keys はAPIキーの種類ごとに受け付けるAPIキー
+// 空のAPIキーは受け付けない
+type Keys struct {
+	// 公開中のコンテンツのみ取得できるAPIキー
+	Publish string
+	// 全ステータスのコンテンツを取得できるAPIキー
+	AllStatus string
+	// コンテンツのメタデータ・APIスキーマを取得できるAPIキー
+	MetaData string
+	// メディアの一覧を取得できるAPIキー
+	Media string
+	// コンテンツを更新できるAPIキー
+	Update string
+	// メディアをアップロードできるAPIキー
+	Upload string
+}
+
+// Content はフィクスチャのコンテンツ
+type Content struct {
+	// PUBLISH, DRAFT, PUBLISH_AND_DRAFT, CLOSEDのいずれか
+	Status string
+	// コンテンツAPIが返すJSON(idを含める)
+	Body string
+	// PUBLISH_AND_DRAFTの場合に、全ステータスのAPIキーで返す下書きのJSON
+	// 空の場合はBodyを返す
+	DraftBody string
+}
+
+// Media はフィクスチャのメディア
+type Media struct {
+	Id string
+	// 配信URLのパス(ディレクトリ/ファイル名)
+	Path        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// Fixture はサーバーが返すデータ
+type Fixture struct {
+	Keys Keys
+	// エンドポイントごとのコンテンツ(並び順はAPIが返す順)
+	Contents map[string][]Content
+	// エンドポイントごとのAPIスキーマのフィールド(apiFieldsの配列のJSON)
+	Schemas map[string]string
+	// エンドポイントごとのAPIスキーマのカスタムフィールド(customFieldsの配列のJSON)
+	CustomFields map[string]string
+	Media        []Media
+	// パスごとに、リクエストに対して返すステータスコード
+	// 通信の失敗を再現する場合に指定する
+	Failures map[string]int
+}
+
+// Request はサーバーが受け付けたリクエスト
+type Request struct {
+	Method string
+	// パスとクエリ
+	URI  string
+	Body string
+}
+
+// Server はmicroCMSのAPIを模したサーバー
+type Server struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	fixture  Fixture
+	requests []Request
+}
+
+// NewServer はフィクスチャのデータを返すサーバーを起動する
+// 利用後はCloseを呼び出す
+func NewServer(fixture Fixture) *Server {
+	s := &Server{fixture: fixture}
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// Close はサーバーを停止する
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL はサーバーのURLを返す
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// ContentsAPIBaseURL はコンテンツAPIのベースURLを返す
+func (s *Server) ContentsAPIBaseURL() string {
+	return s.server.URL + "/api"
+}
+
+// ManagementAPIBaseURL はマネジメントAPIのベースURLを返す
+func (s *Server) ManagementAPIBaseURL() string {
+	return s.server.URL + "/management/api"
+}
+
+// MediaURL はメディアの配信URLを返す
+func (s *Server) MediaURL(path string) string {
+	return s.server.URL + "/assets/" + path
+}
+
+// Requests は受け付けたリクエストを順に返す
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// SetFailures はリクエストに対して返すステータスコードを置き換える
+// 失敗した後に再開する場合などに、途中で通信の失敗をなくすために利用する
+func (s *Server) SetFailures(failures map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixture.Failures = failures
+}
+
+// Contents はエンドポイントの現在のコンテンツを返す
+// 更新やアップロードの結果を確認する場合に利用する
+func (s *Server) Contents(endpoint string) []Content {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.fixture.Contents[endpoint])
+}
+
+// MediaFiles は現在のメディアを返す
+func (s *Server) MediaFiles() []Media {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.fixture.Media)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: r.Method, URI: r.URL.RequestURI(), Body: string(body)})
+
+	if status, ok := s.fixture.Failures[r.URL.Path]; ok {
+		writeError(w, status, "Injected failure.")
+		return
+	}
+
+	key := r.Header.Get("X-MICROCMS-API-KEY")
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/assets/"):
+		s.serveMediaFile(w, r)
+	case strings.HasPrefix(r.URL.Path, "/management/api/v1/contents/"):
+		s.serveMetaData(w, r, key)
+	case r.URL.Path == "/management/api/v2/media":
+		s.serveMediaList(w, r, key)
+	case r.URL.Path == "/management/api/v1/media":
+		s.uploadMedia(w, r, key, body)
+	case strings.HasPrefix(r.URL.Path, "/management/api/v1/apis/"):
+		s.serveSchema(w, r, key)
+	case strings.HasPrefix(r.URL.Path, "/api/v1/"):
+		s.serveContents(w, r, key, body)
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+// serveContents はコンテンツAPIの一覧・個別取得と、コンテンツの更新を処理する
+func (s *Server) serveContents(w http.ResponseWriter, r *http.Request, key string, body []byte) {
+	endpoint, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/"), "/")
+	contents, ok := s.fixture.Contents[endpoint]
+	if !ok {
+		writeError(w, http.StatusNotFound, "API not found.")
+		return
+	}
+
+	draft := r.URL.Query().Get("status") == "draft"
+	switch r.Method {
+	case http.MethodPut:
+		s.createContent(w, endpoint, id, key, draft, body)
+		return
+	case http.MethodPatch:
+		s.patchContent(w, endpoint, id, key, draft, body)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+
+	var allStatus bool
+	switch {
+	case validKey(key, s.fixture.Keys.AllStatus):
+		allStatus = true
+	case validKey(key, s.fixture.Keys.Publish):
+	default:
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+
+	// APIキーの権限で取得できるコンテンツの内容
+	var visible []string
+	for _, content := range contents {
+		switch {
+		case allStatus && content.Status == "PUBLISH_AND_DRAFT" && content.DraftBody != "":
+			visible = append(visible, content.DraftBody)
+		case allStatus || content.Status == "PUBLISH" || content.Status == "PUBLISH_AND_DRAFT":
+			visible = append(visible, content.Body)
+		}
+	}
+
+	query, err := parseContentsQuery(r.URL.Query(), s.fixture.Schemas[endpoint])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if id != "" {
+		i := slices.IndexFunc(visible, func(raw string) bool { return gjson.Get(raw, "id").String() == id })
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "Content is not found.")
+			return
+		}
+		writeJSON(w, http.StatusOK, []byte(query.apply(visible[i])))
+		return
+	}
+
+	if filters := r.URL.Query().Get("filters"); filters != "" {
+		visible, err = filterContents(visible, filters)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	limit, offset, err := pagination(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page := make([]json.RawMessage, 0, limit)
+	for _, raw := range window(visible, limit, offset) {
+		page = append(page, json.RawMessage(query.apply(raw)))
+	}
+	writeJSONValue(w, map[string]any{"contents": page, "totalCount": len(visible), "offset": offset, "limit": limit})
+}
+
+// createContent はIDを指定したコンテンツの作成を処理する
+// draftがtrueの場合は下書きとして作成する
+func (s *Server) createContent(w http.ResponseWriter, endpoint, id, key string, draft bool, body []byte) {
+	if !validKey(key, s.fixture.Keys.Update) {
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Content id is required.")
+		return
+	}
+	if slices.ContainsFunc(s.fixture.Contents[endpoint], func(content Content) bool { return gjson.Get(content.Body, "id").String() == id }) {
+		writeError(w, http.StatusBadRequest, "Content already exists.")
+		return
+	}
+
+	merged, err := mergeFields(fmt.Sprintf(`{"id":%q}`, id), body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid body.")
+		return
+	}
+	status := "PUBLISH"
+	if draft {
+		status = "DRAFT"
+	}
+	s.fixture.Contents[endpoint] = append(s.fixture.Contents[endpoint], Content{Status: status, Body: merged})
+	writeJSONValue(w, map[string]string{"id": id})
+}
+
+// patchContent はコンテンツの更新を処理し、送られたフィールドをコンテンツに反映する
+// 公開中のコンテンツをdraftがtrueで更新した場合は、公開中かつ下書き中とする
+func (s *Server) patchContent(w http.ResponseWriter, endpoint, id, key string, draft bool, body []byte) {
+	if !validKey(key, s.fixture.Keys.Update) {
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+	contents := s.fixture.Contents[endpoint]
+	i := slices.IndexFunc(contents, func(content Content) bool { return gjson.Get(content.Body, "id").String() == id })
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Content is not found.")
+		return
+	}
+
+	content := &contents[i]
+	if draft && (content.Status == "PUBLISH" || content.Status == "PUBLISH_AND_DRAFT") {
+		current := content.DraftBody
+		if current == "" {
+			current = content.Body
+		}
+		merged, err := mergeFields(current, body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid body.")
+			return
+		}
+		content.Status = "PUBLISH_AND_DRAFT"
+		content.DraftBody = merged
+	} else {
+		merged, err := mergeFields(content.Body, body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid body.")
+			return
+		}
+		content.Body = merged
+	}
+	writeJSONValue(w, map[string]string{"id": id})
+}
+
+// mergeFields はコンテンツのJSONに、送られたフィールドを上書きしたJSONを返す
+func mergeFields(current string, body []byte) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", err
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(current), &merged); err != nil {
+		return "", err
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// serveMetaData はマネジメントAPIのコンテンツのメタデータの一覧を返す
+func (s *Server) serveMetaData(w http.ResponseWriter, r *http.Request, key string) {
+	if !validKey(key, s.fixture.Keys.MetaData) {
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+	endpoint := strings.TrimPrefix(r.URL.Path, "/management/api/v1/contents/")
+	contents, ok := s.fixture.Contents[endpoint]
+	if !ok {
+		writeError(w, http.StatusNotFound, "API not found.")
+		return
+	}
+	limit, offset, err := pagination(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := []map[string]any{}
+	for _, content := range window(contents, limit, offset) {
+		meta := map[string]any{
+			"id":     gjson.Get(content.Body, "id").String(),
+			"status": []string{content.Status},
+		}
+		for _, k := range []string{"createdAt", "updatedAt", "publishedAt", "revisedAt"} {
+			if v := gjson.Get(content.Body, k); v.Exists() {
+				meta[k] = v.String()
+			}
+		}
+		page = append(page, meta)
+	}
+	writeJSONValue(w, map[string]any{"contents": page, "totalCount": len(contents), "offset": offset, "limit": limit})
+}
+
+// serveMediaList はマネジメントAPIのメディアの一覧を、トークンによるページ送りで返す
+// limit=0の場合は合計件数のみを返す
+func (s *Server) serveMediaList(w http.ResponseWriter, r *http.Request, key string) {
+	if !validKey(key, s.fixture.Keys.Media) {
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+	limit, _, err := pagination(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// トークンは次に返すメディアの位置を表す
+	start := 0
+	if token := r.URL.Query().Get("token"); token != "" {
+		start, err = strconv.Atoi(strings.TrimPrefix(token, "token-"))
+		if err != nil || start < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid token.")
+			return
+		}
+	}
+
+	page := []map[string]any{}
+	for _, media := range window(s.fixture.Media, limit, start) {
+		page = append(page, map[string]any{
+			"id":     media.Id,
+			"url":    s.MediaURL(media.Path),
+			"width":  media.Width,
+			"height": media.Height,
+		})
+	}
+	response := map[string]any{"media": page, "totalCount": len(s.fixture.Media)}
+	if next := start + len(page); len(page) > 0 && next < len(s.fixture.Media) {
+		response["token"] = fmt.Sprintf("token-%d", next)
+	}
+	writeJSONValue(w, response)
+}
+
+// uploadMedia はメディアのアップロードを処理し、フィクスチャのメディアに追加する
+func (s *Server) uploadMedia(w http.ResponseWriter, r *http.Request, key string, body []byte) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+	if !validKey(key, s.fixture.Keys.Upload) {
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file.")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	n := len(s.fixture.Media) + 1
+	media := Media{
+		Id:          fmt.Sprintf("uploaded-%d", n),
+		Path:        fmt.Sprintf("uploaded-%d/%s", n, url.PathEscape(header.Filename)),
+		ContentType: header.Header.Get("Content-Type"),
+		Data:        data,
+	}
+	s.fixture.Media = append(s.fixture.Media, media)
+	writeJSONValue(w, map[string]string{"url": s.MediaURL(media.Path)})
+}
+
+// serveSchema はマネジメントAPIのAPIスキーマを返す
+func (s *Server) serveSchema(w http.ResponseWriter, r *http.Request, key string) {
+	if !validKey(key, s.fixture.Keys.MetaData) {
+		writeError(w, http.StatusUnauthorized, "X-MICROCMS-API-KEY header is invalid.")
+		return
+	}
+	endpoint := strings.TrimPrefix(r.URL.Path, "/management/api/v1/apis/")
+	fields, ok := s.fixture.Schemas[endpoint]
+	if !ok {
+		writeError(w, http.StatusNotFound, "API not found.")
+		return
+	}
+	customFields, ok := s.fixture.CustomFields[endpoint]
+	if !ok {
+		customFields = "[]"
+	}
+	writeJSON(w, http.StatusOK, []byte(`{"apiFields":`+fields+`,"customFields":`+customFields+`}`))
+}
+
+// serveMediaFile はメディアのファイルを配信する
+func (s *Server) serveMediaFile(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/assets/")
+	i := slices.IndexFunc(s.fixture.Media, func(media Media) bool { return media.Path == path })
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	media := s.fixture.Media[i]
+	if media.ContentType != "" {
+		w.Header().Set("Content-Type", media.ContentType)
+	}
+	w.Write(media.Data)
+}
+
+func validKey(key, want string) bool {
+	return want != "" && key == want
+}
+
+// pagination はlimitとoffsetのクエリを解釈する
+func pagination(query url.Values) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	var err error
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return 0, 0, fmt.Errorf("Invalid limit.")
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("Invalid offset.")
+		}
+	}
+	return limit, offset, nil
+}
+
+// window はoffsetからlimit件の要素を返す
+func window[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+func writeJSONValue(w http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.Marshal(map[string]string{"message": message})
+	writeJSON(w, status, b)
+}
@@ -0,0 +1,100 @@
+package mockcms
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(Fixture{
+		Keys: Keys{Publish: "publish", AllStatus: "all", MetaData: "meta", Media: "media", Update: "update"},
+		Contents: map[string][]Content{
+			"blogs": {
+				{Status: "PUBLISH", Body: `{"id":"a"}`},
+				{Status: "PUBLISH_AND_DRAFT", Body: `{"id":"b","title":"公開"}`, DraftBody: `{"id":"b","title":"下書き"}`},
+				{Status: "DRAFT", Body: `{"id":"c"}`},
+			},
+			"news": {
+				{Status: "PUBLISH", Body: `{"id":"n1","title":"春","views":10,"category":{"id":"x","name":"お知らせ"},"tags":[{"id":"t1"},{"id":"t2"}]}`},
+				{Status: "PUBLISH", Body: `{"id":"n2","title":"夏","views":30,"category":{"id":"y","name":"イベント"},"tags":[]}`},
+				{Status: "PUBLISH", Body: `{"id":"n3","title":"秋","views":20,"category":null,"tags":[{"id":"t2"}]}`},
+			},
+		},
+		Schemas: map[string]string{
+			"news": `[{"fieldId":"title","kind":"text"},{"fieldId":"views","kind":"number"},{"fieldId":"category","kind":"relation"},{"fieldId":"tags","kind":"relationList"}]`,
+		},
+		Media: []Media{
+			{Id: "m1", Path: "x/1.png", Data: []byte("1")},
+			{Id: "m2", Path: "y/2.png", Data: []byte("2")},
+			{Id: "m3", Path: "z/3.png", Data: []byte("3")},
+		},
+		Failures: map[string]int{"/api/v1/failed": http.StatusServiceUnavailable},
+	})
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "公開中のみ", path: "/api/v1/blogs", key: "publish", wantStatus: 200, wantBody: `{"contents":[{"id":"a"},{"id":"b","title":"公開"}],"limit":10,"offset":0,"totalCount":2}`},
+		{name: "全ステータス", path: "/api/v1/blogs?limit=2&offset=1", key: "all", wantStatus: 200, wantBody: `{"contents":[{"id":"b","title":"下書き"},{"id":"c"}],"limit":2,"offset":1,"totalCount":3}`},
+		{name: "公開中の個別取得", path: "/api/v1/blogs/b", key: "publish", wantStatus: 200, wantBody: `{"id":"b","title":"公開"}`},
+		{name: "下書きは公開用のAPIキーで取得できない", path: "/api/v1/blogs/c", key: "publish", wantStatus: 404, wantBody: `{"message":"Content is not found."}`},
+		{name: "APIキーの誤り", path: "/api/v1/blogs", key: "wrong", wantStatus: 401, wantBody: `{"message":"X-MICROCMS-API-KEY header is invalid."}`},
+		{name: "存在しないAPI", path: "/api/v1/missing", key: "publish", wantStatus: 404, wantBody: `{"message":"API not found."}`},
+		{name: "失敗の再現", path: "/api/v1/failed", key: "publish", wantStatus: 503, wantBody: `{"message":"Injected failure."}`},
+		{name: "fieldsの指定", path: "/api/v1/news?fields=id,category.name&limit=1", key: "publish", wantStatus: 200, wantBody: `{"contents":[{"id":"n1","category":{"id":"x","name":"お知らせ"}}],"limit":1,"offset":0,"totalCount":3}`},
+		{name: "depthが0", path: "/api/v1/news/n1?depth=0", key: "publish", wantStatus: 200, wantBody: `{"id":"n1","title":"春","views":10,"category":{"id":"x"},"tags":[{"id":"t1"},{"id":"t2"}]}`},
+		{name: "depthの誤り", path: "/api/v1/news?depth=4", key: "publish", wantStatus: 400, wantBody: `{"message":"Invalid depth."}`},
+		{name: "filtersの指定", path: "/api/v1/news?fields=id&filters=views[greater_than]15[and]title[not_equals]夏", key: "publish", wantStatus: 200, wantBody: `{"contents":[{"id":"n3"}],"limit":10,"offset":0,"totalCount":1}`},
+		{name: "コンテンツ参照のfilters", path: "/api/v1/news?fields=id&filters=tags[contains]t1[or]category[equals]y", key: "publish", wantStatus: 200, wantBody: `{"contents":[{"id":"n1"},{"id":"n2"}],"limit":10,"offset":0,"totalCount":2}`},
+		{name: "filtersのexists", path: "/api/v1/news?fields=id&filters=category[not_exists]", key: "publish", wantStatus: 200, wantBody: `{"contents":[{"id":"n3"}],"limit":10,"offset":0,"totalCount":1}`},
+		{name: "filtersの誤り", path: "/api/v1/news?filters=title[like]春", key: "publish", wantStatus: 400, wantBody: `{"message":"Invalid filters."}`},
+		{name: "メタデータ", path: "/management/api/v1/contents/blogs?limit=1&offset=1", key: "meta", wantStatus: 200, wantBody: `{"contents":[{"id":"b","status":["PUBLISH_AND_DRAFT"]}],"limit":1,"offset":1,"totalCount":3}`},
+		{name: "メディアの合計件数", path: "/management/api/v2/media?limit=0", key: "media", wantStatus: 200, wantBody: `{"media":[],"totalCount":3}`},
+		{name: "メディアの1ページ目", path: "/management/api/v2/media?limit=2", key: "media", wantStatus: 200, wantBody: `{"media":[{"height":0,"id":"m1","url":"` + server.MediaURL("x/1.png") + `","width":0},{"height":0,"id":"m2","url":"` + server.MediaURL("y/2.png") + `","width":0}],"token":"token-2","totalCount":3}`},
+		{name: "メディアの2ページ目", path: "/management/api/v2/media?limit=2&token=token-2", key: "media", wantStatus: 200, wantBody: `{"media":[{"height":0,"id":"m3","url":"` + server.MediaURL("z/3.png") + `","width":0}],"totalCount":3}`},
+		{name: "メディアのファイル", path: "/assets/y/2.png", wantStatus: 200, wantBody: "2"},
+		{name: "コンテンツの更新", method: "PATCH", path: "/api/v1/blogs/a", key: "update", body: `{"title":"更新"}`, wantStatus: 200, wantBody: `{"id":"a"}`},
+		{name: "更新の権限がない", method: "PATCH", path: "/api/v1/blogs/a", key: "publish", body: `{}`, wantStatus: 401, wantBody: `{"message":"X-MICROCMS-API-KEY header is invalid."}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, server.URL()+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-MICROCMS-API-KEY", tt.key)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus || string(b) != tt.wantBody {
+				t.Errorf("%s %s = %d %s, want %d %s", method, tt.path, resp.StatusCode, b, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+
+	if got := server.Contents("blogs")[0].Body; got != `{"id":"a","title":"更新"}` {
+		t.Errorf("更新後のコンテンツ = %s", got)
+	}
+	if got := len(server.Requests()); got != len(tests) {
+		t.Errorf("len(Requests()) = %d, want %d", got, len(tests))
+	}
+}
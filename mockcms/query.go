@@ -0,0 +1,198 @@
+package mockcms
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// contentsQuery はコンテンツAPIのクエリパラメータのうち、返すコンテンツの内容に関わるもの
+type contentsQuery struct {
+	// 返すフィールドID(空の場合はすべて)
+	fields []string
+	// コンテンツ参照の展開の深さ
+	// フィクスチャのコンテンツは1(省略時)の内容とし、0の場合はコンテンツ参照をIDのみのオブジェクトとする
+	// 2以上の場合は、フィクスチャのコンテンツをそのまま返す
+	depth int
+	// APIスキーマのコンテンツ参照・複数コンテンツ参照のフィールドID
+	relations []string
+}
+
+// parseContentsQuery はfields・depthを解釈する
+func parseContentsQuery(query url.Values, schema string) (contentsQuery, error) {
+	q := contentsQuery{depth: 1}
+	if v := query.Get("fields"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			// "category.name"のような指定は、フィールド単位で返す
+			field, _, _ = strings.Cut(strings.TrimSpace(field), ".")
+			q.fields = append(q.fields, field)
+		}
+	}
+	if v := query.Get("depth"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 || depth > 3 {
+			return contentsQuery{}, fmt.Errorf("Invalid depth.")
+		}
+		q.depth = depth
+	}
+	gjson.Parse(schema).ForEach(func(_, field gjson.Result) bool {
+		if kind := field.Get("kind").String(); kind == "relation" || kind == "relationList" {
+			q.relations = append(q.relations, field.Get("fieldId").String())
+		}
+		return true
+	})
+	return q, nil
+}
+
+// apply はコンテンツのJSON文字列に、fields・depthを適用する
+// キーの順序はそのまま保持する
+func (q contentsQuery) apply(raw string) string {
+	if len(q.fields) == 0 && q.depth != 0 {
+		return raw
+	}
+	var sb strings.Builder
+	sb.WriteString("{")
+	first := true
+	gjson.Parse(raw).ForEach(func(key, value gjson.Result) bool {
+		if len(q.fields) > 0 && !slices.Contains(q.fields, key.String()) {
+			return true
+		}
+		if !first {
+			sb.WriteString(",")
+		}
+		first = false
+		sb.WriteString(key.Raw)
+		sb.WriteString(":")
+		if q.depth == 0 && slices.Contains(q.relations, key.String()) {
+			sb.WriteString(relationIDs(value))
+		} else {
+			sb.WriteString(value.Raw)
+		}
+		return true
+	})
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// relationIDs は展開されたコンテンツ参照を、IDのみのオブジェクトにする
+func relationIDs(value gjson.Result) string {
+	idOnly := func(element gjson.Result) string {
+		if id := element.Get("id"); element.IsObject() && id.Exists() {
+			return `{"id":` + id.Raw + `}`
+		}
+		return element.Raw
+	}
+	if !value.IsArray() {
+		return idOnly(value)
+	}
+	elements := make([]string, 0)
+	for _, element := range value.Array() {
+		elements = append(elements, idOnly(element))
+	}
+	return "[" + strings.Join(elements, ",") + "]"
+}
+
+// filterCondition はfiltersの"フィールドID[演算子]値"の部分
+var filterCondition = regexp.MustCompile(`^([^\[\]]+)\[([a-z_]+)\](.*)$`)
+
+// filterContents はfiltersに一致するコンテンツを返す
+// [or]でつないだ条件のいずれかについて、[and]でつないだすべての条件に一致するものとする
+func filterContents(contents []string, filters string) ([]string, error) {
+	var groups [][]func(raw string) bool
+	for _, group := range strings.Split(filters, "[or]") {
+		var conditions []func(raw string) bool
+		for _, condition := range strings.Split(group, "[and]") {
+			match, err := parseFilterCondition(condition)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, match)
+		}
+		groups = append(groups, conditions)
+	}
+
+	var filtered []string
+	for _, raw := range contents {
+		if slices.ContainsFunc(groups, func(conditions []func(string) bool) bool {
+			return !slices.ContainsFunc(conditions, func(match func(string) bool) bool { return !match(raw) })
+		}) {
+			filtered = append(filtered, raw)
+		}
+	}
+	return filtered, nil
+}
+
+// parseFilterCondition は1つの条件を解釈する
+// コンテンツ参照はIDで比較し、配列はいずれかの要素が一致するかどうかとする
+func parseFilterCondition(condition string) (func(raw string) bool, error) {
+	m := filterCondition.FindStringSubmatch(condition)
+	if m == nil {
+		return nil, fmt.Errorf("Invalid filters.")
+	}
+	field, op, operand := m[1], m[2], m[3]
+	values := func(raw string) []string {
+		value := gjson.Get(raw, gjson.Escape(field))
+		var elements []gjson.Result
+		switch {
+		case !value.Exists() || value.Type == gjson.Null:
+			return nil
+		case value.IsArray():
+			elements = value.Array()
+		default:
+			elements = []gjson.Result{value}
+		}
+		var values []string
+		for _, element := range elements {
+			if element.IsObject() {
+				element = element.Get("id")
+			}
+			values = append(values, element.String())
+		}
+		return values
+	}
+	compare := func(value string) int {
+		a, errA := strconv.ParseFloat(value, 64)
+		b, errB := strconv.ParseFloat(operand, 64)
+		if errA == nil && errB == nil {
+			return cmp.Compare(a, b)
+		}
+		return strings.Compare(value, operand)
+	}
+	anyValue := func(raw string, match func(value string) bool) bool {
+		return slices.ContainsFunc(values(raw), match)
+	}
+
+	switch op {
+	case "equals":
+		return func(raw string) bool { return anyValue(raw, func(v string) bool { return v == operand }) }, nil
+	case "not_equals":
+		return func(raw string) bool { return !anyValue(raw, func(v string) bool { return v == operand }) }, nil
+	case "contains":
+		return func(raw string) bool {
+			return anyValue(raw, func(v string) bool { return strings.Contains(v, operand) })
+		}, nil
+	case "not_contains":
+		return func(raw string) bool {
+			return !anyValue(raw, func(v string) bool { return strings.Contains(v, operand) })
+		}, nil
+	case "begins_with":
+		return func(raw string) bool {
+			return anyValue(raw, func(v string) bool { return strings.HasPrefix(v, operand) })
+		}, nil
+	case "less_than":
+		return func(raw string) bool { return anyValue(raw, func(v string) bool { return compare(v) < 0 }) }, nil
+	case "greater_than":
+		return func(raw string) bool { return anyValue(raw, func(v string) bool { return compare(v) > 0 }) }, nil
+	case "exists":
+		return func(raw string) bool { return len(values(raw)) > 0 }, nil
+	case "not_exists":
+		return func(raw string) bool { return len(values(raw)) == 0 }, nil
+	}
+	return nil, fmt.Errorf("Invalid filters.")
+}